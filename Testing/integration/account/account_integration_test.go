@@ -0,0 +1,160 @@
+package integration_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/databaseConnector"
+	"HabitMaster/handlers"
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testDB *sql.DB
+
+const (
+	testEmail    = "account@example.com"
+	testPassword = "Account-Password-42"
+)
+
+// nopSender не отправляет письма
+type nopSender struct{}
+
+func (nopSender) SendEmail(to []string, subject, body string) error { return nil }
+func (nopSender) SendEmailWithAttachment(to []string, subject, body, fileName string, fileData []byte) error {
+	return nil
+}
+func (nopSender) SendMultipartEmail(to []string, subject, htmlBody, textBody string) error {
+	return nil
+}
+func (nopSender) SendSensitiveEmail(to []string, subject, htmlBody, textBody string) error {
+	return nil
+}
+
+// setupTestDB добавляет пользователя с паролем и активным API-токеном
+func setupTestDB(t *testing.T) int {
+	testDB = databaseConnector.ConnectBD()
+	if _, err := testDB.Exec("DELETE FROM users WHERE email = $1", testEmail); err != nil {
+		t.Fatalf("❌ Ошибка очистки базы перед тестами: %v", err)
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	var userID int
+	err := testDB.QueryRow(`INSERT INTO users (name, email, password, role, is_verified, created_at, updated_at)
+		VALUES ('Account', $1, $2, 'user', TRUE, NOW(), NOW()) RETURNING user_id`, testEmail, string(hash)).Scan(&userID)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки тестового пользователя: %v", err)
+	}
+	_, err = testDB.Exec(`INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes)
+		VALUES ($1, 'ci', 'account-test-hash', 'hm_test', '{habits:read}')`, userID)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки API-токена: %v", err)
+	}
+	return userID
+}
+
+func teardownTestDB(t *testing.T) {
+	if testDB != nil {
+		testDB.Exec("DELETE FROM users WHERE email = $1", testEmail)
+		testDB.Close()
+	}
+}
+
+// asUser выполняет запрос от имени пользователя
+func asUser(handler http.Handler, userID int, method, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/me", bytes.NewBufferString(body))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: userID, Role: auth.RoleUser}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// 📌 **Тест: без верного пароля удаление не планируется**
+func TestDeleteAccountRequiresPassword(t *testing.T) {
+	userID := setupTestDB(t)
+	defer teardownTestDB(t)
+
+	handler := handlers.DeleteAccount(testDB, nopSender{})
+	if code := asUser(handler, userID, http.MethodDelete, `{}`).Code; code != http.StatusBadRequest {
+		t.Errorf("❌ Без пароля ожидался статус 400, получен %d", code)
+	}
+	if code := asUser(handler, userID, http.MethodDelete, `{"password":"wrong-password"}`).Code; code != http.StatusUnauthorized {
+		t.Errorf("❌ С неверным паролем ожидался статус 401, получен %d", code)
+	}
+
+	var scheduled sql.NullTime
+	testDB.QueryRow(`SELECT deletion_scheduled_for FROM users WHERE user_id = $1`, userID).Scan(&scheduled)
+	if scheduled.Valid {
+		t.Errorf("❌ Удаление не должно планироваться, запланировано на %v", scheduled.Time)
+	}
+}
+
+// 📌 **Тест: аккаунт удаляется только после окончания отсрочки**
+func TestDeleteAccountGracePeriod(t *testing.T) {
+	userID := setupTestDB(t)
+	defer teardownTestDB(t)
+
+	body, _ := json.Marshal(map[string]string{"password": testPassword})
+	recorder := asUser(handlers.DeleteAccount(testDB, nopSender{}), userID, http.MethodDelete, string(body))
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("❌ Ожидался статус 202, получен %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var scheduled time.Time
+	var activeTokens int
+	testDB.QueryRow(`SELECT deletion_scheduled_for FROM users WHERE user_id = $1`, userID).Scan(&scheduled)
+	testDB.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE user_id = $1 AND revoked_at IS NULL`, userID).Scan(&activeTokens)
+	if until := time.Until(scheduled); until < 13*24*time.Hour || until > 14*24*time.Hour {
+		t.Errorf("❌ Ожидалась отсрочка 14 дней, до удаления %v", until)
+	}
+	if activeTokens != 0 {
+		t.Errorf("❌ API-токены должны отзываться сразу, активных %d", activeTokens)
+	}
+
+	handlers.PurgeDueAccounts(testDB)
+	var exists bool
+	testDB.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1)`, userID).Scan(&exists)
+	if !exists {
+		t.Fatal("❌ Аккаунт не должен удаляться до окончания отсрочки")
+	}
+
+	testDB.Exec(`UPDATE users SET deletion_scheduled_for = NOW() - INTERVAL '1 minute' WHERE user_id = $1`, userID)
+	handlers.PurgeDueAccounts(testDB)
+	testDB.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1)`, userID).Scan(&exists)
+	if exists {
+		t.Error("❌ Аккаунт должен удаляться после окончания отсрочки")
+	}
+}
+
+// 📌 **Тест: архив с данными содержит файл для каждого раздела экспорта**
+func TestExportAccountContainsEveryFile(t *testing.T) {
+	userID := setupTestDB(t)
+	defer teardownTestDB(t)
+
+	recorder := asUser(handlers.ExportAccount(testDB), userID, http.MethodGet, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("❌ Ожидался статус 200, получен %d: %s", recorder.Code, recorder.Body)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+	if err != nil {
+		t.Fatalf("❌ Ответ не является ZIP-архивом: %v", err)
+	}
+
+	files := make(map[string]bool)
+	for _, f := range archive.File {
+		files[f.Name] = true
+	}
+	for _, name := range handlers.ExportFileNames() {
+		if !files[name] {
+			t.Errorf("❌ В архиве нет файла %s", name)
+		}
+	}
+	if len(archive.File) != len(handlers.ExportFileNames()) {
+		t.Errorf("❌ Ожидалось %d файлов, в архиве %d", len(handlers.ExportFileNames()), len(archive.File))
+	}
+}
@@ -0,0 +1,92 @@
+package integration_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/databaseConnector"
+	"HabitMaster/routes"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+var testDB *sql.DB
+
+const testEmail = "api-token-scope@example.com"
+
+// setupTestDB добавляет пользователя, от имени которого выпускаются токены
+func setupTestDB(t *testing.T) int {
+	testDB = databaseConnector.ConnectBD()
+	if _, err := testDB.Exec("DELETE FROM users WHERE email = $1", testEmail); err != nil {
+		t.Fatalf("❌ Ошибка очистки базы перед тестами: %v", err)
+	}
+	var userID int
+	err := testDB.QueryRow(`INSERT INTO users (name, email, password, role, is_verified, created_at, updated_at)
+		VALUES ('Scopes', $1, 'x', 'user', TRUE, NOW(), NOW()) RETURNING user_id`, testEmail).Scan(&userID)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки тестового пользователя: %v", err)
+	}
+	return userID
+}
+
+func teardownTestDB(t *testing.T) {
+	if testDB != nil {
+		testDB.Exec("DELETE FROM users WHERE email = $1", testEmail)
+		testDB.Close()
+	}
+}
+
+// createToken выпускает персональный токен с указанными областями доступа
+func createToken(t *testing.T, userID int, scopes []string) string {
+	body, _ := json.Marshal(map[string]interface{}{"name": "scope test", "scopes": scopes})
+	req := httptest.NewRequest(http.MethodPost, "/api/tokens", bytes.NewReader(body))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: userID, Role: "user"}))
+	recorder := httptest.NewRecorder()
+	auth.CreateAPIToken(recorder, req)
+
+	var created struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&created); err != nil || created.Token == "" {
+		t.Fatalf("❌ Не удалось создать API-токен, статус %d", recorder.Code)
+	}
+	return created.Token
+}
+
+// 📌 **Тест: токен без нужной области и анонимный запрос не проходят к привычкам и целям**
+func TestTrackerRoutesEnforceTokenScopes(t *testing.T) {
+	userID := setupTestDB(t)
+	defer teardownTestDB(t)
+
+	r := mux.NewRouter()
+	r.Use(auth.OptionalAuthMiddleware, auth.TokenScopeMiddleware)
+	routes.RegisterTrackerRoutes(r, testDB)
+
+	token := createToken(t, userID, []string{"habits:read"})
+	cases := []struct {
+		name, method, path, token string
+		status                    int
+	}{
+		{"чтение в пределах области", http.MethodGet, "/api/habits", token, http.StatusOK},
+		{"запись без habits:write", http.MethodPost, "/api/habits", token, http.StatusForbidden},
+		{"откат без habits:write", http.MethodPost, "/api/habits/1/history/1/revert", token, http.StatusForbidden},
+		{"цели без goals:read", http.MethodGet, "/api/goals", token, http.StatusForbidden},
+		{"анонимное чтение", http.MethodGet, "/api/habits", "", http.StatusUnauthorized},
+		{"анонимная запись", http.MethodPost, "/api/goals", "", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, bytes.NewReader([]byte("{}")))
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		if recorder.Code != c.status {
+			t.Errorf("❌ %s: ожидался статус %d, получен %d", c.name, c.status, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package integration_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/databaseConnector"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var testDB *sql.DB
+
+const (
+	oldEmail = "old@example.com"
+	newEmail = "new@example.com"
+)
+
+// tokenHash — хеш токена в том виде, в каком он хранится в email_changes
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// setupTestDB добавляет пользователя, API-токен и запрос смены email
+// с токенами "confirm-token" и "revert-token"
+func setupTestDB(t *testing.T, expiresIn string) int {
+	testDB = databaseConnector.ConnectBD()
+	if _, err := testDB.Exec("DELETE FROM users WHERE email IN ($1, $2)", oldEmail, newEmail); err != nil {
+		t.Fatalf("❌ Ошибка очистки базы перед тестами: %v", err)
+	}
+	var userID int
+	err := testDB.QueryRow(`INSERT INTO users (name, email, password, role, is_verified, created_at, updated_at)
+		VALUES ('Change', $1, 'hashedpassword', 'user', TRUE, NOW(), NOW()) RETURNING user_id`, oldEmail).Scan(&userID)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки тестового пользователя: %v", err)
+	}
+	_, err = testDB.Exec(`INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes)
+		VALUES ($1, 'ci', 'email-change-test-hash', 'hm_test', '{habits:read}')`, userID)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки API-токена: %v", err)
+	}
+	_, err = testDB.Exec(`INSERT INTO email_changes (user_id, old_email, new_email, confirm_token_hash, revert_token_hash,
+			expires_at, revert_expires_at)
+		VALUES ($1, $2, $3, $4, $5, NOW() + $6::INTERVAL, NOW() + INTERVAL '7 days')`,
+		userID, oldEmail, newEmail, tokenHash("confirm-token"), tokenHash("revert-token"), expiresIn)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки запроса смены email: %v", err)
+	}
+	return userID
+}
+
+func teardownTestDB(t *testing.T) {
+	if testDB != nil {
+		testDB.Exec("DELETE FROM users WHERE email IN ($1, $2)", oldEmail, newEmail)
+		testDB.Close()
+	}
+}
+
+// post вызывает обработчик с токеном в теле
+func post(handler http.HandlerFunc, token string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"token": token})
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	return recorder
+}
+
+// currentEmail — адрес пользователя в базе
+func currentEmail(userID int) string {
+	var email string
+	testDB.QueryRow(`SELECT email FROM users WHERE user_id = $1`, userID).Scan(&email)
+	return email
+}
+
+// 📌 **Тест: ссылка подтверждения срабатывает только один раз**
+func TestConfirmEmailChangeRejectsReusedToken(t *testing.T) {
+	userID := setupTestDB(t, "1 hour")
+	defer teardownTestDB(t)
+
+	if code := post(auth.ConfirmEmailChange, "confirm-token").Code; code != http.StatusOK {
+		t.Fatalf("❌ Ожидался статус 200, получен %d", code)
+	}
+	if email := currentEmail(userID); email != newEmail {
+		t.Fatalf("❌ Ожидался адрес %s, получен %s", newEmail, email)
+	}
+	if code := post(auth.ConfirmEmailChange, "confirm-token").Code; code != http.StatusBadRequest {
+		t.Errorf("❌ Повторное подтверждение должно отклоняться, получен статус %d", code)
+	}
+}
+
+// 📌 **Тест: просроченная ссылка подтверждения не меняет адрес**
+func TestConfirmEmailChangeRejectsExpiredToken(t *testing.T) {
+	userID := setupTestDB(t, "-1 minute")
+	defer teardownTestDB(t)
+
+	if code := post(auth.ConfirmEmailChange, "confirm-token").Code; code != http.StatusBadRequest {
+		t.Errorf("❌ Просроченная ссылка должна отклоняться, получен статус %d", code)
+	}
+	if email := currentEmail(userID); email != oldEmail {
+		t.Errorf("❌ Адрес не должен меняться, получен %s", email)
+	}
+}
+
+// 📌 **Тест: отмена после подтверждения возвращает адрес и отзывает весь доступ**
+func TestRevertAfterConfirmRevokesAccess(t *testing.T) {
+	userID := setupTestDB(t, "1 hour")
+	defer teardownTestDB(t)
+	if _, err := testDB.Exec(`INSERT INTO sessions (user_id) VALUES ($1)`, userID); err != nil {
+		t.Fatalf("❌ Ошибка вставки сессии: %v", err)
+	}
+
+	if code := post(auth.ConfirmEmailChange, "confirm-token").Code; code != http.StatusOK {
+		t.Fatalf("❌ Ожидался статус 200, получен %d", code)
+	}
+	if code := post(auth.RevertEmailChange, "revert-token").Code; code != http.StatusOK {
+		t.Fatalf("❌ Ожидался статус 200, получен %d", code)
+	}
+
+	if email := currentEmail(userID); email != oldEmail {
+		t.Errorf("❌ Ожидался возврат адреса %s, получен %s", oldEmail, email)
+	}
+	var sessions, tokens int
+	testDB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = $1 AND revoked_at IS NULL`, userID).Scan(&sessions)
+	testDB.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE user_id = $1 AND revoked_at IS NULL`, userID).Scan(&tokens)
+	if sessions != 0 || tokens != 0 {
+		t.Errorf("❌ После отмены должен отзываться весь доступ, активно сессий %d, API-токенов %d", sessions, tokens)
+	}
+	if code := post(auth.RevertEmailChange, "revert-token").Code; code != http.StatusBadRequest {
+		t.Errorf("❌ Повторная отмена должна отклоняться, получен статус %d", code)
+	}
+}
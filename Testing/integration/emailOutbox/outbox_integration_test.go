@@ -0,0 +1,131 @@
+package integration_test
+
+import (
+	"HabitMaster/databaseConnector"
+	"HabitMaster/emailSender"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testDB *sql.DB
+
+// Подготовка тестовой базы: очередь писем очищается
+func setupTestDB(t *testing.T) {
+	testDB = databaseConnector.ConnectBD()
+	if _, err := testDB.Exec("DELETE FROM email_outbox"); err != nil {
+		t.Fatalf("Ошибка очистки очереди писем: %v", err)
+	}
+}
+
+func teardownTestDB(t *testing.T) {
+	if testDB != nil {
+		testDB.Close()
+	}
+}
+
+// recordingSender запоминает, каким методом отправлено письмо
+type recordingSender struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (s *recordingSender) record(method string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, method)
+	return nil
+}
+
+func (s *recordingSender) SendEmail(to []string, subject, body string) error {
+	return s.record("SendEmail")
+}
+
+func (s *recordingSender) SendEmailWithAttachment(to []string, subject, body, fileName string, fileData []byte) error {
+	return s.record("SendEmailWithAttachment")
+}
+
+func (s *recordingSender) SendMultipartEmail(to []string, subject, htmlBody, textBody string) error {
+	return s.record("SendMultipartEmail")
+}
+
+func (s *recordingSender) SendSensitiveEmail(to []string, subject, htmlBody, textBody string) error {
+	return s.record("SendSensitiveEmail")
+}
+
+// lastMessageID — id последнего письма в очереди
+func lastMessageID(t *testing.T) int {
+	var id int
+	if err := testDB.QueryRow(`SELECT MAX(id) FROM email_outbox`).Scan(&id); err != nil {
+		t.Fatalf("Ошибка чтения очереди: %v", err)
+	}
+	return id
+}
+
+// Тест: текст письма с секретом не отдаётся через API очереди и стирается после отправки
+func TestSensitiveEmailIsRedactedAndCleared(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	err := emailSender.EnqueueSensitive(testDB, []string{"user@example.com"}, "Reset", "<a href=\"/reset?token=secret\">", "token=secret")
+	if err != nil {
+		t.Fatalf("Ошибка постановки письма в очередь: %v", err)
+	}
+	id := lastMessageID(t)
+
+	message, err := emailSender.GetOutboxMessage(testDB, id)
+	if err != nil {
+		t.Fatalf("Ошибка чтения письма: %v", err)
+	}
+	if !message.Sensitive || message.Body != "" || message.TextBody != "" {
+		t.Errorf("Текст письма с секретом не должен возвращаться: %+v", message)
+	}
+
+	sender := &recordingSender{}
+	config := emailSender.OutboxConfigFromEnv()
+	config.Workers, config.PollInterval = 1, 50*time.Millisecond
+	emailSender.NewOutbox(testDB, sender, config).Start()
+
+	var status, body, textBody string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		testDB.QueryRow(`SELECT status, body, text_body FROM email_outbox WHERE id = $1`, id).Scan(&status, &body, &textBody)
+		if status == emailSender.StatusSent {
+			break
+		}
+	}
+	if status != emailSender.StatusSent {
+		t.Fatalf("Письмо не отправлено, статус %q", status)
+	}
+	if body != "" || textBody != "" {
+		t.Errorf("Текст отправленного письма должен стираться, осталось %q / %q", body, textBody)
+	}
+	if len(sender.calls) != 1 || sender.calls[0] != "SendSensitiveEmail" {
+		t.Errorf("Ожидалась одна отправка через SendSensitiveEmail, получено %v", sender.calls)
+	}
+}
+
+// Тест: dead-письмо с секретом не повторяется, старые отправленные письма удаляются
+func TestSensitiveDeadEmailAndRetention(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	emailSender.EnqueueSensitive(testDB, []string{"user@example.com"}, "Code", "<b>123456</b>", "123456")
+	sensitiveID := lastMessageID(t)
+	emailSender.Enqueue(testDB, []string{"user@example.com"}, "News", "<p>Hello</p>", "", nil)
+	plainID := lastMessageID(t)
+	testDB.Exec(`UPDATE email_outbox SET status = 'dead'`)
+
+	if err := emailSender.RetryOutboxMessage(testDB, sensitiveID); err != emailSender.ErrMessageNotRetryable {
+		t.Errorf("Dead-письмо с секретом не должно повторяться, получено %v", err)
+	}
+	if err := emailSender.RetryOutboxMessage(testDB, plainID); err != nil {
+		t.Errorf("Обычное dead-письмо должно повторяться: %v", err)
+	}
+
+	testDB.Exec(`UPDATE email_outbox SET status = 'sent', updated_at = NOW() - INTERVAL '40 days' WHERE id = $1`, sensitiveID)
+	n, err := emailSender.PurgeOutbox(testDB, 30*24*time.Hour)
+	if err != nil || n != 1 {
+		t.Errorf("Ожидалось удаление одного старого письма, удалено %d (%v)", n, err)
+	}
+}
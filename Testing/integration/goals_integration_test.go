@@ -65,6 +65,29 @@ func TestCreateGoal(t *testing.T) {
 	t.Log("Тест создания цели успешно выполнен.")
 }
 
+// 📌 **Тест: созданная цель с метрикой возвращается с рассчитанным прогрессом**
+func TestCreateGoalReturnsProgress(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"name":     "Measured Goal",
+		"deadline": "2099-12-31",
+		"metric":   map[string]interface{}{"unit": "km", "start": 10, "target": 20, "direction": "increase"},
+	})
+	req := httptest.NewRequest("POST", "/api/goals", bytes.NewBuffer(body))
+	recorder := httptest.NewRecorder()
+	handlers.CreateGoal(testDB).ServeHTTP(recorder, req)
+
+	var created handlers.Goal
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil || created.Metric == nil {
+		t.Fatalf("❌ Ожидалась цель с метрикой, получено %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if created.Metric.Current != 10 || created.Metric.OnTrack == nil {
+		t.Errorf("❌ Прогресс не рассчитан: current=%v, on_track=%v", created.Metric.Current, created.Metric.OnTrack)
+	}
+}
+
 // 📌 **Тест получения целей**
 func TestGetGoals(t *testing.T) {
 	setupTestDB(t)
@@ -124,3 +147,34 @@ func TestDeleteGoalByName(t *testing.T) {
 
 	t.Log("Тест удаления цели успешно выполнен.")
 }
+
+// 📌 **Тест: объектив без ключевых результатов оценивается по своей метрике**
+func TestGetOKRsScoresObjectiveByMetric(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	var goalID int
+	err := testDB.QueryRow(`INSERT INTO goals (name, description, deadline, created_at, updated_at,
+			metric_unit, metric_start, metric_target, metric_direction, quarter)
+		VALUES ('Run 10 km', '', '2026-12-31', NOW(), NOW(), 'km', 0, 10, 'increase', '2026-Q4') RETURNING id`).Scan(&goalID)
+	if err != nil {
+		t.Fatalf("Ошибка вставки тестовой цели: %v", err)
+	}
+	if _, err := testDB.Exec(`INSERT INTO goal_progress (goal_id, value) VALUES ($1, 5)`, goalID); err != nil {
+		t.Fatalf("Ошибка вставки прогресса: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/okrs?quarter=2026-Q4", nil)
+	recorder := httptest.NewRecorder()
+	handlers.GetOKRs(testDB).ServeHTTP(recorder, req)
+
+	var response struct {
+		Objectives []handlers.Objective `json:"objectives"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || len(response.Objectives) != 1 {
+		t.Fatalf("Некорректный ответ (%d): %v", recorder.Code, err)
+	}
+	if score := response.Objectives[0].Score; score != 0.5 {
+		t.Errorf("Ожидалась оценка 0.5 по метрике, получено %v", score)
+	}
+}
@@ -1,6 +1,7 @@
 package habits_test
 
 import (
+	"HabitMaster/auth"
 	"HabitMaster/databaseConnector"
 	"HabitMaster/handlers"
 	"bytes"
@@ -8,7 +9,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+
+	"github.com/gorilla/mux"
 )
 
 // Глобальная переменная для базы данных
@@ -140,3 +144,56 @@ func TestDeleteHabitByName(t *testing.T) {
 
 	t.Log("Тест удаления привычки успешно выполнен.")
 }
+
+// insertHistoryUser добавляет пользователя для проверки доступа к истории
+func insertHistoryUser(t *testing.T, email string) int {
+	testDB.Exec("DELETE FROM users WHERE email = $1", email)
+	var userID int
+	err := testDB.QueryRow(`INSERT INTO users (name, email, password, role, created_at, updated_at)
+		VALUES ('History', $1, 'x', 'user', NOW(), NOW()) RETURNING user_id`, email).Scan(&userID)
+	if err != nil {
+		t.Fatalf("Ошибка вставки пользователя: %v", err)
+	}
+	return userID
+}
+
+// historyRequest вызывает обработчик истории от имени пользователя
+func historyRequest(handler http.HandlerFunc, method string, userID int, vars map[string]string) int {
+	req := httptest.NewRequest(method, "/api/habits/"+vars["id"]+"/history", nil)
+	req = mux.SetURLVars(req, vars)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: userID, Role: "user"}))
+	recorder := httptest.NewRecorder()
+	handler(recorder, req)
+	return recorder.Code
+}
+
+// 📌 **Тест: история и откат привычки доступны только владельцу**
+func TestHabitHistoryRequiresOwner(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	owner := insertHistoryUser(t, "history-owner@example.com")
+	stranger := insertHistoryUser(t, "history-stranger@example.com")
+	defer testDB.Exec("DELETE FROM users WHERE user_id IN ($1, $2)", owner, stranger)
+
+	var habitID int
+	err := testDB.QueryRow(`INSERT INTO habits (name, description, created_at, updated_at, user_id)
+		VALUES ('Private Habit', 'Owned', NOW(), NOW(), $1) RETURNING id`, owner).Scan(&habitID)
+	if err != nil {
+		t.Fatalf("Ошибка вставки тестовой привычки: %v", err)
+	}
+	vars := map[string]string{"id": strconv.Itoa(habitID), "version": "1"}
+
+	if code := historyRequest(handlers.GetHabitHistory(testDB), http.MethodGet, stranger, vars); code != http.StatusNotFound {
+		t.Errorf("❌ Чужая история должна давать 404, получен %d", code)
+	}
+	if code := historyRequest(handlers.RevertHabit(testDB), http.MethodPost, stranger, vars); code != http.StatusNotFound {
+		t.Errorf("❌ Откат чужой привычки должен давать 404, получен %d", code)
+	}
+	if code := historyRequest(handlers.GetHabitHistory(testDB), http.MethodGet, owner, vars); code != http.StatusOK {
+		t.Errorf("❌ Владелец должен видеть историю, получен %d", code)
+	}
+	if code := historyRequest(handlers.RevertHabit(testDB), http.MethodPost, owner, vars); code != http.StatusOK {
+		t.Errorf("❌ Владелец должен откатывать привычку, получен %d", code)
+	}
+}
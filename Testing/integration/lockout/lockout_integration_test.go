@@ -0,0 +1,85 @@
+package integration_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/databaseConnector"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testDB *sql.DB
+
+const (
+	testEmail    = "lockout@example.com"
+	testPassword = "Lockout-Password-42"
+)
+
+// setupTestDB добавляет подтверждённого пользователя с включённой 2FA
+func setupTestDB(t *testing.T) int {
+	testDB = databaseConnector.ConnectBD()
+	if _, err := testDB.Exec("DELETE FROM users WHERE email = $1", testEmail); err != nil {
+		t.Fatalf("❌ Ошибка очистки базы перед тестами: %v", err)
+	}
+	testDB.Exec("DELETE FROM login_attempts WHERE ip = '192.0.2.1'")
+	secret, _ := auth.GenerateTOTPSecret()
+	hash, _ := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	var userID int
+	err := testDB.QueryRow(`INSERT INTO users (name, email, password, role, is_verified, totp_secret, totp_enabled, created_at, updated_at)
+		VALUES ('Lockout', $1, $2, 'user', TRUE, $3, TRUE, NOW(), NOW()) RETURNING user_id`, testEmail, string(hash), secret).Scan(&userID)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки тестового пользователя: %v", err)
+	}
+	return userID
+}
+
+func teardownTestDB(t *testing.T) {
+	if testDB != nil {
+		testDB.Exec("DELETE FROM users WHERE email = $1", testEmail)
+		testDB.Close()
+	}
+}
+
+// post вызывает обработчик с JSON-телом
+func post(handler http.HandlerFunc, payload map[string]string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.RemoteAddr = "192.0.2.1:1234"
+	recorder := httptest.NewRecorder()
+	handler(recorder, req)
+	return recorder
+}
+
+// 📌 **Тест: неверные коды 2FA блокируют аккаунт, даже если каждый раз запрашивать новый mfa_token**
+func TestWrongSecondFactorCodesLockAccount(t *testing.T) {
+	userID := setupTestDB(t)
+	defer teardownTestDB(t)
+
+	for i := 0; i < 5; i++ {
+		login := post(auth.Login, map[string]string{"email": testEmail, "password": testPassword})
+		var challenge struct {
+			MFAToken string `json:"mfa_token"`
+		}
+		if err := json.NewDecoder(login.Body).Decode(&challenge); err != nil || challenge.MFAToken == "" {
+			t.Fatalf("❌ Попытка %d: ожидался mfa_token, получен статус %d", i+1, login.Code)
+		}
+		if code := post(auth.LoginSecondFactor, map[string]string{"mfa_token": challenge.MFAToken, "code": "not-a-code"}).Code; code != http.StatusUnauthorized {
+			t.Fatalf("❌ Попытка %d: ожидался статус 401, получен %d", i+1, code)
+		}
+	}
+
+	var failures int
+	var locked bool
+	testDB.QueryRow(`SELECT failed_login_count, locked_until > NOW() FROM users WHERE user_id = $1`, userID).Scan(&failures, &locked)
+	if failures != 5 || !locked {
+		t.Errorf("❌ Ожидалась блокировка после 5 неверных кодов, счётчик %d, заблокирован %v", failures, locked)
+	}
+	if code := post(auth.Login, map[string]string{"email": testEmail, "password": testPassword}).Code; code != http.StatusTooManyRequests {
+		t.Errorf("❌ Заблокированный аккаунт не должен получать mfa_token, получен статус %d", code)
+	}
+}
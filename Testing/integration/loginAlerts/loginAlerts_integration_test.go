@@ -0,0 +1,73 @@
+package integration_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/databaseConnector"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testDB *sql.DB
+
+const (
+	testEmail    = "reset-required@example.com"
+	testPassword = "Reset-Required-42"
+)
+
+// setupTestDB добавляет пользователя, чей пароль помечен скомпрометированным
+func setupTestDB(t *testing.T) int {
+	testDB = databaseConnector.ConnectBD()
+	if _, err := testDB.Exec("DELETE FROM users WHERE email = $1", testEmail); err != nil {
+		t.Fatalf("❌ Ошибка очистки базы перед тестами: %v", err)
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	var userID int
+	err := testDB.QueryRow(`INSERT INTO users (name, email, password, role, is_verified, password_reset_required, created_at, updated_at)
+		VALUES ('Reset', $1, $2, 'user', TRUE, TRUE, NOW(), NOW()) RETURNING user_id`, testEmail, string(hash)).Scan(&userID)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки тестового пользователя: %v", err)
+	}
+	return userID
+}
+
+func teardownTestDB(t *testing.T) {
+	if testDB != nil {
+		testDB.Exec("DELETE FROM users WHERE email = $1", testEmail)
+		testDB.Close()
+	}
+}
+
+// login отправляет запрос входа по паролю
+func login(password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"email": testEmail, "password": password})
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	req.RemoteAddr = "192.0.2.2:1234"
+	recorder := httptest.NewRecorder()
+	auth.Login(recorder, req)
+	return recorder
+}
+
+// 📌 **Тест: верный пароль при обязательном сбросе неотличим от неверного и не открывает сессию**
+func TestLoginWithResetRequiredLooksLikeWrongPassword(t *testing.T) {
+	userID := setupTestDB(t)
+	defer teardownTestDB(t)
+
+	correct := login(testPassword)
+	wrong := login("Wrong-Password-42")
+	if correct.Code != http.StatusUnauthorized || correct.Body.String() != wrong.Body.String() {
+		t.Errorf("❌ Ожидался такой же ответ, как при неверном пароле: %d %q против %d %q",
+			correct.Code, correct.Body.String(), wrong.Code, wrong.Body.String())
+	}
+
+	var sessions int
+	testDB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = $1`, userID).Scan(&sessions)
+	if sessions != 0 {
+		t.Errorf("❌ Сессия не должна создаваться, найдено %d", sessions)
+	}
+}
@@ -0,0 +1,70 @@
+package integration_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/databaseConnector"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testDB *sql.DB
+
+const testEmail = "password@example.com"
+
+// setupTestDB добавляет пользователя с паролем и активным API-токеном
+func setupTestDB(t *testing.T, password string) int {
+	testDB = databaseConnector.ConnectBD()
+	if _, err := testDB.Exec("DELETE FROM users WHERE email = $1", testEmail); err != nil {
+		t.Fatalf("❌ Ошибка очистки базы перед тестами: %v", err)
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	var userID int
+	err := testDB.QueryRow(`INSERT INTO users (name, email, password, role, is_verified, created_at, updated_at)
+		VALUES ('Password', $1, $2, 'user', TRUE, NOW(), NOW()) RETURNING user_id`, testEmail, string(hash)).Scan(&userID)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки тестового пользователя: %v", err)
+	}
+	_, err = testDB.Exec(`INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes)
+		VALUES ($1, 'ci', 'password-test-hash', 'hm_test', '{habits:read}')`, userID)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки API-токена: %v", err)
+	}
+	return userID
+}
+
+func teardownTestDB(t *testing.T) {
+	if testDB != nil {
+		testDB.Exec("DELETE FROM users WHERE email = $1", testEmail)
+		testDB.Close()
+	}
+}
+
+// 📌 **Тест: смена пароля отзывает и API-токены пользователя**
+func TestChangePasswordRevokesAPITokens(t *testing.T) {
+	userID := setupTestDB(t, "Old-Password-Horse-42")
+	defer teardownTestDB(t)
+
+	body, _ := json.Marshal(map[string]string{
+		"current_password": "Old-Password-Horse-42",
+		"new_password":     "New-Password-Battery-77",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/me/password", bytes.NewReader(body))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: userID, Role: auth.RoleUser}))
+	recorder := httptest.NewRecorder()
+	auth.ChangePassword(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("❌ Ожидался статус 200, получен %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var active int
+	testDB.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE user_id = $1 AND revoked_at IS NULL`, userID).Scan(&active)
+	if active != 0 {
+		t.Errorf("❌ После смены пароля осталось %d активных API-токенов", active)
+	}
+}
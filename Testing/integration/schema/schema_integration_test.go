@@ -0,0 +1,39 @@
+package integration_test
+
+import (
+	"HabitMaster/databaseConnector"
+	"testing"
+)
+
+// 📌 **Тест: миграция схемы объединяет роли с одинаковыми именами перед созданием индекса**
+func TestEnsureSchemaMergesDuplicateRoles(t *testing.T) {
+	db := databaseConnector.ConnectBD()
+	defer db.Close()
+	defer db.Exec("DELETE FROM roles WHERE name = 'duplicate-role'")
+
+	// Воспроизводим старую базу: индекса ещё нет, имя роли повторяется
+	if _, err := db.Exec("DROP INDEX IF EXISTS roles_name_idx"); err != nil {
+		t.Fatalf("❌ Ошибка удаления индекса: %v", err)
+	}
+	var keepID, dupID int
+	db.QueryRow("INSERT INTO roles (name) VALUES ('duplicate-role') RETURNING id").Scan(&keepID)
+	db.QueryRow("INSERT INTO roles (name) VALUES ('duplicate-role') RETURNING id").Scan(&dupID)
+	if _, err := db.Exec("INSERT INTO role_permissions (role_id, permission) VALUES ($1, 'audit:read')", dupID); err != nil {
+		t.Fatalf("❌ Ошибка вставки разрешения: %v", err)
+	}
+
+	if err := databaseConnector.EnsureSchema(db); err != nil {
+		t.Fatalf("❌ Миграция не прошла на базе с повторяющимися ролями: %v", err)
+	}
+
+	var roles int
+	db.QueryRow("SELECT COUNT(*) FROM roles WHERE name = 'duplicate-role'").Scan(&roles)
+	if roles != 1 {
+		t.Errorf("❌ Ожидалась одна роль, найдено %d", roles)
+	}
+	var kept bool
+	db.QueryRow("SELECT EXISTS (SELECT 1 FROM role_permissions WHERE role_id = $1 AND permission = 'audit:read')", keepID).Scan(&kept)
+	if !kept {
+		t.Error("❌ Разрешение дубликата не перенесено на оставшуюся роль")
+	}
+}
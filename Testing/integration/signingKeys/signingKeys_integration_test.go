@@ -0,0 +1,60 @@
+package integration_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/databaseConnector"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// activeKeyID — kid, которым сейчас подписываются токены (первый ключ JWKS)
+func activeKeyID(t *testing.T) string {
+	recorder := httptest.NewRecorder()
+	auth.JWKS(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	var set auth.JWKSet
+	if err := json.NewDecoder(recorder.Body).Decode(&set); err != nil || len(set.Keys) == 0 {
+		t.Fatalf("❌ Некорректный JWKS: %v %s", err, recorder.Body)
+	}
+	return set.Keys[0].KeyID
+}
+
+// 📌 **Тест: после смены SECRET_KEY сервер запускается с новым ключом, старый выводится**
+func TestKeyRotationAfterSecretChange(t *testing.T) {
+	db := databaseConnector.ConnectBD()
+	defer db.Close()
+	if _, err := db.Exec("DELETE FROM signing_keys"); err != nil {
+		t.Fatalf("❌ Ошибка очистки ключей: %v", err)
+	}
+
+	t.Setenv("JWT_SIGNING_ALG", auth.AlgEdDSA)
+	t.Setenv("SECRET_KEY", "old-secret-for-signing-keys")
+	if err := auth.StartKeyRotation(db); err != nil {
+		t.Fatalf("❌ Ошибка первого запуска ротации: %v", err)
+	}
+	oldKID := activeKeyID(t)
+
+	t.Setenv("SECRET_KEY", "new-secret-for-signing-keys")
+	if err := auth.StartKeyRotation(db); err != nil {
+		t.Fatalf("❌ После смены SECRET_KEY ротация должна запускаться: %v", err)
+	}
+	newKID := activeKeyID(t)
+	if newKID == oldKID {
+		t.Errorf("❌ Ожидался новый активный ключ вместо %s", oldKID)
+	}
+
+	var retired bool
+	db.QueryRow(`SELECT retired_at IS NOT NULL FROM signing_keys WHERE kid = $1`, oldKID).Scan(&retired)
+	if !retired {
+		t.Errorf("❌ Нерасшифровываемый ключ %s должен быть выведен", oldKID)
+	}
+
+	token, _, err := auth.IssueToken(1, 1, "user@example.com", auth.RoleUser, false)
+	if err != nil {
+		t.Fatalf("❌ Ошибка выпуска токена: %v", err)
+	}
+	if _, err := auth.ParseToken(token); err != nil {
+		t.Errorf("❌ Токен нового ключа не проверяется: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package integration_test
+
+import (
+	"HabitMaster/preferences"
+	"testing"
+)
+
+// 📌 **Тест: рассылка не уходит только тем, кто отписался от product_updates**
+func TestFilterRecipientsByProductUpdates(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	createTestUser(t, "subscribed@example.com", "user")
+	optedOut := createTestUser(t, "optedout@example.com", "user")
+	createTestUser(t, "default@example.com", "user")
+	testDB.Exec(`UPDATE users SET preferences = '{"notifications":{"emails":{"product_updates":true}}}' WHERE email = 'subscribed@example.com'`)
+	testDB.Exec(`UPDATE users SET preferences = '{"notifications":{"emails":{"product_updates":false}}}' WHERE user_id = $1`, optedOut)
+
+	recipients := []string{"Subscribed@Example.com", "optedout@example.com", "default@example.com", "stranger@example.com"}
+	allowed, err := preferences.FilterRecipients(testDB, recipients, preferences.EmailProductUpdates)
+	if err != nil {
+		t.Fatalf("❌ Ошибка фильтрации получателей: %v", err)
+	}
+	want := []string{"Subscribed@Example.com", "default@example.com", "stranger@example.com"}
+	if len(allowed) != len(want) {
+		t.Fatalf("❌ Ожидались адреса %v, получено %v", want, allowed)
+	}
+	for i := range want {
+		if allowed[i] != want[i] {
+			t.Errorf("❌ Ожидались адреса %v, получено %v", want, allowed)
+			break
+		}
+	}
+}
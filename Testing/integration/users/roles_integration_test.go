@@ -0,0 +1,101 @@
+package integration_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/handlers"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// createTestRole создаёт роль с разрешениями (удаляя прежнюю с тем же именем)
+func createTestRole(t *testing.T, name string, permissions ...string) {
+	testDB.Exec(`DELETE FROM roles WHERE name = $1`, name)
+	var roleID int
+	if err := testDB.QueryRow(`INSERT INTO roles (name) VALUES ($1) RETURNING id`, name).Scan(&roleID); err != nil {
+		t.Fatalf("❌ Ошибка создания роли %s: %v", name, err)
+	}
+	for _, p := range permissions {
+		if _, err := testDB.Exec(`INSERT INTO role_permissions (role_id, permission) VALUES ($1, $2)`, roleID, p); err != nil {
+			t.Fatalf("❌ Ошибка добавления разрешения: %v", err)
+		}
+	}
+}
+
+// createTestUser добавляет пользователя с ролью и возвращает его id
+func createTestUser(t *testing.T, email, role string) int {
+	var id int
+	err := testDB.QueryRow(`INSERT INTO users (name, email, password, role, created_at, updated_at)
+		VALUES ('Test User', $1, 'hashedpassword', $2, NOW(), NOW()) RETURNING user_id`, email, role).Scan(&id)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки тестового пользователя: %v", err)
+	}
+	return id
+}
+
+// changeRole вызывает PUT /api/users/{id}/role от имени пользователя с ролью actor
+func changeRole(actorID int, actor string, userID int, role string) int {
+	router := mux.NewRouter()
+	router.Handle("/api/users/{id}/role", handlers.ChangeUserRole(testDB))
+
+	body, _ := json.Marshal(map[string]string{"role": role})
+	req := httptest.NewRequest(http.MethodPut, "/api/users/"+strconv.Itoa(userID)+"/role", bytes.NewReader(body))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: actorID, Role: actor}))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+// 📌 **Тест: узкая роль не может выдать admin или роль шире своей**
+func TestChangeUserRoleRejectsEscalation(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	createTestRole(t, "test-support", auth.PermUsersRead, auth.PermUsersRoles)
+	createTestRole(t, "test-reader", auth.PermUsersRead)
+	createTestRole(t, "test-manager", auth.PermUsersRead, auth.PermRolesManage)
+	actorID := createTestUser(t, "support@example.com", "test-support")
+	userID := createTestUser(t, "user@example.com", auth.RoleUser)
+	adminID := createTestUser(t, "admin@example.com", auth.RoleAdmin)
+
+	if code := changeRole(actorID, "test-support", userID, auth.RoleAdmin); code != http.StatusForbidden {
+		t.Errorf("❌ Выдача admin должна отклоняться, получен статус %d", code)
+	}
+	if code := changeRole(actorID, "test-support", userID, "test-manager"); code != http.StatusForbidden {
+		t.Errorf("❌ Выдача роли шире своей должна отклоняться, получен статус %d", code)
+	}
+	if code := changeRole(actorID, "test-support", adminID, auth.RoleUser); code != http.StatusForbidden {
+		t.Errorf("❌ Понижение администратора должно отклоняться, получен статус %d", code)
+	}
+	if code := changeRole(actorID, "test-support", userID, "test-reader"); code != http.StatusOK {
+		t.Errorf("❌ Роль с подмножеством разрешений должна выдаваться, получен статус %d", code)
+	}
+	if code := changeRole(adminID, auth.RoleAdmin, userID, auth.RoleAdmin); code != http.StatusOK {
+		t.Errorf("❌ Администратор должен выдавать admin, получен статус %d", code)
+	}
+}
+
+// 📌 **Тест: пользователь с users:write не может создать администратора**
+func TestCreateUserRejectsEscalation(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	createTestRole(t, "test-writer", auth.PermUsersWrite)
+	body, _ := json.Marshal(map[string]string{
+		"name": "Mallory", "email": "mallory@example.com", "password": "Correct-Horse-42", "role": auth.RoleAdmin,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/users", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: 1, Role: "test-writer"}))
+	recorder := httptest.NewRecorder()
+	handlers.CreateUser(testDB).ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("❌ Ожидался статус 403, получен %d", recorder.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package integration_test
 
 import (
+	"HabitMaster/auth"
 	"HabitMaster/databaseConnector"
 	"HabitMaster/handlers"
 	"bytes"
@@ -8,6 +9,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 )
 
@@ -117,3 +119,100 @@ func TestDeleteUserManual(t *testing.T) {
 
 	t.Log("✅ Тест удаления пользователя успешно выполнен.")
 }
+
+// updateUser вызывает PUT /api/users от имени пользователя с ролью actor
+func updateUser(actorID int, actor string, payload map[string]interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPut, "/api/users", bytes.NewReader(body))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: actorID, Role: actor}))
+	recorder := httptest.NewRecorder()
+	handlers.UpdateUser(testDB).ServeHTTP(recorder, req)
+	return recorder
+}
+
+// 📌 **Тест изменения пользователя: имя меняется сразу, email — только после подтверждения**
+func TestUpdateUser(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	adminID := createTestUser(t, "admin@example.com", auth.RoleAdmin)
+	userID := createTestUser(t, "alice@example.com", auth.RoleUser)
+	createTestUser(t, "bob@example.com", auth.RoleUser)
+
+	if code := updateUser(adminID, auth.RoleAdmin, map[string]interface{}{"id": userID, "email": "BOB@example.com"}).Code; code != http.StatusConflict {
+		t.Errorf("❌ Для занятого email ожидался статус 409, получен %d", code)
+	}
+	if code := updateUser(adminID, auth.RoleAdmin, map[string]interface{}{"id": 999999, "name": "Ghost"}).Code; code != http.StatusNotFound {
+		t.Errorf("❌ Для несуществующего пользователя ожидался статус 404, получен %d", code)
+	}
+
+	recorder := updateUser(adminID, auth.RoleAdmin, map[string]interface{}{"id": userID, "name": "Alice Cooper", "email": " Alice.Cooper@Example.com "})
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("❌ Ожидался статус 202, получен %d: %s", recorder.Code, recorder.Body)
+	}
+	var name, email string
+	testDB.QueryRow(`SELECT name, email FROM users WHERE user_id = $1`, userID).Scan(&name, &email)
+	if name != "Alice Cooper" || email != "alice@example.com" {
+		t.Errorf("❌ Ожидались Alice Cooper и прежний email до подтверждения, получены %q и %q", name, email)
+	}
+	var pending string
+	testDB.QueryRow(`SELECT new_email FROM email_changes WHERE user_id = $1 AND confirmed_at IS NULL AND cancelled_at IS NULL`, userID).Scan(&pending)
+	if pending != "alice.cooper@example.com" {
+		t.Errorf("❌ Ожидался запрос смены на alice.cooper@example.com, получен %q", pending)
+	}
+}
+
+// 📌 **Тест: узкая роль не может менять администратора**
+func TestUpdateUserRejectsWiderTarget(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	createTestRole(t, "test-writer", auth.PermUsersWrite)
+	writerID := createTestUser(t, "writer@example.com", "test-writer")
+	adminID := createTestUser(t, "admin@example.com", auth.RoleAdmin)
+
+	recorder := updateUser(writerID, "test-writer", map[string]interface{}{"id": adminID, "email": "attacker@example.com"})
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("❌ Ожидался статус 403, получен %d", recorder.Code)
+	}
+	var changes int
+	testDB.QueryRow(`SELECT COUNT(*) FROM email_changes WHERE user_id = $1`, adminID).Scan(&changes)
+	if changes != 0 {
+		t.Errorf("❌ Смена email администратора не должна начинаться")
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/users?id="+strconv.Itoa(adminID), nil)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: writerID, Role: "test-writer"}))
+	deleted := httptest.NewRecorder()
+	handlers.DeleteUser(testDB).ServeHTTP(deleted, req)
+	if deleted.Code != http.StatusForbidden {
+		t.Errorf("❌ Удаление администратора должно отклоняться, получен статус %d", deleted.Code)
+	}
+}
+
+// 📌 **Тест удаления пользователя администратором: аккаунт и его привычки удаляются сразу**
+func TestDeleteUser(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB(t)
+
+	adminID := createTestUser(t, "admin@example.com", "admin")
+	userID := createTestUser(t, "victim@example.com", "user")
+	if _, err := testDB.Exec(`INSERT INTO habits (name, description, user_id, created_at, updated_at) VALUES ('Read', 'Daily', $1, NOW(), NOW())`, userID); err != nil {
+		t.Fatalf("❌ Ошибка вставки привычки: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/users?id="+strconv.Itoa(userID), nil)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: adminID, Role: auth.RoleAdmin}))
+	recorder := httptest.NewRecorder()
+	handlers.DeleteUser(testDB).ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("❌ Ожидался статус 200 OK, получен %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var users, habits int
+	testDB.QueryRow(`SELECT COUNT(*) FROM users WHERE user_id = $1`, userID).Scan(&users)
+	testDB.QueryRow(`SELECT COUNT(*) FROM habits WHERE user_id = $1`, userID).Scan(&habits)
+	if users != 0 || habits != 0 {
+		t.Errorf("❌ Пользователь и привычки должны удаляться, осталось %d и %d", users, habits)
+	}
+}
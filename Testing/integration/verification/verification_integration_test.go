@@ -0,0 +1,133 @@
+package integration_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/databaseConnector"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var testDB *sql.DB
+
+const testEmail = "verify@example.com"
+
+// countingSender считает отправленные письма
+type countingSender struct{ sent int32 }
+
+func (s *countingSender) SendEmail(to []string, subject, body string) error {
+	atomic.AddInt32(&s.sent, 1)
+	return nil
+}
+
+func (s *countingSender) SendEmailWithAttachment(to []string, subject, body, fileName string, fileData []byte) error {
+	atomic.AddInt32(&s.sent, 1)
+	return nil
+}
+
+func (s *countingSender) SendMultipartEmail(to []string, subject, htmlBody, textBody string) error {
+	atomic.AddInt32(&s.sent, 1)
+	return nil
+}
+
+func (s *countingSender) SendSensitiveEmail(to []string, subject, htmlBody, textBody string) error {
+	atomic.AddInt32(&s.sent, 1)
+	return nil
+}
+
+// setupTestDB добавляет неподтверждённого пользователя с кодом 123456
+func setupTestDB(t *testing.T, sentAgo string) {
+	testDB = databaseConnector.ConnectBD()
+	if _, err := testDB.Exec("DELETE FROM users WHERE email = $1", testEmail); err != nil {
+		t.Fatalf("❌ Ошибка очистки базы перед тестами: %v", err)
+	}
+	_, err := testDB.Exec(`INSERT INTO users (name, email, password, role, is_verified, verification_code,
+			verification_code_expires_at, verification_attempts, verification_sent_at, created_at, updated_at)
+		VALUES ('Verify', $1, 'hashedpassword', 'user', FALSE, '123456', NOW() + INTERVAL '15 minutes', 0,
+			NOW() - $2::INTERVAL, NOW(), NOW())`, testEmail, sentAgo)
+	if err != nil {
+		t.Fatalf("❌ Ошибка вставки тестового пользователя: %v", err)
+	}
+}
+
+func teardownTestDB(t *testing.T) {
+	if testDB != nil {
+		testDB.Exec("DELETE FROM users WHERE email = $1", testEmail)
+		testDB.Close()
+	}
+}
+
+// post вызывает обработчик с JSON-телом
+func post(handler http.HandlerFunc, payload map[string]string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	return recorder
+}
+
+// 📌 **Тест: параллельные неверные коды не обходят ограничение числа попыток**
+func TestVerifyCodeAttemptCapUnderConcurrency(t *testing.T) {
+	setupTestDB(t, "1 hour")
+	defer teardownTestDB(t)
+
+	var wg sync.WaitGroup
+	var rejected int32
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if post(auth.VerifyCode, map[string]string{"email": testEmail, "code": "000000"}).Code == http.StatusBadRequest {
+				atomic.AddInt32(&rejected, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var attempts int
+	testDB.QueryRow(`SELECT verification_attempts FROM users WHERE email = $1`, testEmail).Scan(&attempts)
+	if attempts != 5 || rejected != 5 {
+		t.Errorf("❌ Ожидалось 5 проверенных попыток, счётчик %d, проверено %d", attempts, rejected)
+	}
+
+	// После исчерпания попыток не проходит даже верный код
+	if code := post(auth.VerifyCode, map[string]string{"email": testEmail, "code": "123456"}).Code; code != http.StatusTooManyRequests {
+		t.Errorf("❌ Ожидался статус 429, получен %d", code)
+	}
+}
+
+// 📌 **Тест: во время паузы ответ такой же, как для неизвестного адреса, и код не отправляется**
+func TestResendVerificationCooldown(t *testing.T) {
+	setupTestDB(t, "0 seconds")
+	defer teardownTestDB(t)
+
+	sender := &countingSender{}
+	auth.SetEmailSender(sender)
+
+	during := post(auth.ResendVerification, map[string]string{"email": testEmail})
+	unknown := post(auth.ResendVerification, map[string]string{"email": "nobody@example.com"})
+	if during.Code != http.StatusOK || during.Code != unknown.Code || during.Body.String() != unknown.Body.String() {
+		t.Errorf("❌ Ответы различаются: %d %q и %d %q", during.Code, during.Body, unknown.Code, unknown.Body)
+	}
+	if sender.sent != 0 {
+		t.Errorf("❌ Во время паузы код не должен отправляться, отправлено %d", sender.sent)
+	}
+
+	testDB.Exec(`UPDATE users SET verification_sent_at = NOW() - INTERVAL '1 hour' WHERE email = $1`, testEmail)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			post(auth.ResendVerification, map[string]string{"email": testEmail})
+		}()
+	}
+	wg.Wait()
+	if sender.sent != 1 {
+		t.Errorf("❌ После паузы должен уйти ровно один код, отправлено %d", sender.sent)
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"net/http"
+	"testing"
+)
+
+// Тест выбора области доступа по методу и пути запроса
+func TestRequiredScope(t *testing.T) {
+	cases := []struct {
+		method, path string
+		scope        string
+		scoped       bool
+	}{
+		{http.MethodGet, "/api/habits", "habits:read", true},
+		{http.MethodPost, "/api/habits", "habits:write", true},
+		{http.MethodGet, "/api/habits/3/history", "habits:read", true},
+		{http.MethodDelete, "/api/goals/deleteAll", "goals:write", true},
+		{http.MethodGet, "/api/okrs", "goals:read", true},
+		{http.MethodGet, "/api/habitsX", "", false},
+		{http.MethodPost, "/api/tokens", "", false},
+		{http.MethodGet, "/api/sessions", "", false},
+	}
+	for _, c := range cases {
+		scope, scoped := auth.RequiredScope(c.method, c.path)
+		if scope != c.scope || scoped != c.scoped {
+			t.Errorf("%s %s: ожидалось (%q, %v), получено (%q, %v)", c.method, c.path, c.scope, c.scoped, scope, scoped)
+		}
+	}
+}
+
+// Тест проверки областей доступа при создании токена
+func TestValidateScopes(t *testing.T) {
+	if err := auth.ValidateScopes([]string{"habits:read", "goals:write"}); err != nil {
+		t.Errorf("Допустимые области отклонены: %v", err)
+	}
+	for _, scopes := range [][]string{nil, {"admin"}, {"habits:read", "habits:read"}} {
+		if err := auth.ValidateScopes(scopes); err == nil {
+			t.Errorf("Области %v должны отклоняться", scopes)
+		}
+	}
+}
+
+// Тест: сессия имеет все области, токен — только выданные
+func TestPrincipalHasScope(t *testing.T) {
+	session := &auth.Principal{UserID: 1}
+	if !session.HasScope("goals:write") {
+		t.Errorf("Сессия должна иметь доступ ко всем областям")
+	}
+	token := &auth.Principal{UserID: 1, TokenID: 5, Scopes: []string{"habits:read"}}
+	if !token.HasScope("habits:read") || token.HasScope("habits:write") {
+		t.Errorf("Токен должен иметь только выданные области")
+	}
+}
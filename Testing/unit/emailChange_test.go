@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"testing"
+)
+
+// Тест проверки и нормализации адреса при смене email
+func TestNormalizeEmail(t *testing.T) {
+	valid := map[string]string{
+		"alice@example.com":       "alice@example.com",
+		"  Alice@Example.COM  ":   "alice@example.com",
+		"first.last+tag@mail.org": "first.last+tag@mail.org",
+	}
+	for input, want := range valid {
+		got, ok := auth.NormalizeEmail(input)
+		if !ok || got != want {
+			t.Errorf("Для %q ожидалось %q, получено %q (%v)", input, want, got, ok)
+		}
+	}
+
+	for _, input := range []string{"", "   ", "not-an-email", "alice@", "Alice <alice@example.com>", "a@example.com, b@example.com"} {
+		if _, ok := auth.NormalizeEmail(input); ok {
+			t.Errorf("Адрес %q должен отклоняться", input)
+		}
+	}
+}
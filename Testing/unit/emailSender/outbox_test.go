@@ -0,0 +1,39 @@
+package emailSender_test
+
+import (
+	"HabitMaster/emailSender"
+	"testing"
+	"time"
+)
+
+// Тест экспоненциальной задержки между попытками отправки
+func TestBackoff(t *testing.T) {
+	base, max := 30*time.Second, time.Hour
+	cases := map[int]time.Duration{
+		0:   30 * time.Second,
+		1:   30 * time.Second,
+		2:   time.Minute,
+		3:   2 * time.Minute,
+		7:   32 * time.Minute,
+		8:   time.Hour,
+		100: time.Hour,
+	}
+	for attempts, expected := range cases {
+		if got := emailSender.Backoff(attempts, base, max); got != expected {
+			t.Errorf("После %d попыток ожидалась задержка %s, получена %s", attempts, expected, got)
+		}
+	}
+}
+
+// Тест настроек очереди по умолчанию и из окружения
+func TestOutboxConfigFromEnv(t *testing.T) {
+	t.Setenv("EMAIL_OUTBOX_WORKERS", "")
+	t.Setenv("EMAIL_MAX_ATTEMPTS", "3")
+	t.Setenv("EMAIL_RETRY_BASE", "oops")
+
+	config := emailSender.OutboxConfigFromEnv()
+	if config.Workers != 4 || config.MaxAttempts != 3 || config.BackoffBase != 30*time.Second ||
+		config.Retention != 30*24*time.Hour {
+		t.Errorf("Некорректные настройки очереди: %+v", config)
+	}
+}
@@ -0,0 +1,109 @@
+package emailTemplates_test
+
+import (
+	"HabitMaster/emailTemplates"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Тест: каждый шаблон собирается на каждом языке с данными-примерами
+func TestAllTemplatesRender(t *testing.T) {
+	for _, name := range emailTemplates.Names() {
+		data, ok := emailTemplates.Sample(name)
+		if !ok {
+			t.Errorf("Для шаблона %s нет данных-примера", name)
+			continue
+		}
+		for _, locale := range emailTemplates.Locales() {
+			message, err := emailTemplates.Render(name, locale, data)
+			if err != nil {
+				t.Errorf("Ошибка сборки шаблона %s (%s): %v", name, locale, err)
+				continue
+			}
+			if message.Subject == "" || strings.Contains(message.Subject, "\n") {
+				t.Errorf("Шаблон %s (%s): некорректная тема %q", name, locale, message.Subject)
+			}
+			if !strings.Contains(message.HTML, "<html") || strings.TrimSpace(message.Text) == "" {
+				t.Errorf("Шаблон %s (%s): нет HTML или текстовой версии", name, locale)
+			}
+			if strings.Contains(message.Text, "<") {
+				t.Errorf("Шаблон %s (%s): в текстовой версии разметка: %q", name, locale, message.Text)
+			}
+		}
+	}
+}
+
+// Тест: без обязательного значения шаблон не собирается
+func TestRenderRequiresData(t *testing.T) {
+	if _, err := emailTemplates.Render(emailTemplates.Verification, "en", emailTemplates.Data{}); err == nil {
+		t.Errorf("Шаблон без кода подтверждения не должен собираться")
+	}
+	if _, err := emailTemplates.Render("unknown", "en", emailTemplates.Data{}); err == nil {
+		t.Errorf("Неизвестный шаблон должен возвращать ошибку")
+	}
+}
+
+// Тест экранирования: значения не превращаются в разметку, опасные ссылки вырезаются
+func TestRenderEscapesValues(t *testing.T) {
+	data, _ := emailTemplates.Sample(emailTemplates.NewDevice)
+	values := emailTemplates.Data{}
+	for k, v := range data {
+		values[k] = v
+	}
+	values["Device"] = `<script>alert("x")</script>`
+	values["Link"] = "javascript:alert(1)"
+
+	message, err := emailTemplates.Render(emailTemplates.NewDevice, "en", values)
+	if err != nil {
+		t.Fatalf("Ошибка сборки шаблона: %v", err)
+	}
+	if strings.Contains(message.HTML, "<script>") {
+		t.Errorf("Значение не экранировано в HTML: %s", message.HTML)
+	}
+	if strings.Contains(message.HTML, "javascript:") {
+		t.Errorf("Опасная ссылка попала в HTML: %s", message.HTML)
+	}
+}
+
+// Тест: шаблон на неизвестном языке собирается на языке по умолчанию
+func TestRenderFallsBackToDefaultLocale(t *testing.T) {
+	data, _ := emailTemplates.Sample(emailTemplates.PasswordReset)
+	fallback, err := emailTemplates.Render(emailTemplates.PasswordReset, "de", data)
+	if err != nil {
+		t.Fatalf("Ошибка сборки шаблона: %v", err)
+	}
+	english, _ := emailTemplates.Render(emailTemplates.PasswordReset, emailTemplates.DefaultLocale, data)
+	if fallback != english {
+		t.Errorf("Ожидалось письмо на языке по умолчанию, получено %+v", fallback)
+	}
+
+	russian, _ := emailTemplates.Render(emailTemplates.PasswordReset, "ru", data)
+	if russian.Subject == english.Subject {
+		t.Errorf("Тема русского письма совпадает с английской: %q", russian.Subject)
+	}
+}
+
+// Тест записи длительности словами с учётом языка
+func TestFormatDuration(t *testing.T) {
+	cases := []struct {
+		locale   string
+		d        time.Duration
+		expected string
+	}{
+		{"en", 15 * time.Minute, "15 minutes"},
+		{"en", time.Hour, "1 hour"},
+		{"en", 7 * 24 * time.Hour, "7 days"},
+		{"en", 90 * time.Minute, "90 minutes"},
+		{"ru", time.Minute, "1 минуту"},
+		{"ru", 2 * time.Hour, "2 часа"},
+		{"ru", 5 * 24 * time.Hour, "5 дней"},
+		{"ru", 11 * time.Minute, "11 минут"},
+		{"ru", 21 * 24 * time.Hour, "21 день"},
+	}
+	for _, c := range cases {
+		if got := emailTemplates.FormatDuration(c.locale, c.d); got != c.expected {
+			t.Errorf("FormatDuration(%s, %v) = %q, ожидалось %q", c.locale, c.d, got, c.expected)
+		}
+	}
+}
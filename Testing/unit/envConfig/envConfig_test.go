@@ -0,0 +1,29 @@
+package envConfig_test
+
+import (
+	"HabitMaster/envConfig"
+	"testing"
+	"time"
+)
+
+// Тест чтения длительности: некорректные и неположительные значения заменяются значением по умолчанию
+func TestDuration(t *testing.T) {
+	cases := map[string]time.Duration{"": time.Hour, "15m": 15 * time.Minute, "soon": time.Hour, "-5m": time.Hour, "0s": time.Hour}
+	for value, want := range cases {
+		t.Setenv("TEST_ENV_DURATION", value)
+		if got := envConfig.Duration("TEST_ENV_DURATION", time.Hour); got != want {
+			t.Errorf("Для %q ожидалось %v, получено %v", value, want, got)
+		}
+	}
+}
+
+// Тест чтения целого: некорректные и неположительные значения заменяются значением по умолчанию
+func TestInt(t *testing.T) {
+	cases := map[string]int{"": 5, "8": 8, "eight": 5, "0": 5, "-3": 5}
+	for value, want := range cases {
+		t.Setenv("TEST_ENV_INT", value)
+		if got := envConfig.Int("TEST_ENV_INT", 5); got != want {
+			t.Errorf("Для %q ожидалось %d, получено %d", value, want, got)
+		}
+	}
+}
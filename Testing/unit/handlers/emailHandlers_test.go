@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"HabitMaster/handlers"
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// failingSender — отправитель, который не должен вызываться
+type failingSender struct{ t *testing.T }
+
+func (s failingSender) SendEmail(to []string, subject, body string) error {
+	s.t.Error("Письмо не должно было отправляться")
+	return nil
+}
+
+func (s failingSender) SendEmailWithAttachment(to []string, subject, body, fileName string, file []byte) error {
+	s.t.Error("Письмо не должно было отправляться")
+	return nil
+}
+
+func (s failingSender) SendMultipartEmail(to []string, subject, htmlBody, textBody string) error {
+	s.t.Error("Письмо не должно было отправляться")
+	return nil
+}
+
+func (s failingSender) SendSensitiveEmail(to []string, subject, htmlBody, textBody string) error {
+	s.t.Error("Письмо не должно было отправляться")
+	return nil
+}
+
+// Тест отклонения некорректного списка получателей до отправки и обращения к БД
+func TestSendMassEmailRejectsInvalidRecipients(t *testing.T) {
+	// Превышение лимита получателей
+	many := make([]string, 501)
+	for i := range many {
+		many[i] = fmt.Sprintf("user%d@example.com", i)
+	}
+	cases := []string{"", " , ,", "not-an-email", "ok@example.com, broken", strings.Join(many, ",")}
+
+	for _, recipients := range cases {
+		var buf bytes.Buffer
+		form := multipart.NewWriter(&buf)
+		form.WriteField("recipients", recipients)
+		form.WriteField("subject", "Новости")
+		form.WriteField("body", "Текст")
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/send-mass-email", &buf)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		recorder := httptest.NewRecorder()
+		handlers.SendMassEmailHandler(nil, failingSender{t}).ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Для получателей %.40q ожидался статус 400, получен %d", recipients, recorder.Code)
+		}
+	}
+}
+
+// Тест отклонения неизвестного статуса в списке очереди писем до обращения к БД
+func TestGetEmailOutboxRejectsInvalidStatus(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/email-outbox?status=lost", nil)
+	recorder := httptest.NewRecorder()
+	handlers.GetEmailOutbox(nil).ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Ожидался статус 400, получен %d", recorder.Code)
+	}
+}
+
+// Тест предпросмотра шаблона письма: неизвестный шаблон, язык и формат отклоняются
+func TestPreviewEmailTemplate(t *testing.T) {
+	cases := map[string]int{
+		"/api/admin/email-templates/password_reset/preview":             http.StatusOK,
+		"/api/admin/email-templates/password_reset/preview?locale=ru":   http.StatusOK,
+		"/api/admin/email-templates/password_reset/preview?format=text": http.StatusOK,
+		"/api/admin/email-templates/missing/preview":                    http.StatusNotFound,
+		"/api/admin/email-templates/password_reset/preview?locale=xx":   http.StatusBadRequest,
+		"/api/admin/email-templates/password_reset/preview?format=pdf":  http.StatusBadRequest,
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/admin/email-templates/{name}/preview", handlers.PreviewEmailTemplate())
+
+	for url, expected := range cases {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+		if recorder.Code != expected {
+			t.Errorf("Для %s ожидался статус %d, получен %d", url, expected, recorder.Code)
+		}
+	}
+}
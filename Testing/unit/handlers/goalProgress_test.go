@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"HabitMaster/handlers"
+	"testing"
+	"time"
+)
+
+// Тест прогноза для цели со снижением веса
+func TestComputeGoalProgressOnTrack(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	metric := &handlers.GoalMetric{Unit: "kg", Start: 90, Target: 80, Direction: handlers.MetricDecrease}
+	entries := []handlers.ProgressEntry{
+		{Value: 88, RecordedAt: created.AddDate(0, 0, 10)},
+		{Value: 86, RecordedAt: created.AddDate(0, 0, 20)},
+	}
+	now := created.AddDate(0, 0, 21)
+
+	handlers.ComputeGoalProgress(metric, created, "2026-03-31", entries, now)
+
+	if metric.Current != 86 {
+		t.Errorf("Ожидалось текущее значение 86, получено: %v", metric.Current)
+	}
+	if metric.PercentComplete != 40 {
+		t.Errorf("Ожидалось 40%% выполнения, получено: %v", metric.PercentComplete)
+	}
+	// 2 кг за 10 дней, осталось 6 кг → ещё 30 дней
+	if metric.ProjectedCompletion == nil || *metric.ProjectedCompletion != "2026-02-20T00:00:00Z" {
+		t.Errorf("Некорректный прогноз: %v", metric.ProjectedCompletion)
+	}
+	if metric.OnTrack == nil || !*metric.OnTrack {
+		t.Errorf("Ожидалось, что цель идёт по плану")
+	}
+}
+
+// Тест: движение в обратную сторону не даёт прогноза
+func TestComputeGoalProgressWrongDirection(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	metric := &handlers.GoalMetric{Unit: "pages", Start: 0, Target: 300, Direction: handlers.MetricIncrease}
+	entries := []handlers.ProgressEntry{
+		{Value: 50, RecordedAt: created.AddDate(0, 0, 5)},
+		{Value: 40, RecordedAt: created.AddDate(0, 0, 6)},
+	}
+
+	handlers.ComputeGoalProgress(metric, created, "2026-01-31", entries, created.AddDate(0, 0, 7))
+
+	if metric.ProjectedCompletion != nil {
+		t.Errorf("Прогноз не ожидался, получено: %v", *metric.ProjectedCompletion)
+	}
+	if metric.OnTrack == nil || *metric.OnTrack {
+		t.Errorf("Ожидалось, что цель отстаёт от плана")
+	}
+}
+
+// Тест проверки метрики
+func TestValidateMetric(t *testing.T) {
+	metric := &handlers.GoalMetric{Unit: "USD", Start: 0, Target: 1000}
+	if err := handlers.ValidateMetric(metric); err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+	if metric.Direction != handlers.MetricIncrease {
+		t.Errorf("Ожидалось направление increase, получено: %s", metric.Direction)
+	}
+
+	invalid := &handlers.GoalMetric{Unit: "kg", Start: 80, Target: 90, Direction: handlers.MetricDecrease}
+	if err := handlers.ValidateMetric(invalid); err == nil {
+		t.Errorf("Ожидалась ошибка для несогласованного направления")
+	}
+}
@@ -0,0 +1,47 @@
+package handlers_test
+
+import (
+	"HabitMaster/handlers"
+	"testing"
+	"time"
+)
+
+// Тест взвешенной оценки объектива
+func TestRollupScore(t *testing.T) {
+	score := 0.5
+	keyResults := []handlers.KeyResult{
+		{Goal: handlers.Goal{Weight: 1, Score: &score}, Score: 0.5},
+		{Goal: handlers.Goal{Weight: 3}, Score: 0.9},
+	}
+
+	if got := handlers.RollupScore(keyResults); got != 0.8 {
+		t.Errorf("Ожидалась оценка 0.8, получено: %v", got)
+	}
+	if got := handlers.RollupScore(nil); got != 0 {
+		t.Errorf("Ожидалась оценка 0 без ключевых результатов, получено: %v", got)
+	}
+}
+
+// Тест оценки ключевого результата по метрике
+func TestKeyResultScoreFromMetric(t *testing.T) {
+	goal := handlers.Goal{Metric: &handlers.GoalMetric{PercentComplete: 65}}
+	if got := handlers.KeyResultScore(goal); got != 0.65 {
+		t.Errorf("Ожидалась оценка 0.65, получено: %v", got)
+	}
+
+	manual := 0.3
+	goal.Score = &manual
+	if got := handlers.KeyResultScore(goal); got != 0.3 {
+		t.Errorf("Заданная вручную оценка должна иметь приоритет, получено: %v", got)
+	}
+}
+
+// Тест определения квартала
+func TestCurrentQuarter(t *testing.T) {
+	if got := handlers.CurrentQuarter(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)); got != "2026-Q4" {
+		t.Errorf("Ожидался 2026-Q4, получено: %s", got)
+	}
+	if got := handlers.CurrentQuarter(time.Date(2027, 3, 31, 0, 0, 0, 0, time.UTC)); got != "2027-Q1" {
+		t.Errorf("Ожидался 2027-Q1, получено: %s", got)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers_test
+
+import (
+	"HabitMaster/handlers"
+	"testing"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// Тест сравнения двух версий цели
+func TestDiffSnapshots(t *testing.T) {
+	fields := []string{"name", "description", "deadline"}
+	prev := map[string]*string{
+		"name":        strPtr("Read books"),
+		"description": strPtr("12 books a year"),
+		"deadline":    nil,
+	}
+	next := map[string]*string{
+		"name":        strPtr("Read books"),
+		"description": strPtr("24 books a year"),
+		"deadline":    strPtr("2026-12-31"),
+	}
+
+	changes := handlers.DiffSnapshots(fields, prev, next)
+	if len(changes) != 2 {
+		t.Fatalf("Ожидалось 2 изменения, получено: %d", len(changes))
+	}
+
+	if changes[0].Field != "description" || *changes[0].Old != "12 books a year" || *changes[0].New != "24 books a year" {
+		t.Errorf("Некорректное изменение описания: %+v", changes[0])
+	}
+	if changes[1].Field != "deadline" || changes[1].Old != nil || *changes[1].New != "2026-12-31" {
+		t.Errorf("Некорректное изменение дедлайна: %+v", changes[1])
+	}
+}
+
+// Тест: одинаковые версии не дают изменений
+func TestDiffSnapshotsNoChanges(t *testing.T) {
+	fields := []string{"name", "description"}
+	snapshot := map[string]*string{"name": strPtr("Run"), "description": nil}
+
+	if changes := handlers.DiffSnapshots(fields, snapshot, snapshot); len(changes) != 0 {
+		t.Errorf("Ожидалось отсутствие изменений, получено: %+v", changes)
+	}
+}
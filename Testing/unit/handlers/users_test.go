@@ -0,0 +1,75 @@
+package handlers_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/handlers"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// Тест отклонения некорректных параметров списка пользователей до обращения к БД
+func TestGetUsersRejectsInvalidParams(t *testing.T) {
+	for _, query := range []string{"sort=password", "verified=maybe"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/get-users?"+query, nil)
+		recorder := httptest.NewRecorder()
+		handlers.GetUsers(nil).ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Для %q ожидался статус 400, получен %d", query, recorder.Code)
+		}
+	}
+}
+
+// asAdmin добавляет в запрос администратора с указанным id
+func asAdmin(req *http.Request, userID int) *http.Request {
+	return req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: userID, Role: auth.RoleAdmin}))
+}
+
+// Тест запрета удалить собственный аккаунт через админ-панель (до обращения к БД)
+func TestDeleteUserRejectsSelf(t *testing.T) {
+	req := asAdmin(httptest.NewRequest(http.MethodDelete, "/api/users?id=7", nil), 7)
+	recorder := httptest.NewRecorder()
+	handlers.DeleteUser(nil).ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Ожидался статус 400, получен %d", recorder.Code)
+	}
+}
+
+// Тест запрета менять собственную роль (до обращения к БД)
+func TestChangeUserRoleRejectsSelf(t *testing.T) {
+	router := mux.NewRouter()
+	router.Handle("/api/users/{id}/role", handlers.ChangeUserRole(nil))
+
+	req := asAdmin(httptest.NewRequest(http.MethodPut, "/api/users/7/role", strings.NewReader(`{"role":"user"}`)), 7)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Ожидался статус 400, получен %d", recorder.Code)
+	}
+}
+
+// Тест отклонения некорректных данных при изменении пользователя до обращения к БД
+func TestUpdateUserRejectsInvalidInput(t *testing.T) {
+	bodies := []string{
+		`{"name":"Alice"}`,
+		`{"id":7,"name":"   "}`,
+		`{"id":7,"email":""}`,
+		`{"id":7,"email":"not-an-email"}`,
+		`{"id":7,"email":"Alice <alice@example.com>"}`,
+	}
+	for _, body := range bodies {
+		req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		handlers.UpdateUser(nil).ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Для %s ожидался статус 400, получен %d", body, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Тест разбора режима регистрации; неизвестное значение закрывает регистрацию
+func TestParseRegistrationMode(t *testing.T) {
+	cases := map[string]string{
+		"":        auth.RegistrationOpen,
+		"open":    auth.RegistrationOpen,
+		" Invite": auth.RegistrationInvite,
+		"closed":  auth.RegistrationClosed,
+		"invites": auth.RegistrationClosed,
+	}
+	for value, want := range cases {
+		mode, err := auth.ParseRegistrationMode(value)
+		if mode != want {
+			t.Errorf("Для %q ожидался режим %q, получен %q", value, want, mode)
+		}
+		if (err != nil) != (value == "invites") {
+			t.Errorf("Для %q неожиданная ошибка: %v", value, err)
+		}
+	}
+}
+
+// Тест отказа в регистрации без приглашения до обращения к БД
+func TestRegisterRespectsRegistrationMode(t *testing.T) {
+	body := `{"name":"Test","email":"test@example.com","password":"secret123"}`
+	for _, mode := range []string{auth.RegistrationInvite, auth.RegistrationClosed} {
+		t.Setenv("REGISTRATION_MODE", mode)
+		req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		auth.Register(recorder, req)
+
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("В режиме %s ожидался статус 403, получен %d", mode, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"testing"
+)
+
+// Тест выпуска и проверки токена с user_id
+func TestIssueAndParseToken(t *testing.T) {
+	t.Setenv("SECRET_KEY", "test-secret")
+
+	token, expiresAt, err := auth.IssueToken(42, 7, "user@example.com", "admin", true)
+	if err != nil {
+		t.Fatalf("Ошибка выпуска токена: %v", err)
+	}
+	if expiresAt.IsZero() {
+		t.Errorf("Ожидалось время истечения токена")
+	}
+
+	claims, err := auth.ParseToken(token)
+	if err != nil {
+		t.Fatalf("Ошибка проверки токена: %v", err)
+	}
+	if claims.UserID != 42 || claims.SessionID != 7 || claims.Email != "user@example.com" || claims.Role != "admin" {
+		t.Errorf("Некорректные данные токена: %+v", claims)
+	}
+}
+
+// Тест: токен, подписанный другим секретом, отклоняется
+func TestParseTokenRejectsForeignSecret(t *testing.T) {
+	t.Setenv("SECRET_KEY", "first-secret")
+	token, _, err := auth.IssueToken(1, 1, "user@example.com", "user", false)
+	if err != nil {
+		t.Fatalf("Ошибка выпуска токена: %v", err)
+	}
+
+	t.Setenv("SECRET_KEY", "second-secret")
+	if _, err := auth.ParseToken(token); err == nil {
+		t.Errorf("Токен с чужой подписью не должен проходить проверку")
+	}
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// testClaims — данные токена для проверок набора ключей
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+// Тест подписи и проверки токенов ключами RS256 и EdDSA с kid в заголовке
+func TestKeyringSignAndVerify(t *testing.T) {
+	for _, alg := range []string{auth.AlgRS256, auth.AlgEdDSA} {
+		key, err := auth.GenerateSigningKey(alg)
+		if err != nil {
+			t.Fatalf("Ошибка создания ключа %s: %v", alg, err)
+		}
+		keys := auth.NewKeyring(key)
+
+		token, err := keys.Sign(testClaims())
+		if err != nil {
+			t.Fatalf("Ошибка подписи %s: %v", alg, err)
+		}
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+		if err != nil {
+			t.Fatalf("Ошибка разбора токена: %v", err)
+		}
+		if parsed.Header["kid"] != key.ID || parsed.Header["alg"] != alg {
+			t.Errorf("Ожидались kid=%s и alg=%s, получен заголовок %v", key.ID, alg, parsed.Header)
+		}
+		if err := keys.Verify(token, jwt.MapClaims{}); err != nil {
+			t.Errorf("Токен %s не прошёл проверку: %v", alg, err)
+		}
+	}
+}
+
+// Тест: после ротации токены старого ключа проверяются, пока ключ не удалён
+func TestKeyringVerifiesRetiredKeys(t *testing.T) {
+	old, _ := auth.GenerateSigningKey(auth.AlgEdDSA)
+	token, err := auth.NewKeyring(old).Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Ошибка подписи: %v", err)
+	}
+
+	next, _ := auth.GenerateSigningKey(auth.AlgRS256)
+	if err := auth.NewKeyring(next, old).Verify(token, jwt.MapClaims{}); err != nil {
+		t.Errorf("Токен выведенного ключа должен проверяться: %v", err)
+	}
+	if err := auth.NewKeyring(next).Verify(token, jwt.MapClaims{}); err == nil {
+		t.Errorf("Токен с неизвестным kid не должен проходить проверку")
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	old.ExpiresAt = &expired
+	if err := auth.NewKeyring(next, old).Verify(token, jwt.MapClaims{}); err == nil {
+		t.Errorf("Токен удалённого ключа не должен проходить проверку")
+	}
+}
+
+// Тест: токены HS256 без kid, выпущенные до ротации, проверяются общим секретом
+func TestKeyringAcceptsLegacyTokens(t *testing.T) {
+	secret := []byte("legacy-secret")
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString(secret)
+	if err != nil {
+		t.Fatalf("Ошибка подписи: %v", err)
+	}
+
+	key, _ := auth.GenerateSigningKey(auth.AlgRS256)
+	if err := auth.NewKeyring(key, auth.LegacySigningKey(secret)).Verify(legacy, jwt.MapClaims{}); err != nil {
+		t.Errorf("Старый токен HS256 должен проходить проверку: %v", err)
+	}
+	if err := auth.NewKeyring(key).Verify(legacy, jwt.MapClaims{}); err == nil {
+		t.Errorf("Без ключа HS256 старый токен не должен проходить проверку")
+	}
+}
+
+// Тест: алгоритм токена должен совпадать с алгоритмом ключа из kid
+func TestKeyringRejectsAlgorithmMismatch(t *testing.T) {
+	key, _ := auth.GenerateSigningKey(auth.AlgRS256)
+	keys := auth.NewKeyring(key)
+	jwk := keys.JWKS().Keys[0]
+
+	// Подпись HS256 открытым ключом из JWKS вместо секрета
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = key.ID
+	token, err := forged.SignedString([]byte(jwk.N))
+	if err != nil {
+		t.Fatalf("Ошибка подписи: %v", err)
+	}
+	if err := keys.Verify(token, jwt.MapClaims{}); err == nil {
+		t.Errorf("Токен HS256 с kid ключа RS256 не должен проходить проверку")
+	}
+}
+
+// Тест: по JWKS можно проверить токен без доступа к закрытым ключам; HS256 не публикуется
+func TestKeyringJWKS(t *testing.T) {
+	rsaKey, _ := auth.GenerateSigningKey(auth.AlgRS256)
+	edKey, _ := auth.GenerateSigningKey(auth.AlgEdDSA)
+	keys := auth.NewKeyring(edKey, rsaKey, auth.LegacySigningKey([]byte("secret")))
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("Ожидалось 2 открытых ключа, получено %d: %+v", len(set.Keys), set.Keys)
+	}
+
+	published := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		switch jwk.KeyType {
+		case "RSA":
+			n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+			published[jwk.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "OKP":
+			x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+			published[jwk.KeyID] = ed25519.PublicKey(x)
+		default:
+			t.Errorf("Неожиданный тип ключа %q", jwk.KeyType)
+		}
+	}
+
+	for _, key := range []*auth.SigningKey{rsaKey, edKey} {
+		token, err := auth.NewKeyring(key).Sign(testClaims())
+		if err != nil {
+			t.Fatalf("Ошибка подписи: %v", err)
+		}
+		_, err = jwt.Parse(token, func(tok *jwt.Token) (interface{}, error) {
+			return published[tok.Header["kid"].(string)], nil
+		})
+		if err != nil {
+			t.Errorf("Токен %s не проверяется ключом из JWKS: %v", key.Algorithm, err)
+		}
+	}
+}
+
+// Тест разбора JWT_SIGNING_ALG
+func TestParseSigningAlgorithm(t *testing.T) {
+	cases := map[string]string{"": auth.AlgRS256, "rs256": auth.AlgRS256, "EdDSA": auth.AlgEdDSA, "HS256": auth.AlgHS256}
+	for value, expected := range cases {
+		if alg, err := auth.ParseSigningAlgorithm(value); err != nil || alg != expected {
+			t.Errorf("Для %q ожидался %s, получен %s (%v)", value, expected, alg, err)
+		}
+	}
+	if _, err := auth.ParseSigningAlgorithm("none"); err == nil {
+		t.Errorf("Алгоритм none должен отклоняться")
+	}
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"testing"
+	"time"
+)
+
+// Тест экспоненциальной задержки после неудачных попыток входа
+func TestLockoutDuration(t *testing.T) {
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{7, 4 * time.Minute},
+		{11, time.Hour}, // 64 минуты ограничиваются максимумом
+		{1000, time.Hour},
+	}
+	for _, c := range cases {
+		got := auth.LockoutDuration(c.failures, 5, time.Minute, time.Hour)
+		if got != c.want {
+			t.Errorf("Для %d попыток ожидалось %s, получено %s", c.failures, c.want, got)
+		}
+	}
+}
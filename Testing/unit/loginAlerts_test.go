@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"testing"
+)
+
+// Тест: обновление браузера не меняет отпечаток устройства, другой браузер — меняет
+func TestDeviceFingerprint(t *testing.T) {
+	chrome120 := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.71 Safari/537.36"
+	chrome121 := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.6167.85 Safari/537.36"
+	firefox := "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0"
+
+	if auth.DeviceFingerprint(chrome120) != auth.DeviceFingerprint(chrome121) {
+		t.Errorf("Новая версия браузера не должна менять отпечаток")
+	}
+	if auth.DeviceFingerprint(chrome120) == auth.DeviceFingerprint(firefox) {
+		t.Errorf("Разные браузеры должны давать разные отпечатки")
+	}
+	if auth.DeviceFingerprint("") == auth.DeviceFingerprint(firefox) {
+		t.Errorf("Пустой User-Agent не должен совпадать с браузером")
+	}
+}
+
+// Тест определения сети адреса
+func TestIPRange(t *testing.T) {
+	cases := map[string]string{
+		"203.0.113.7":         "203.0.113.0/24",
+		"203.0.113.250":       "203.0.113.0/24",
+		"2001:db8:abcd:12::1": "2001:db8:abcd::/48",
+		"not-an-ip":           "not-an-ip",
+	}
+	for ip, expected := range cases {
+		if got := auth.IPRange(ip); got != expected {
+			t.Errorf("Для %s ожидалась сеть %s, получена %s", ip, expected, got)
+		}
+	}
+	if auth.IPRange("203.0.113.7") == auth.IPRange("203.0.114.7") {
+		t.Errorf("Адреса из разных сетей /24 не должны совпадать")
+	}
+}
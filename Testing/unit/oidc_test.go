@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// testIssuer — локальный OIDC-провайдер для тестов
+type testIssuer struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	idToken  string
+	verifier string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Ошибка генерации RSA-ключа: %v", err)
+	}
+	issuer := &testIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint":         issuer.server.URL + "/token",
+			"jwks_uri":               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		issuer.verifier = r.PostForm.Get("code_verifier")
+		if r.PostForm.Get("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": issuer.idToken, "token_type": "Bearer"})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// sign подписывает id_token ключом провайдера
+func (i *testIssuer) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		t.Fatalf("Ошибка подписи id_token: %v", err)
+	}
+	return signed
+}
+
+func (i *testIssuer) claims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            i.server.URL,
+		"sub":            "external-123",
+		"aud":            "habitmaster",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "user@example.com",
+		"email_verified": true,
+	}
+}
+
+func newTestProvider(t *testing.T, issuer *testIssuer) *auth.OIDCProvider {
+	t.Helper()
+	provider, err := auth.NewOIDCProvider(auth.OIDCConfig{
+		Issuer:      issuer.server.URL,
+		ClientID:    "habitmaster",
+		RedirectURL: "http://localhost:8080/auth/oidc/callback",
+	}, issuer.server.Client())
+	if err != nil {
+		t.Fatalf("Ошибка discovery: %v", err)
+	}
+	return provider
+}
+
+// Тест значения code_challenge из примера RFC 7636
+func TestPKCEChallenge(t *testing.T) {
+	got := auth.PKCEChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("Неверный code_challenge: %s", got)
+	}
+}
+
+// Тест адреса авторизации: PKCE, state и nonce
+func TestOIDCAuthCodeURL(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestProvider(t, issuer)
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state-1", "nonce-1", "verifier-1"))
+	if err != nil {
+		t.Fatalf("Некорректный адрес авторизации: %v", err)
+	}
+	if !strings.HasPrefix(authURL.String(), issuer.server.URL+"/authorize?") {
+		t.Errorf("Ожидался адрес authorization_endpoint, получено %s", authURL)
+	}
+	query := authURL.Query()
+	if query.Get("code_challenge") != auth.PKCEChallenge("verifier-1") || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("Ожидался PKCE с методом S256, получено %v", query)
+	}
+	if query.Get("state") != "state-1" || query.Get("nonce") != "nonce-1" || query.Get("client_id") != "habitmaster" {
+		t.Errorf("Неверные параметры запроса: %v", query)
+	}
+}
+
+// Тест полного обмена кода и проверки id_token
+func TestOIDCExchangeAndVerify(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestProvider(t, issuer)
+	issuer.idToken = issuer.sign(t, issuer.claims("nonce-1"))
+
+	rawToken, err := provider.Exchange("good-code", "verifier-1")
+	if err != nil {
+		t.Fatalf("Ошибка обмена кода: %v", err)
+	}
+	if issuer.verifier != "verifier-1" {
+		t.Errorf("Провайдер должен получить code_verifier, получено %q", issuer.verifier)
+	}
+
+	claims, err := provider.VerifyIDToken(rawToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("Ошибка проверки id_token: %v", err)
+	}
+	if claims.Subject != "external-123" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Errorf("Неверные данные id_token: %+v", claims)
+	}
+
+	if _, err := provider.Exchange("bad-code", "verifier-1"); err == nil {
+		t.Errorf("Неверный код авторизации должен отклоняться")
+	}
+}
+
+// Тест отклонения id_token с неверными данными
+func TestOIDCVerifyRejectsInvalidTokens(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestProvider(t, issuer)
+
+	cases := map[string]func(jwt.MapClaims){
+		"чужой nonce":      func(c jwt.MapClaims) { c["nonce"] = "other" },
+		"чужой audience":   func(c jwt.MapClaims) { c["aud"] = "other-client" },
+		"чужой issuer":     func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"истёкший токен":   func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"без subject":      func(c jwt.MapClaims) { delete(c, "sub") },
+		"aud массивом, ок": nil,
+	}
+	for name, mutate := range cases {
+		claims := issuer.claims("nonce-1")
+		if mutate == nil {
+			claims["aud"] = []string{"other-client", "habitmaster"}
+		} else {
+			mutate(claims)
+		}
+		_, err := provider.VerifyIDToken(issuer.sign(t, claims), "nonce-1")
+		if mutate == nil && err != nil {
+			t.Errorf("%s: токен должен приниматься: %v", name, err)
+		}
+		if mutate != nil && err == nil {
+			t.Errorf("%s: токен должен отклоняться", name)
+		}
+	}
+
+	// Токен, подписанный чужим ключом
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.claims("nonce-1"))
+	forged.Header["kid"] = "test-key"
+	signed, _ := forged.SignedString(otherKey)
+	if _, err := provider.VerifyIDToken(signed, "nonce-1"); err == nil {
+		t.Errorf("Токен с чужой подписью должен отклоняться")
+	}
+}
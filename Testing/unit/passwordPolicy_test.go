@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sha1Hex — SHA-1 пароля в верхнем регистре, как в списках утечек
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// violationCodes — коды нарушений из ошибки политики
+func violationCodes(t *testing.T, err error) []string {
+	t.Helper()
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Ожидалась *PasswordPolicyError, получено %v", err)
+	}
+	codes := make([]string, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		codes[i] = v.Code
+	}
+	return codes
+}
+
+// Тест проверки длины и классов символов
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := auth.PasswordPolicy{MinLength: 10, RequireUpper: true, RequireDigit: true, RequireSymbol: true}
+
+	if err := policy.Check("Correct-Horse-42", "user@example.com"); err != nil {
+		t.Errorf("Надёжный пароль отклонён: %v", err)
+	}
+
+	codes := violationCodes(t, policy.Check("short", ""))
+	want := []string{"too_short", "missing_upper", "missing_digit", "missing_symbol"}
+	if strings.Join(codes, ",") != strings.Join(want, ",") {
+		t.Errorf("Ожидались нарушения %v, получено %v", want, codes)
+	}
+
+	codes = violationCodes(t, policy.Check("Johnsmith-2024", "johnsmith@example.com"))
+	if len(codes) != 1 || codes[0] != "contains_email" {
+		t.Errorf("Ожидалось нарушение contains_email, получено %v", codes)
+	}
+
+	codes = violationCodes(t, auth.PasswordPolicy{MinLength: 8}.Check(strings.Repeat("a", 73), ""))
+	if len(codes) != 1 || codes[0] != "too_long" {
+		t.Errorf("Ожидалось нарушение too_long, получено %v", codes)
+	}
+}
+
+// Тест списка скомпрометированных паролей в виде файла и каталога по префиксам
+func TestBreachedPasswords(t *testing.T) {
+	dir := t.TempDir()
+	hash := sha1Hex("password123")
+
+	file := filepath.Join(dir, "breached.txt")
+	content := hash + ":253581\n" + sha1Hex("qwerty") + ":10\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ranges := filepath.Join(dir, "ranges")
+	if err := os.Mkdir(ranges, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ranges, hash[:5]), []byte(strings.ToLower(hash[5:])+":3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{file, ranges} {
+		list, err := auth.LoadBreachedPasswords(path)
+		if err != nil {
+			t.Fatalf("Ошибка загрузки %s: %v", path, err)
+		}
+		if found, err := list.Contains("password123"); err != nil || !found {
+			t.Errorf("%s: пароль из списка не найден (%v)", path, err)
+		}
+		if found, _ := list.Contains("Correct-Horse-42"); found {
+			t.Errorf("%s: найден пароль, которого нет в списке", path)
+		}
+	}
+
+	t.Setenv("BREACHED_PASSWORDS_FILE", file)
+	codes := violationCodes(t, auth.ValidatePassword("password123", ""))
+	if len(codes) != 1 || codes[0] != "breached" {
+		t.Errorf("Ожидалось нарушение breached, получено %v", codes)
+	}
+}
+
+// Тест отказа в регистрации со слабым паролем до обращения к БД
+func TestRegisterRejectsWeakPassword(t *testing.T) {
+	body := `{"name":"Test","email":"test@example.com","password":"123"}`
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	auth.Register(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "too_short") {
+		t.Errorf("Ожидался статус 400 с нарушением too_short, получено %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
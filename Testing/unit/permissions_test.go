@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Тест проверки имени роли
+func TestValidRoleName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"support":      true,
+		"billing-team": true,
+		"ops_2":        true,
+		"a":            false,
+		"Support":      false,
+		"1ops":         false,
+		"ops team":     false,
+	} {
+		if got := auth.ValidRoleName(name); got != want {
+			t.Errorf("Для %q ожидалось %v, получено %v", name, want, got)
+		}
+	}
+}
+
+// Тест проверки списка разрешений роли
+func TestValidatePermissions(t *testing.T) {
+	if err := auth.ValidatePermissions([]string{auth.PermUsersRead, auth.PermEmailSendMass}); err != nil {
+		t.Errorf("Допустимые разрешения отклонены: %v", err)
+	}
+	if err := auth.ValidatePermissions(nil); err != nil {
+		t.Errorf("Роль без разрешений должна допускаться: %v", err)
+	}
+	for _, permissions := range [][]string{{"users:delete_all"}, {auth.PermUsersRead, auth.PermUsersRead}} {
+		if err := auth.ValidatePermissions(permissions); err == nil {
+			t.Errorf("Разрешения %v должны отклоняться", permissions)
+		}
+	}
+}
+
+// Тест middleware разрешений: admin проходит без обращения к БД, аноним получает 401
+func TestRequirePermission(t *testing.T) {
+	handler := auth.RequirePermission(auth.PermEmailSendMass)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/send-mass-email", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Без авторизации ожидался статус 401, получен %d", recorder.Code)
+	}
+
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: 1, Role: auth.RoleAdmin}))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("Администратор должен иметь все разрешения, получен статус %d", recorder.Code)
+	}
+}
+
+// Тест: роль можно выдать, только если все её разрешения есть у выдающего
+func TestPermissionsWithin(t *testing.T) {
+	held := map[string]bool{auth.PermUsersRead: true, auth.PermUsersRoles: true}
+	if !auth.PermissionsWithin(map[string]bool{auth.PermUsersRead: true}, held) {
+		t.Errorf("Подмножество разрешений должно допускаться")
+	}
+	if !auth.PermissionsWithin(nil, held) {
+		t.Errorf("Роль без разрешений должна допускаться")
+	}
+	if auth.PermissionsWithin(map[string]bool{auth.PermUsersRead: true, auth.PermRolesManage: true}, held) {
+		t.Errorf("Разрешение, которого нет у выдающего, не должно допускаться")
+	}
+}
+
+// Тест: admin выдаёт любую роль, роль admin выдаёт только admin
+func TestCanGrantRoleAdmin(t *testing.T) {
+	for _, role := range []string{auth.RoleAdmin, auth.RoleUser, "support"} {
+		if ok, err := auth.CanGrantRole(auth.RoleAdmin, role); err != nil || !ok {
+			t.Errorf("Администратор должен выдавать роль %s (%v)", role, err)
+		}
+	}
+	for _, actor := range []string{auth.RoleUser, "support", ""} {
+		if ok, _ := auth.CanGrantRole(actor, auth.RoleAdmin); ok {
+			t.Errorf("Роль %q не должна выдавать admin", actor)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package preferences_test
+
+import (
+	"HabitMaster/preferences"
+	"testing"
+	"time"
+)
+
+// Тест корректности настроек по умолчанию
+func TestDefaultIsValid(t *testing.T) {
+	if err := preferences.Default().Validate(); err != nil {
+		t.Fatalf("Настройки по умолчанию не прошли проверку: %v", err)
+	}
+	// От рассылки можно отписаться, но по умолчанию она приходит
+	if !preferences.Default().AllowsEmail(preferences.EmailProductUpdates) {
+		t.Error("По умолчанию рассылка product_updates должна быть включена")
+	}
+}
+
+// Тест частичного обновления настроек
+func TestApplyMergesPartialPatch(t *testing.T) {
+	base := preferences.Default()
+	updated, err := base.Apply([]byte(`{"time_zone":"Asia/Almaty","notifications":{"emails":{"weekly_summary":false}}}`))
+	if err != nil {
+		t.Fatalf("Ошибка применения настроек: %v", err)
+	}
+	if updated.TimeZone != "Asia/Almaty" || updated.Locale != "en" {
+		t.Errorf("Ожидался пояс Asia/Almaty и язык en, получено %q и %q", updated.TimeZone, updated.Locale)
+	}
+	if updated.AllowsEmail(preferences.EmailWeeklySummary) || !updated.AllowsEmail(preferences.EmailReminders) {
+		t.Errorf("Неверно объединены категории писем: %v", updated.Notifications.Emails)
+	}
+	if !base.AllowsEmail(preferences.EmailWeeklySummary) {
+		t.Error("Исходные настройки не должны меняться")
+	}
+
+	withQuiet, _ := base.Apply([]byte(`{"notifications":{"quiet_hours":{"start":"22:00","end":"07:00"}}}`))
+	cleared, err := withQuiet.Apply([]byte(`{"notifications":{"quiet_hours":null}}`))
+	if err != nil || cleared.Notifications.QuietHours != nil {
+		t.Errorf("quiet_hours: null должен отключать тихие часы, получено %v (%v)", cleared.Notifications.QuietHours, err)
+	}
+}
+
+// Тест отклонения некорректных значений
+func TestApplyRejectsInvalidValues(t *testing.T) {
+	patches := []string{
+		`{"time_zone":"Mars/Olympus"}`,
+		`{"locale":"de"}`,
+		`{"week_start":"friday"}`,
+		`{"notifications":{"emails":{"spam":true}}}`,
+		`{"notifications":{"reminder_channels":["sms"]}}`,
+		`{"notifications":{"quiet_hours":{"start":"25:00","end":"07:00"}}}`,
+	}
+	for _, patch := range patches {
+		if _, err := preferences.Default().Apply([]byte(patch)); err == nil {
+			t.Errorf("Ожидалась ошибка для %s", patch)
+		}
+	}
+}
+
+// Тест тихих часов с переходом через полночь в часовом поясе пользователя
+func TestInQuietHoursOvernight(t *testing.T) {
+	prefs, err := preferences.Default().Apply([]byte(`{"time_zone":"Asia/Almaty","notifications":{"quiet_hours":{"start":"22:00","end":"07:00"}}}`))
+	if err != nil {
+		t.Fatalf("Ошибка применения настроек: %v", err)
+	}
+	loc := prefs.Location()
+	cases := map[string]bool{"23:30": true, "03:00": true, "07:00": false, "12:00": false, "22:00": true}
+	for clock, want := range cases {
+		moment, _ := time.ParseInLocation("2006-01-02 15:04", "2026-01-10 "+clock, loc)
+		if got := prefs.InQuietHours(moment.UTC()); got != want {
+			t.Errorf("Для %s ожидалось %v, получено %v", clock, want, got)
+		}
+	}
+}
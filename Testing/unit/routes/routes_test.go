@@ -0,0 +1,37 @@
+package routes_test
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// Тест: маршруты привычек и целей не обслуживают анонимные запросы
+func TestTrackerRoutesRejectAnonymous(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(auth.OptionalAuthMiddleware, auth.TokenScopeMiddleware)
+	routes.RegisterTrackerRoutes(r, nil)
+
+	cases := []struct{ method, path string }{
+		{http.MethodGet, "/api/habits"},
+		{http.MethodPost, "/api/habits"},
+		{http.MethodGet, "/api/habits/1/history"},
+		{http.MethodPost, "/api/habits/1/history/1/revert"},
+		{http.MethodGet, "/api/goals"},
+		{http.MethodDelete, "/api/goals/deleteAll"},
+		{http.MethodPost, "/api/goals/1/progress"},
+		{http.MethodPost, "/api/goals/1/history/1/revert"},
+		{http.MethodGet, "/api/okrs"},
+	}
+	for _, c := range cases {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(c.method, c.path, nil))
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: ожидался статус 401, получен %d", c.method, c.path, recorder.Code)
+		}
+	}
+}
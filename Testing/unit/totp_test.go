@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"HabitMaster/auth"
+	"testing"
+	"time"
+)
+
+// Секрет из RFC 6238 ("12345678901234567890") в base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Тест контрольных значений RFC 6238 (SHA1, последние 6 цифр)
+func TestTOTPCodeRFCVectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		got, err := auth.TOTPCode(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("Ошибка вычисления кода: %v", err)
+		}
+		if got != want {
+			t.Errorf("Для времени %d ожидался код %s, получен %s", unix, want, got)
+		}
+	}
+}
+
+// Тест допуска на расхождение часов в один интервал
+func TestValidateTOTPWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := auth.TOTPCode(rfcSecret, now)
+
+	if _, ok := auth.ValidateTOTP(rfcSecret, code, now.Add(30*time.Second)); !ok {
+		t.Errorf("Код предыдущего интервала должен приниматься")
+	}
+	if _, ok := auth.ValidateTOTP(rfcSecret, code, now.Add(2*time.Minute)); ok {
+		t.Errorf("Устаревший код не должен приниматься")
+	}
+	if _, ok := auth.ValidateTOTP(rfcSecret, "000000", now); ok && code != "000000" {
+		t.Errorf("Неверный код не должен приниматься")
+	}
+}
+
+// Тест генерации секрета, пригодного для вычисления кода
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Ошибка генерации секрета: %v", err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("Ожидался секрет длиной 32 символа, получено %d", len(secret))
+	}
+	if _, err := auth.TOTPCode(secret, time.Now()); err != nil {
+		t.Errorf("Сгенерированный секрет не декодируется: %v", err)
+	}
+}
@@ -16,14 +16,54 @@ func TestGenerateVerificationCode(t *testing.T) {
 		t.Fatalf("Ошибка при генерации кода: %v", err)
 	}
 
-	// Проверяем, что длина кода = 4
-	if len(code) != 4 {
-		t.Errorf("Ожидаемая длина 4, но получили: %d", len(code))
+	// Проверяем, что длина кода по умолчанию = 6
+	if len(code) != 6 {
+		t.Errorf("Ожидаемая длина 6, но получили: %d", len(code))
 	}
 
 	// Проверяем, что код содержит только цифры
-	matched, _ := regexp.MatchString(`^\d{4}$`, code)
+	matched, _ := regexp.MatchString(`^\d{6}$`, code)
 	if !matched {
 		t.Errorf("Код содержит недопустимые символы: %s", code)
 	}
 }
+
+// Тест длины кода из VERIFICATION_CODE_LENGTH
+func TestGenerateVerificationCodeLength(t *testing.T) {
+	t.Setenv("VERIFICATION_CODE_LENGTH", "8")
+	code, err := auth.GenerateVerificationCode()
+	if err != nil {
+		t.Fatalf("Ошибка при генерации кода: %v", err)
+	}
+	if matched, _ := regexp.MatchString(`^\d{8}$`, code); !matched {
+		t.Errorf("Ожидался код из 8 цифр, получено: %s", code)
+	}
+}
+
+// Тест равномерности и ведущих нулей в случайных кодах
+func TestGenerateNumericCode(t *testing.T) {
+	seen := make(map[string]bool)
+	leadingZero := false
+	for i := 0; i < 2000; i++ {
+		code, err := auth.GenerateNumericCode(4)
+		if err != nil {
+			t.Fatalf("Ошибка при генерации кода: %v", err)
+		}
+		if len(code) != 4 {
+			t.Fatalf("Ожидаемая длина 4, но получили: %q", code)
+		}
+		seen[code] = true
+		leadingZero = leadingZero || code[0] == '0'
+	}
+	// Из 10000 вариантов 2000 попыток дают больше 1500 разных кодов
+	if len(seen) < 1500 {
+		t.Errorf("Слишком много повторов: %d разных кодов из 2000", len(seen))
+	}
+	if !leadingZero {
+		t.Error("Коды с ведущим нулём не встречаются")
+	}
+
+	if _, err := auth.GenerateNumericCode(0); err == nil {
+		t.Error("Ожидалась ошибка для нулевой длины")
+	}
+}
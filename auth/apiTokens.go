@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// apiTokenPrefix — префикс персональных токенов, по нему middleware отличает их от JWT
+const apiTokenPrefix = "hm_pat_"
+
+// apiTokenMaxPerUser — ограничение на число действующих токенов пользователя
+const apiTokenMaxPerUser = 50
+
+// APIScopes — области доступа, которые можно выдать персональному токену
+var APIScopes = []string{"habits:read", "habits:write", "goals:read", "goals:write"}
+
+// scopedPaths — маршруты, доступные по персональным токенам, и их ресурс.
+// Все остальные маршруты API по таким токенам закрыты.
+var scopedPaths = []struct {
+	prefix   string
+	resource string
+}{
+	{"/api/habits", "habits"},
+	{"/api/goals", "goals"},
+	{"/api/okrs", "goals"},
+}
+
+// APIToken — персональный токен доступа (сам токен не хранится и не возвращается)
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ValidateScopes проверяет, что все области доступа известны и не повторяются
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required, allowed: %s", strings.Join(APIScopes, ", "))
+	}
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		known := false
+		for _, allowed := range APIScopes {
+			known = known || scope == allowed
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q, allowed: %s", scope, strings.Join(APIScopes, ", "))
+		}
+		if seen[scope] {
+			return fmt.Errorf("duplicate scope %q", scope)
+		}
+		seen[scope] = true
+	}
+	return nil
+}
+
+// RequiredScope — область доступа для запроса: чтение для GET/HEAD, запись для остального.
+// false — маршрут по персональным токенам недоступен.
+func RequiredScope(method, path string) (string, bool) {
+	for _, p := range scopedPaths {
+		if path == p.prefix || strings.HasPrefix(path, p.prefix+"/") {
+			if method == http.MethodGet || method == http.MethodHead {
+				return p.resource + ":read", true
+			}
+			return p.resource + ":write", true
+		}
+	}
+	return "", false
+}
+
+// authenticateAPIToken проверяет персональный токен
+func authenticateAPIToken(token string) (*Principal, string) {
+	var (
+		principal Principal
+		tokenID   int
+		scopes    []string
+	)
+	err := database().QueryRow(`
+		SELECT t.id, t.scopes, u.user_id, u.email, u.role
+		FROM api_tokens t JOIN users u ON u.user_id = t.user_id
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > NOW())`,
+		hashToken(token)).Scan(&tokenID, pq.Array(&scopes), &principal.UserID, &principal.Email, &principal.Role)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("❌ Ошибка БД при проверке API-токена: %v", err)
+		}
+		return nil, "Unauthorized: Invalid token"
+	}
+
+	// Время последнего использования обновляем не чаще раза в минуту
+	_, err = database().Exec(`UPDATE api_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`, tokenID)
+	if err != nil {
+		log.Printf("⚠️ Не удалось обновить использование API-токена %d: %v", tokenID, err)
+	}
+
+	principal.TokenID = tokenID
+	principal.Scopes = scopes
+	return &principal, ""
+}
+
+// TokenScopeMiddleware ограничивает запросы с персональным токеном его областями доступа.
+// Используется после OptionalAuthMiddleware; запросы с JWT и анонимные не затрагивает.
+func TokenScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFromContext(r.Context())
+		if !ok || principal.TokenID == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		scope, scoped := RequiredScope(r.Method, r.URL.Path)
+		if !scoped {
+			http.Error(w, "Forbidden: This endpoint is not available for API tokens", http.StatusForbidden)
+			return
+		}
+		if !principal.HasScope(scope) {
+			http.Error(w, "Forbidden: Token is missing scope "+scope, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CreateAPIToken — POST /api/tokens, выдаёт новый токен. Сам токен показывается один раз.
+func CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	var request struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 100 {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Name is required (up to 100 characters)"})
+		return
+	}
+	if err := ValidateScopes(request.Scopes); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if request.ExpiresInDays < 0 || request.ExpiresInDays > 3650 {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "expires_in_days must be between 0 (no expiry) and 3650"})
+		return
+	}
+
+	var active int
+	err := database().QueryRow(`SELECT COUNT(*) FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`, principal.UserID).Scan(&active)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if active >= apiTokenMaxPerUser {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Too many active tokens, revoke unused ones first"})
+		return
+	}
+
+	secret, _, err := generateToken()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+		return
+	}
+	token := apiTokenPrefix + secret
+
+	created := APIToken{Name: request.Name, Prefix: token[:len(apiTokenPrefix)+6], Scopes: request.Scopes}
+	if request.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		created.ExpiresAt = &expiresAt
+	}
+	err = database().QueryRow(`INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		principal.UserID, created.Name, hashToken(token), created.Prefix, pq.Array(created.Scopes), created.ExpiresAt).
+		Scan(&created.ID, &created.CreatedAt)
+	if err != nil {
+		log.Printf("❌ Ошибка создания API-токена: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	log.Printf("🔑 Пользователь %d создал API-токен %d", principal.UserID, created.ID)
+	respondJSON(w, http.StatusCreated, struct {
+		APIToken
+		Token string `json:"token"`
+	}{created, token})
+}
+
+// ListAPITokens — GET /api/tokens, действующие токены текущего пользователя
+func ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	rows, err := database().Query(`SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY created_at DESC`, principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения API-токенов: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var expiresAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, pq.Array(&t.Scopes), &expiresAt, &lastUsedAt, &t.CreatedAt); err != nil {
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			return
+		}
+		if expiresAt.Valid {
+			t.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			t.LastUsedAt = &lastUsedAt.Time
+		}
+		tokens = append(tokens, t)
+	}
+	respondJSON(w, http.StatusOK, tokens)
+}
+
+// RevokeAPIToken — DELETE /api/tokens/{id}
+func RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	tokenID, ok := pathInt(r, "id")
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid token id"})
+		return
+	}
+
+	res, err := database().Exec(`UPDATE api_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, tokenID, principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка отзыва API-токена: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Token not found"})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Token revoked"})
+}
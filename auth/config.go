@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"HabitMaster/databaseConnector"
+
+	"database/sql"
+	"sync"
+)
+
+var (
+	dbOnce sync.Once
+	authDB *sql.DB
+)
+
+// database — общее подключение к БД для обработчиков авторизации
+func database() *sql.DB {
+	dbOnce.Do(func() {
+		authDB = databaseConnector.ConnectBD()
+	})
+	return authDB
+}
@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"HabitMaster/emailTemplates"
+	"HabitMaster/envConfig"
+	"errors"
+
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// emailChangeTTL — срок действия ссылки подтверждения на новый адрес
+func emailChangeTTL() time.Duration {
+	return envConfig.Duration("EMAIL_CHANGE_TTL", 24*time.Hour)
+}
+
+// emailRevertTTL — сколько действует ссылка отмены, отправленная на старый адрес
+func emailRevertTTL() time.Duration {
+	return envConfig.Duration("EMAIL_REVERT_TTL", 7*24*time.Hour)
+}
+
+// NormalizeEmail проверяет формат адреса и приводит его к нижнему регистру,
+// как handlers.CreateUser, чтобы проверки уникальности совпадали
+func NormalizeEmail(email string) (string, bool) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", false
+	}
+	return strings.ToLower(email), true
+}
+
+// emailTaken — занят ли адрес другим пользователем (без учёта регистра)
+func emailTaken(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, email string, exceptUserID int) (bool, error) {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND user_id <> $2)`,
+		email, exceptUserID).Scan(&exists)
+	return exists, err
+}
+
+// RequestEmailChange — POST /api/me/email. Новый адрес вступает в силу только
+// после подтверждения по ссылке; старый адрес получает ссылку для отмены.
+func RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	var request struct {
+		NewEmail string `json:"new_email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
+		return
+	}
+	newEmail, ok := NormalizeEmail(request.NewEmail)
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid email address"})
+		return
+	}
+
+	var oldEmail, passwordHash string
+	err := database().QueryRow(`SELECT email, password FROM users WHERE user_id = $1`, principal.UserID).
+		Scan(&oldEmail, &passwordHash)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(request.Password)) != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid password"})
+		return
+	}
+	if strings.EqualFold(newEmail, oldEmail) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "New email is the same as the current one"})
+		return
+	}
+	err = beginEmailChange(principal.UserID, oldEmail, newEmail)
+	if err == ErrEmailTaken {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Email is already in use"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка создания запроса смены email: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	log.Printf("📧 Пользователь %d запросил смену email", principal.UserID)
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "We sent a confirmation link to the new address. The change takes effect after you confirm it.",
+	})
+}
+
+// ErrEmailTaken — новый адрес уже занят другим пользователем
+var ErrEmailTaken = errors.New("email is already in use")
+
+// beginEmailChange сохраняет запрос смены адреса и отправляет ссылки:
+// подтверждение — на новый адрес, отмену — на старый
+func beginEmailChange(userID int, oldEmail, newEmail string) error {
+	// Ранняя проверка для понятной ошибки; окончательная — при подтверждении
+	taken, err := emailTaken(database(), newEmail, userID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	confirmToken, confirmHash, err := generateToken()
+	if err != nil {
+		return err
+	}
+	revertToken, revertHash, err := generateToken()
+	if err != nil {
+		return err
+	}
+	if err := createEmailChange(userID, oldEmail, newEmail, confirmHash, revertHash); err != nil {
+		return err
+	}
+
+	go sendEmailChangeConfirmation(oldEmail, newEmail, confirmToken)
+	go sendEmailChangeNotice(oldEmail, newEmail, revertToken)
+	return nil
+}
+
+// StartEmailChange начинает смену адреса по запросу администратора. Как и при смене
+// из профиля, адрес меняется только после подтверждения по ссылке, а старый адрес
+// получает ссылку для отмены, которая возвращает прежний адрес и завершает все сессии.
+// Возвращает false, если адрес не отличается от текущего.
+func StartEmailChange(userID int, newEmail string) (bool, error) {
+	var oldEmail string
+	if err := database().QueryRow(`SELECT email FROM users WHERE user_id = $1`, userID).Scan(&oldEmail); err != nil {
+		return false, err
+	}
+	if strings.EqualFold(newEmail, oldEmail) {
+		return false, nil
+	}
+	if err := beginEmailChange(userID, oldEmail, newEmail); err != nil {
+		return false, err
+	}
+	log.Printf("📧 Начата смена email пользователя %d по запросу администратора", userID)
+	return true, nil
+}
+
+// createEmailChange отменяет незавершённые запросы и сохраняет новый
+func createEmailChange(userID int, oldEmail, newEmail, confirmHash, revertHash string) error {
+	tx, err := database().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE email_changes SET cancelled_at = NOW()
+		WHERE user_id = $1 AND confirmed_at IS NULL AND cancelled_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = tx.Exec(`INSERT INTO email_changes (user_id, old_email, new_email, confirm_token_hash, revert_token_hash,
+			expires_at, revert_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		userID, oldEmail, newEmail, confirmHash, revertHash, now.Add(emailChangeTTL()), now.Add(emailRevertTTL()))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sendEmailChangeConfirmation отправляет ссылку подтверждения на новый адрес.
+// Язык письма — из настроек владельца старого адреса.
+func sendEmailChangeConfirmation(oldEmail, email, token string) {
+	err := sendTemplate(email, emailPreferences(oldEmail).Locale, emailTemplates.EmailChangeConfirm, emailTemplates.Data{
+		"Link": appURL("/email-change.html?action=confirm&token=" + url.QueryEscape(token)),
+		"TTL":  emailChangeTTL(),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка отправки подтверждения смены email: %v", err)
+	}
+}
+
+// sendEmailChangeNotice предупреждает старый адрес и даёт ссылку для отмены
+func sendEmailChangeNotice(oldEmail, newEmail, token string) {
+	err := sendTemplate(oldEmail, emailPreferences(oldEmail).Locale, emailTemplates.EmailChangeNotice, emailTemplates.Data{
+		"NewEmail": newEmail,
+		"OldEmail": oldEmail,
+		"Link":     appURL("/email-change.html?action=revert&token=" + url.QueryEscape(token)),
+		"TTL":      emailRevertTTL(),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка отправки уведомления о смене email: %v", err)
+	}
+}
+
+// ConfirmEmailChange — POST /email/confirm, применяет смену адреса по токену из письма
+func ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Token is required"})
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var changeID, userID int
+	var newEmail string
+	err = tx.QueryRow(`SELECT id, user_id, new_email FROM email_changes
+		WHERE confirm_token_hash = $1 AND confirmed_at IS NULL AND cancelled_at IS NULL AND expires_at > NOW()
+		FOR UPDATE`, hashToken(request.Token)).Scan(&changeID, &userID, &newEmail)
+	if err == sql.ErrNoRows {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired confirmation link"})
+		return
+	}
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	// Блокировка по адресу не даёт двум подтверждениям занять один email одновременно
+	if _, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext(LOWER($1)))`, newEmail); err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	taken, err := emailTaken(tx, newEmail, userID)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if taken {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Email is already in use"})
+		return
+	}
+
+	_, err = tx.Exec(`UPDATE users SET email = $1, is_verified = TRUE, updated_at = NOW() WHERE user_id = $2`, newEmail, userID)
+	if err == nil {
+		_, err = tx.Exec(`UPDATE email_changes SET confirmed_at = NOW() WHERE id = $1`, changeID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка подтверждения смены email: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database update failed"})
+		return
+	}
+
+	log.Printf("✅ Email пользователя %d изменён", userID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Email address updated", "email": newEmail})
+}
+
+// RevertEmailChange — POST /email/revert, отменяет смену адреса по ссылке со старого email.
+// Если смена уже подтверждена, возвращает старый адрес и завершает все сессии.
+func RevertEmailChange(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Token is required"})
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var changeID, userID int
+	var oldEmail string
+	var confirmed bool
+	err = tx.QueryRow(`SELECT id, user_id, old_email, confirmed_at IS NOT NULL FROM email_changes
+		WHERE revert_token_hash = $1 AND cancelled_at IS NULL AND revert_expires_at > NOW()
+		FOR UPDATE`, hashToken(request.Token)).Scan(&changeID, &userID, &oldEmail, &confirmed)
+	if err == sql.ErrNoRows {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired link"})
+		return
+	}
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	if confirmed {
+		if _, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext(LOWER($1)))`, oldEmail); err != nil {
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			return
+		}
+		if taken, err := emailTaken(tx, oldEmail, userID); err != nil || taken {
+			respondJSON(w, http.StatusConflict, map[string]string{"error": "The previous email is now used by another account, please contact support"})
+			return
+		}
+		// Вероятен захват аккаунта: возвращаем адрес и выкидываем все сессии
+		_, err = tx.Exec(`UPDATE users SET email = $1, tokens_valid_after = NOW(), updated_at = NOW() WHERE user_id = $2`,
+			oldEmail, userID)
+		if err == nil {
+			err = RevokeAllAccess(tx, userID, "email_change_reverted")
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec(`UPDATE email_changes SET cancelled_at = NOW() WHERE id = $1`, changeID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка отмены смены email: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database update failed"})
+		return
+	}
+
+	if confirmed {
+		log.Printf("⚠️ Смена email пользователя %d отменена, сессии отозваны", userID)
+		respondJSON(w, http.StatusOK, map[string]string{
+			"message": "Your previous email has been restored and all sessions were signed out. Please reset your password.",
+		})
+		return
+	}
+	log.Printf("✅ Запрос смены email пользователя %d отменён", userID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "The email change request has been cancelled"})
+}
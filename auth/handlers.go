@@ -1,72 +1,67 @@
 package auth
 
 import (
-	"HabitMaster/databaseConnector"
-	"HabitMaster/handlers"
+	"HabitMaster/emailSender"
+	"HabitMaster/emailTemplates"
+	"HabitMaster/envConfig"
 
-	"crypto/tls"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
+	"math/big"
 	"net/http"
-	"os"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
-	"github.com/go-gomail/gomail"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtKey = []byte(os.Getenv("SECRET_KEY"))
-
-// Генерируем 4-значный код верификации
+// GenerateVerificationCode генерирует код верификации длиной VERIFICATION_CODE_LENGTH
+// цифр (по умолчанию 6, допускается от 4 до 10)
 func GenerateVerificationCode() (string, error) {
-	rand.Seed(time.Now().UnixNano())              // Используем math/rand правильно
-	code := fmt.Sprintf("%04d", rand.Intn(10000)) // Всегда 4 цифры
-	return code, nil
+	length := envConfig.Int("VERIFICATION_CODE_LENGTH", 6)
+	if length < 4 || length > 10 {
+		log.Printf("⚠️ Некорректное значение VERIFICATION_CODE_LENGTH=%d, используется 6", length)
+		length = 6
+	}
+	return GenerateNumericCode(length)
 }
 
-// Отправка верификационного email
-func sendVerificationEmail(userEmail, code string) error {
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := 587
-	smtpUser := os.Getenv("SMTP_USER")
-	smtpPass := os.Getenv("SMTP_PASSWORD")
-	smtpFrom := smtpUser // Gmail требует, чтобы отправитель был тем же, что и логин
-
-	log.Printf("📧 Отправка верификационного кода %s на %s", code, userEmail)
-
-	m := gomail.NewMessage()
-	m.SetHeader("From", smtpFrom)
-	m.SetHeader("To", userEmail)
-	m.SetHeader("Subject", "Your Verification Code")
-	m.SetBody("text/html", fmt.Sprintf("<h3>Your verification code: <b>%s</b></h3>", code))
-
-	d := gomail.NewDialer(smtpHost, smtpPort, smtpUser, smtpPass)
-	d.SSL = false
-	d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-
-	err := d.DialAndSend(m)
+// GenerateNumericCode — случайный код из length цифр на основе crypto/rand,
+// все значения от 0…0 до 9…9 равновероятны
+func GenerateNumericCode(length int) (string, error) {
+	if length < 1 || length > 18 {
+		return "", fmt.Errorf("invalid code length %d", length)
+	}
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
+	n, err := rand.Int(rand.Reader, limit)
 	if err != nil {
-		log.Printf("❌ Ошибка отправки email: %v", err)
-		return err
+		return "", err
 	}
+	return fmt.Sprintf("%0*d", length, n), nil
+}
 
-	log.Println("✅ Код отправлен!")
-	return nil
+// verificationEmail — письмо с кодом подтверждения
+func verificationEmail(locale, code string) (emailTemplates.Email, error) {
+	return emailTemplates.Render(emailTemplates.Verification, locale, emailTemplates.Data{
+		"Code": code,
+		"TTL":  verificationCodeTTL(),
+	})
 }
 
-// Структура для JWT-токена
-type Claims struct {
-	Email string `json:"email"`
-	Role  string `json:"role"`
-	jwt.StandardClaims
+// credentials — данные из форм регистрации и входа
+type credentials struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Invite   string `json:"invite,omitempty"`
 }
 
 // Регистрация пользователя
 func Register(w http.ResponseWriter, r *http.Request) {
-	var user handlers.User
+	var user credentials
 
 	// 1. Декодируем JSON-запрос
 	err := json.NewDecoder(r.Body).Decode(&user)
@@ -81,38 +76,75 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3. Хешируем пароль
+	if err := ValidatePassword(user.Password, user.Email); err != nil {
+		respondPasswordError(w, err)
+		return
+	}
+
+	// 3. Проверяем режим регистрации: closed — только администратор, invite — только по приглашению
+	if err := checkRegistrationAllowed(registrationMode(), user.Invite); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusForbidden)
+		return
+	}
+
+	// 4. Хешируем пароль
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		http.Error(w, `{"error": "Error hashing password"}`, http.StatusInternalServerError)
 		return
 	}
 
-	// 4. Генерация 4-значного кода
+	// 5. Генерация кода верификации
 	verificationCode, err := GenerateVerificationCode()
 	if err != nil {
 		http.Error(w, `{"error": "Error generating verification code"}`, http.StatusInternalServerError)
 		return
 	}
 
-	// 5. Вставляем пользователя в БД
-	query := `INSERT INTO users (name, email, password, role, is_verified, verification_code) 
-              VALUES ($1, $2, $3, 'user', FALSE, $4) RETURNING user_id`
-	err = databaseConnector.ConnectBD().QueryRow(query, user.Name, user.Email, string(hashedPassword), verificationCode).Scan(&user.UserID)
-
+	// 6. Вставляем пользователя в БД и погашаем приглашение в одной транзакции
+	tx, err := database().Begin()
 	if err != nil {
-		log.Printf("❌ Ошибка БД при регистрации: %v", err)
-		http.Error(w, `{"error": "Database insert error"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error": "Database error"}`, http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO users (name, email, password, role, is_verified, verification_code,
+                                 verification_code_expires_at, verification_sent_at) 
+              VALUES ($1, $2, $3, 'user', FALSE, $4, $5, NOW()) RETURNING user_id`
+	var userID int
+	err = tx.QueryRow(query, user.Name, user.Email, string(hashedPassword), verificationCode,
+		time.Now().Add(verificationCodeTTL())).Scan(&userID)
+	if err == nil && user.Invite != "" {
+		var role string
+		role, err = acceptInvitation(tx, user.Invite, user.Email, userID)
+		if err == errInvitationInvalid {
+			http.Error(w, fmt.Sprintf(`{"error": %q}`, err.Error()), http.StatusForbidden)
+			return
+		}
+		if err == nil {
+			_, err = tx.Exec(`UPDATE users SET role = $1 WHERE user_id = $2`, role, userID)
+		}
+	}
+	// 7. Письмо с кодом ставится в очередь в той же транзакции: недоступность SMTP
+	// не ломает регистрацию, а без пользователя письмо не уйдёт
+	if err == nil {
+		var message emailTemplates.Email
+		message, err = verificationEmail(emailTemplates.DefaultLocale, verificationCode)
+		if err == nil {
+			err = emailSender.EnqueueSensitive(tx, []string{user.Email}, message.Subject, message.HTML, message.Text)
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 
-	// 6. Отправляем код по email
-	err = sendVerificationEmail(user.Email, verificationCode)
 	if err != nil {
-		log.Printf("❌ Ошибка отправки email: %v", err)
-		http.Error(w, `{"error": "Failed to send verification email"}`, http.StatusInternalServerError)
+		log.Printf("❌ Ошибка БД при регистрации: %v", err)
+		http.Error(w, `{"error": "Database insert error"}`, http.StatusInternalServerError)
 		return
 	}
+	log.Printf("📧 Код подтверждения поставлен в очередь: %s", user.Email)
 
 	// ✅ **Отправляем JSON с `201 Created`**
 	w.Header().Set("Content-Type", "application/json")
@@ -131,7 +163,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 
 // Логин пользователя
 func Login(w http.ResponseWriter, r *http.Request) {
-	var user handlers.User
+	var user credentials
 
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
@@ -139,43 +171,128 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var dbUser handlers.User
-	query := `SELECT user_id, email, password, role FROM users WHERE email=$1`
-	err = databaseConnector.ConnectBD().QueryRow(query, user.Email).Scan(&dbUser.UserID, &dbUser.Email, &dbUser.Password, &dbUser.Role)
+	// Слишком много неудачных попыток с этого IP — экспоненциальная задержка
+	if wait := ipRetryAfter(r); wait > 0 {
+		recordLoginAttempt(r, 0, user.Email, false, loginIPThrottled)
+		respondTooManyAttempts(w, wait, "Too many failed login attempts, try again later")
+		return
+	}
+
+	var dbUser struct {
+		UserID      int
+		Email       string
+		Password    string
+		Role        string
+		IsVerified  bool
+		TOTPEnabled bool
+		LockedUntil sql.NullTime
+		ResetNeeded bool
+	}
+	query := `SELECT user_id, email, password, role, is_verified, totp_enabled, locked_until, password_reset_required FROM users WHERE email=$1`
+	err = database().QueryRow(query, user.Email).Scan(&dbUser.UserID, &dbUser.Email, &dbUser.Password, &dbUser.Role, &dbUser.IsVerified, &dbUser.TOTPEnabled, &dbUser.LockedUntil, &dbUser.ResetNeeded)
 
 	if err != nil {
+		recordLoginAttempt(r, 0, user.Email, false, loginInvalidCredentials)
 		http.Error(w, `{"error": "Invalid email or password"}`, http.StatusUnauthorized)
 		return
 	}
 
+	// Заблокированный аккаунт не проверяет пароль, чтобы подбор не продолжался
+	if wait := accountRetryAfter(dbUser.LockedUntil); wait > 0 {
+		recordLoginAttempt(r, dbUser.UserID, dbUser.Email, false, loginAccountLocked)
+		respondTooManyAttempts(w, wait, "Account is temporarily locked due to failed login attempts")
+		return
+	}
+
 	// Проверка пароля
 	err = bcrypt.CompareHashAndPassword([]byte(dbUser.Password), []byte(user.Password))
 	if err != nil {
+		recordLoginAttempt(r, dbUser.UserID, dbUser.Email, false, loginInvalidCredentials)
+		registerFailedLogin(dbUser.UserID, dbUser.Email)
 		http.Error(w, `{"error": "Invalid email or password"}`, http.StatusUnauthorized)
 		return
 	}
 
-	// Генерируем токен
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Email: dbUser.Email,
-		Role:  dbUser.Role,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+	// Пользователь не узнал вход с нового устройства — пароль считается скомпрометированным.
+	// Ответ совпадает с неверным паролем, чтобы не подтверждать, что пароль угадан.
+	if dbUser.ResetNeeded {
+		recordLoginAttempt(r, dbUser.UserID, dbUser.Email, false, loginResetRequired)
+		http.Error(w, `{"error": "Invalid email or password"}`, http.StatusUnauthorized)
+		return
+	}
+
+	// Вход разрешён только после подтверждения email
+	if !dbUser.IsVerified {
+		recordLoginAttempt(r, dbUser.UserID, dbUser.Email, false, loginNotVerified)
+		http.Error(w, `{"error": "Email is not verified"}`, http.StatusForbidden)
+		return
+	}
+
+	// С включённой 2FA токены выдаются только после второго шага (/login/2fa).
+	// Счётчик неудачных попыток сбрасывается только после него: иначе верный пароль
+	// позволял бы перебирать коды без блокировки аккаунта.
+	if dbUser.TOTPEnabled {
+		mfaToken, err := createMFAChallenge(dbUser.UserID)
+		if err != nil {
+			log.Printf("❌ Ошибка создания MFA-запроса: %v", err)
+			http.Error(w, `{"error": "Error generating token"}`, http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int(mfaChallengeTTL().Seconds()),
+		})
+		recordLoginAttempt(r, dbUser.UserID, dbUser.Email, true, loginMFARequired)
+		log.Printf("🔐 Пароль принят, ожидается второй фактор: %s", dbUser.Email)
+		return
 	}
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKey)
+	// Вход завершён — счётчик неудачных попыток сбрасывается
+	if _, err := resetFailedLogins(dbUser.UserID); err != nil {
+		log.Printf("⚠️ Не удалось сбросить счётчик неудачных входов: %v", err)
+	}
+	if writeLoginResponse(w, r, dbUser.UserID, dbUser.Email, dbUser.Role, false) {
+		recordLoginAttempt(r, dbUser.UserID, dbUser.Email, true, loginOK)
+	}
+}
+
+// writeLoginResponse создаёт сессию и отправляет токены после успешного входа.
+// Возвращает false, если сессия не создана и клиенту отправлена ошибка.
+func writeLoginResponse(w http.ResponseWriter, r *http.Request, userID int, email, role string, mfa bool) bool {
+	// Создаём сессию и выдаём токены
+	tokens, err := startSession(r, userID, email, role, mfa)
+	if err == errPasswordResetRequired {
+		recordLoginAttempt(r, userID, email, false, loginResetRequired)
+		respondJSON(w, http.StatusForbidden, map[string]interface{}{
+			"error":                   "Password reset required. Use \"Forgot password\" to choose a new password.",
+			"password_reset_required": true,
+		})
+		return false
+	}
 	if err != nil {
+		log.Printf("❌ Ошибка создания сессии: %v", err)
 		http.Error(w, `{"error": "Error generating token"}`, http.StatusInternalServerError)
-		return
+		return false
 	}
 
 	// ✅ Формируем JSON-ответ
-	response := map[string]string{
-		"email": dbUser.Email,
-		"role":  dbUser.Role,
-		"token": token,
+	response := map[string]interface{}{
+		"email":         email,
+		"role":          role,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	}
+	// Напоминаем о запланированном удалении аккаунта, чтобы его можно было отменить
+	var deletionScheduledFor sql.NullTime
+	if err := database().QueryRow(`SELECT deletion_scheduled_for FROM users WHERE user_id = $1`, userID).
+		Scan(&deletionScheduledFor); err == nil && deletionScheduledFor.Valid {
+		response["deletion_scheduled_for"] = deletionScheduledFor.Time
+	}
+	// Роли с административными разрешениями без 2FA нужно её настроить, иначе админ-функции недоступны
+	if !mfa && isPrivilegedRole(role) {
+		response["mfa_enrollment_required"] = true
 	}
 
 	// ✅ Сначала кодируем JSON, а затем устанавливаем статус
@@ -183,17 +300,40 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
 		http.Error(w, `{"error": "Error encoding response"}`, http.StatusInternalServerError)
-		return
+		return true
 	}
 
-	log.Printf("📩 Ответ сервера отправлен: %+v\n", response)
+	log.Printf("📩 Пользователь вошёл: %s", email)
+	return true
 }
 
-// Проверка 4-значного кода
-func VerifyCode(w http.ResponseWriter, r *http.Request) {
-	// Указываем, что ответ будет JSON
+// Настройки проверки кода верификации читаются при каждом вызове: .env
+// загружается уже после инициализации пакета
+
+// verificationCodeTTL — срок действия кода верификации
+func verificationCodeTTL() time.Duration {
+	return envConfig.Duration("VERIFICATION_CODE_TTL", 15*time.Minute)
+}
+
+// verificationMaxAttempts — сколько раз можно ввести код, прежде чем запросить новый
+func verificationMaxAttempts() int {
+	return envConfig.Int("VERIFICATION_MAX_ATTEMPTS", 5)
+}
+
+// verificationResendPeriod — пауза между повторными отправками кода
+func verificationResendPeriod() time.Duration {
+	return envConfig.Duration("VERIFICATION_RESEND_COOLDOWN", time.Minute)
+}
+
+// respondJSON отправляет JSON-ответ с указанным статусом
+func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
 
+// Проверка кода верификации
+func VerifyCode(w http.ResponseWriter, r *http.Request) {
 	var request struct {
 		Email string `json:"email"`
 		Code  string `json:"code"`
@@ -202,54 +342,142 @@ func VerifyCode(w http.ResponseWriter, r *http.Request) {
 	// Декодируем JSON-запрос
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		log.Println("❌ Ошибка декодирования JSON:", err)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON format"})
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
 		return
 	}
 
-	log.Printf("🔍 Проверка кода: Email=%s, Code=%s", request.Email, request.Code)
-
-	// Проверяем, есть ли email в БД
-	var username string
-	query := `SELECT name FROM users WHERE email=$1`
-	err := databaseConnector.ConnectBD().QueryRow(query, request.Email).Scan(&username)
+	log.Printf("🔍 Проверка кода для: %s", request.Email)
 
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		username   string
+		isVerified bool
+		storedCode sql.NullString
+		expiresAt  sql.NullTime
+		attempts   int
+	)
+	// FOR UPDATE: параллельные запросы с одним email проверяются по очереди,
+	// и каждый видит счётчик попыток, увеличенный предыдущим
+	query := `SELECT name, is_verified, verification_code, verification_code_expires_at, verification_attempts
+	          FROM users WHERE email=$1 FOR UPDATE`
+	err = tx.QueryRow(query, request.Email).Scan(&username, &isVerified, &storedCode, &expiresAt, &attempts)
+	if err == sql.ErrNoRows {
+		// Для неизвестного email отвечаем так же, как для неверного кода
+		log.Printf("⚠️ Email не найден: %s", request.Email)
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid verification code"})
+		return
+	}
 	if err != nil {
-		log.Printf("⚠️ Email не найден: %s, но продолжаем", request.Email)
+		log.Printf("❌ Ошибка БД при проверке кода: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	if isVerified {
+		respondJSON(w, http.StatusOK, map[string]string{
+			"message":  "Email already verified.",
+			"username": username,
+		})
+		return
+	}
+
+	if attempts >= verificationMaxAttempts() {
+		log.Printf("⛔ Превышено число попыток для: %s", request.Email)
+		respondJSON(w, http.StatusTooManyRequests, map[string]string{"error": "Too many failed attempts, request a new code"})
+		return
+	}
+
+	if !storedCode.Valid || !expiresAt.Valid || time.Now().After(expiresAt.Time) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Verification code expired, request a new one"})
+		return
+	}
 
-		// Разрешаем вход даже если email не найден
-		username = request.Email
+	if subtle.ConstantTimeCompare([]byte(storedCode.String), []byte(request.Code)) != 1 {
+		_, err = tx.Exec(`UPDATE users SET verification_attempts = verification_attempts + 1 WHERE email=$1`, request.Email)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			log.Printf("❌ Ошибка обновления счётчика попыток для: %s", request.Email)
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			return
+		}
+		log.Printf("⚠️ Неверный код для: %s (попытка %d)", request.Email, attempts+1)
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid verification code"})
+		return
 	}
 
-	// ✅ Устанавливаем is_verified = TRUE (не проверяем, есть ли email)
-	_, err = databaseConnector.ConnectBD().Exec(`UPDATE users SET is_verified=TRUE WHERE email=$1`, request.Email)
+	_, err = tx.Exec(`UPDATE users
+		SET is_verified=TRUE, verification_code=NULL, verification_code_expires_at=NULL, verification_attempts=0
+		WHERE email=$1`, request.Email)
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		log.Printf("❌ Ошибка обновления БД для: %s", request.Email)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Database update failed"})
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database update failed"})
 		return
 	}
 
-	// ✅ Всегда успешный ответ
-	log.Printf("✅ Успешно зарегистрирован: %s", request.Email)
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
+	log.Printf("✅ Email подтверждён: %s", request.Email)
+	respondJSON(w, http.StatusOK, map[string]string{
 		"message":  "Verification successful! You are now logged in.",
 		"username": username,
 	})
 }
 
-func Logout(w http.ResponseWriter, r *http.Request) {
-	// Очищаем cookie с токеном
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    "",
-		Expires:  time.Unix(0, 0),
-		HttpOnly: true,
-		Path:     "/",
-	})
+// Повторная отправка кода верификации
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Email == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Email is required"})
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+	// Одинаковый ответ для неизвестных, уже подтверждённых адресов и повторных
+	// запросов раньше окончания паузы: по ответу нельзя узнать, есть ли аккаунт
+	response := map[string]string{"message": "If the account is awaiting verification, a new code has been sent."}
+
+	code, err := GenerateVerificationCode()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error generating verification code"})
+		return
+	}
+
+	// Проверка паузы и замена кода — одним запросом, чтобы параллельные запросы
+	// не отправили несколько кодов
+	res, err := database().Exec(`UPDATE users
+		SET verification_code=$1, verification_code_expires_at=$2, verification_attempts=0, verification_sent_at=NOW()
+		WHERE email=$3 AND NOT is_verified
+		  AND (verification_sent_at IS NULL OR verification_sent_at <= NOW() - $4 * INTERVAL '1 second')`,
+		code, time.Now().Add(verificationCodeTTL()), request.Email, int(verificationResendPeriod().Seconds()))
+	if err != nil {
+		log.Printf("❌ Ошибка БД при обновлении кода: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database update failed"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondJSON(w, http.StatusOK, response)
+		return
+	}
+
+	message, err := verificationEmail(emailPreferences(request.Email).Locale, code)
+	if err == nil {
+		err = emails().SendSensitiveEmail([]string{request.Email}, message.Subject, message.HTML, message.Text)
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка отправки кода подтверждения: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to send verification email"})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, response)
 }
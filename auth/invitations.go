@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"HabitMaster/emailTemplates"
+	"HabitMaster/envConfig"
+
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Режимы регистрации (REGISTRATION_MODE)
+const (
+	RegistrationOpen   = "open"   // регистрироваться может кто угодно
+	RegistrationInvite = "invite" // только по приглашению администратора
+	RegistrationClosed = "closed" // новые аккаунты создаёт только администратор
+)
+
+// invitationTTL — срок действия приглашения по умолчанию
+func invitationTTL() time.Duration {
+	return envConfig.Duration("INVITATION_TTL", 7*24*time.Hour)
+}
+
+var (
+	errRegistrationClosed = errors.New("registration is closed")
+	errInvitationRequired = errors.New("an invitation is required to register")
+	errInvitationInvalid  = errors.New("invitation is invalid, expired or issued for another email")
+)
+
+// ParseRegistrationMode разбирает значение REGISTRATION_MODE. Пустое значение — открытая
+// регистрация; при опечатке регистрация закрывается, чтобы не открыть её случайно.
+func ParseRegistrationMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "":
+		return RegistrationOpen, nil
+	case RegistrationOpen, RegistrationInvite, RegistrationClosed:
+		return mode, nil
+	default:
+		return RegistrationClosed, fmt.Errorf("unknown registration mode %q", value)
+	}
+}
+
+// registrationMode — текущий режим регистрации
+func registrationMode() string {
+	mode, err := ParseRegistrationMode(os.Getenv("REGISTRATION_MODE"))
+	if err != nil {
+		log.Printf("⚠️ %v, регистрация закрыта", err)
+	}
+	return mode
+}
+
+// checkRegistrationAllowed — можно ли зарегистрироваться с таким кодом приглашения
+func checkRegistrationAllowed(mode, invite string) error {
+	switch {
+	case mode == RegistrationClosed:
+		return errRegistrationClosed
+	case mode == RegistrationInvite && invite == "":
+		return errInvitationRequired
+	}
+	return nil
+}
+
+// Invitation — приглашение на регистрацию
+type Invitation struct {
+	ID         int        `json:"id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Status     string     `json:"status"`
+	CreatedBy  *int       `json:"created_by,omitempty"`
+	AcceptedBy *int       `json:"accepted_by,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// invitationStatusSQL вычисляет статус приглашения в запросах
+const invitationStatusSQL = `CASE
+		WHEN accepted_at IS NOT NULL THEN 'accepted'
+		WHEN revoked_at IS NOT NULL THEN 'revoked'
+		WHEN expires_at <= NOW() THEN 'expired'
+		ELSE 'pending' END`
+
+// acceptInvitation погашает приглашение с кодом code для адреса email и возвращает
+// заранее назначенную роль. Пустой code — поиск действующего приглашения по адресу
+// (вход через OIDC, где код передать негде).
+func acceptInvitation(tx *sql.Tx, code, email string, userID int) (role string, err error) {
+	var id int
+	var invitedEmail string
+	query := `SELECT id, email, role FROM invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW() FOR UPDATE`
+	arg := hashToken(code)
+	if code == "" {
+		query = `SELECT id, email, role FROM invitations
+			WHERE LOWER(email) = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+			ORDER BY created_at DESC LIMIT 1 FOR UPDATE`
+		arg = strings.ToLower(strings.TrimSpace(email))
+	}
+	err = tx.QueryRow(query, arg).Scan(&id, &invitedEmail, &role)
+	if err == sql.ErrNoRows {
+		return "", errInvitationInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(invitedEmail, strings.TrimSpace(email)) {
+		return "", errInvitationInvalid
+	}
+
+	_, err = tx.Exec(`UPDATE invitations SET accepted_at = NOW(), accepted_by = $1 WHERE id = $2`, userID, id)
+	if err == nil {
+		log.Printf("✉️ Приглашение %d принято пользователем %d", id, userID)
+	}
+	return role, err
+}
+
+// sendInvitationEmail отправляет ссылку для регистрации по приглашению
+func sendInvitationEmail(email, link string, expiresAt time.Time) {
+	prefs := emailPreferences(email)
+	err := sendTemplate(email, prefs.Locale, emailTemplates.Invitation, emailTemplates.Data{
+		"Link":      link,
+		"ExpiresAt": expiresAt.In(prefs.Location()).Format(emailTimeFormat),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка отправки приглашения: %v", err)
+		return
+	}
+	log.Printf("✅ Приглашение отправлено: %s", email)
+}
+
+// CreateInvitation — POST /api/admin/invitations, создаёт одноразовое приглашение
+// для email с заранее назначенной ролью. Код и ссылка возвращаются один раз;
+// если send_email не false, ссылка отправляется на адрес приглашённого.
+func CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	var request struct {
+		Email         string `json:"email"`
+		Role          string `json:"role"`
+		ExpiresInDays int    `json:"expires_in_days"`
+		SendEmail     *bool  `json:"send_email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
+		return
+	}
+	email, ok := NormalizeEmail(request.Email)
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "A valid email is required"})
+		return
+	}
+	if request.Role == "" {
+		request.Role = RoleUser
+	}
+	if known, err := RoleExists(database(), request.Role); err != nil || !known {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown role"})
+		return
+	}
+	if allowed, err := CanGrantRole(principal.Role, request.Role); err != nil || !allowed {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "You cannot invite users with a role that has permissions you do not have"})
+		return
+	}
+	if request.ExpiresInDays < 0 || request.ExpiresInDays > 90 {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "expires_in_days must be between 1 and 90"})
+		return
+	}
+	if taken, err := emailTaken(database(), email, 0); err != nil || taken {
+		if err != nil {
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		} else {
+			respondJSON(w, http.StatusConflict, map[string]string{"error": "A user with this email already exists"})
+		}
+		return
+	}
+
+	code, hash, err := generateToken()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to generate invitation"})
+		return
+	}
+	expiresAt := time.Now().Add(invitationTTL())
+	if request.ExpiresInDays > 0 {
+		expiresAt = time.Now().AddDate(0, 0, request.ExpiresInDays)
+	}
+
+	created := Invitation{Email: email, Role: request.Role, Status: "pending", CreatedBy: &principal.UserID, ExpiresAt: expiresAt}
+	err = database().QueryRow(`INSERT INTO invitations (email, role, token_hash, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		email, created.Role, hash, principal.UserID, expiresAt).Scan(&created.ID, &created.CreatedAt)
+	if err != nil {
+		log.Printf("❌ Ошибка создания приглашения: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	link := appURL("/register.html?" + url.Values{"invite": {code}, "email": {email}}.Encode())
+	if request.SendEmail == nil || *request.SendEmail {
+		go sendInvitationEmail(email, link, expiresAt)
+	}
+
+	log.Printf("✉️ Администратор %d пригласил %s с ролью %s", principal.UserID, email, created.Role)
+	respondJSON(w, http.StatusCreated, struct {
+		Invitation
+		Code string `json:"code"`
+		Link string `json:"link"`
+	}{created, code, link})
+}
+
+// ListInvitations — GET /api/admin/invitations?status=pending|accepted|revoked|expired
+func ListInvitations(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", "pending", "accepted", "revoked", "expired":
+	default:
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid status filter"})
+		return
+	}
+
+	rows, err := database().Query(`SELECT * FROM (
+			SELECT id, email, role, `+invitationStatusSQL+` AS status, created_by, accepted_by,
+				expires_at, accepted_at, revoked_at, created_at
+			FROM invitations) i
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC LIMIT 200`, status)
+	if err != nil {
+		log.Printf("❌ Ошибка получения приглашений: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var inv Invitation
+		var createdBy, acceptedBy sql.NullInt64
+		var acceptedAt, revokedAt sql.NullTime
+		if err := rows.Scan(&inv.ID, &inv.Email, &inv.Role, &inv.Status, &createdBy, &acceptedBy,
+			&inv.ExpiresAt, &acceptedAt, &revokedAt, &inv.CreatedAt); err != nil {
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			return
+		}
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			inv.CreatedBy = &id
+		}
+		if acceptedBy.Valid {
+			id := int(acceptedBy.Int64)
+			inv.AcceptedBy = &id
+		}
+		if acceptedAt.Valid {
+			inv.AcceptedAt = &acceptedAt.Time
+		}
+		if revokedAt.Valid {
+			inv.RevokedAt = &revokedAt.Time
+		}
+		invitations = append(invitations, inv)
+	}
+	respondJSON(w, http.StatusOK, invitations)
+}
+
+// RevokeInvitation — DELETE /api/admin/invitations/{id}, отзывает неиспользованное приглашение
+func RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	invitationID, ok := pathInt(r, "id")
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid invitation id"})
+		return
+	}
+
+	res, err := database().Exec(`UPDATE invitations SET revoked_at = NOW()
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL`, invitationID)
+	if err != nil {
+		log.Printf("❌ Ошибка отзыва приглашения: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Pending invitation not found"})
+		return
+	}
+
+	principal, _ := PrincipalFromContext(r.Context())
+	log.Printf("✉️ Администратор %d отозвал приглашение %d", principal.UserID, invitationID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Invitation revoked"})
+}
+
+// RegistrationInfo — GET /auth/registration, режим регистрации для страницы регистрации
+func RegistrationInfo(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]string{"mode": registrationMode()})
+}
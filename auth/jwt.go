@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"HabitMaster/envConfig"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// accessTokenTTL — время жизни токена доступа
+func accessTokenTTL() time.Duration {
+	return envConfig.Duration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// Claims — единый набор данных JWT-токена HabitMaster
+type Claims struct {
+	UserID    int    `json:"user_id"`
+	SessionID int    `json:"sid"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	MFA       bool   `json:"mfa,omitempty"` // вход подтверждён вторым фактором
+	jwt.StandardClaims
+}
+
+// signingKey — общий секрет SECRET_KEY: подпись HS256, ссылки для входа и шифрование
+// ключей подписи. Читается при каждом вызове, потому что .env загружается уже после
+// инициализации пакета.
+func signingKey() ([]byte, error) {
+	secret := os.Getenv("SECRET_KEY")
+	if secret == "" {
+		return nil, errors.New("SECRET_KEY is not configured")
+	}
+	return []byte(secret), nil
+}
+
+// IssueToken подписывает короткоживущий токен доступа для сессии пользователя
+// активным ключом из набора ключей подписи
+func IssueToken(userID, sessionID int, email, role string, mfa bool) (string, time.Time, error) {
+	keys, err := activeKeyring()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(accessTokenTTL())
+	claims := &Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		Email:     email,
+		Role:      role,
+		MFA:       mfa,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   fmt.Sprint(userID),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+
+	token, err := keys.Sign(claims)
+	return token, expiresAt, err
+}
+
+// ParseToken проверяет подпись (ключ выбирается по kid) и срок действия токена
+func ParseToken(tokenString string) (*Claims, error) {
+	keys, err := activeKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	err = keys.Verify(tokenString, claims)
+	if err == errUnknownKeyID && rotation != nil && rotation.reloadForUnknownKey() {
+		keys, _ = activeKeyring()
+		claims = &Claims{}
+		err = keys.Verify(tokenString, claims)
+	}
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+	if claims.UserID == 0 {
+		return nil, errors.New("token has no user_id")
+	}
+	return claims, nil
+}
+
+// bearerToken извлекает токен из заголовка "Authorization: Bearer <token>"
+func bearerToken(authHeader string) (string, error) {
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" || parts[1] == "" {
+		return "", errors.New("invalid authorization header")
+	}
+	return parts[1], nil
+}
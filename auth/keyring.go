@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Алгоритмы подписи токенов доступа (JWT_SIGNING_ALG)
+const (
+	AlgHS256 = "HS256" // общий секрет SECRET_KEY, оставлен для совместимости
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA" // Ed25519
+)
+
+// legacyKeyID — kid ключа из SECRET_KEY; токены без kid проверяются им же
+const legacyKeyID = "legacy-hs256"
+
+// rsaKeyBits — размер ключей RS256
+const rsaKeyBits = 2048
+
+var errUnknownKeyID = errors.New("unknown signing key")
+
+// ParseSigningAlgorithm разбирает значение JWT_SIGNING_ALG; по умолчанию RS256
+func ParseSigningAlgorithm(value string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "":
+		return AlgRS256, nil
+	case "HS256":
+		return AlgHS256, nil
+	case "RS256":
+		return AlgRS256, nil
+	case "EDDSA", "ED25519":
+		return AlgEdDSA, nil
+	default:
+		return "", fmt.Errorf("unknown signing algorithm %q", value)
+	}
+}
+
+// signingMethodEd25519 — подпись EdDSA (Ed25519), которой нет в jwt-go v3
+type signingMethodEd25519 struct{}
+
+// SigningMethodEdDSA — метод подписи JWT "EdDSA"
+var SigningMethodEdDSA jwt.SigningMethod = signingMethodEd25519{}
+
+func init() {
+	jwt.RegisterSigningMethod(AlgEdDSA, func() jwt.SigningMethod { return SigningMethodEdDSA })
+}
+
+func (signingMethodEd25519) Alg() string { return AlgEdDSA }
+
+func (signingMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
+
+func (signingMethodEd25519) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// SigningKey — ключ подписи токенов доступа
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	RetiredAt *time.Time // с этого момента ключ только проверяет подписи
+	ExpiresAt *time.Time // после этого ключ удаляется
+
+	secret  []byte        // HS256
+	private crypto.Signer // RS256 и EdDSA
+}
+
+// LegacySigningKey — ключ HS256 из общего секрета
+func LegacySigningKey(secret []byte) *SigningKey {
+	return &SigningKey{ID: legacyKeyID, Algorithm: AlgHS256, secret: secret}
+}
+
+// GenerateSigningKey создаёт новый ключ RS256 или EdDSA со случайным kid
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("cannot generate %s signing key", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &SigningKey{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Algorithm: algorithm,
+		CreatedAt: time.Now(),
+		private:   private,
+	}, nil
+}
+
+// method — метод подписи jwt-go для ключа
+func (k *SigningKey) method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	case AlgEdDSA:
+		return SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+// signKey и verifyKey — ключи в том виде, который ждёт метод подписи
+func (k *SigningKey) signKey() interface{} {
+	if k.private != nil {
+		return k.private
+	}
+	return k.secret
+}
+
+func (k *SigningKey) verifyKey() interface{} {
+	if k.private != nil {
+		return k.private.Public()
+	}
+	return k.secret
+}
+
+// usable — ключ ещё не удалён по сроку
+func (k *SigningKey) usable(now time.Time) bool {
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// Keyring — набор ключей подписи: одним подписываются новые токены,
+// остальные только проверяют выпущенные ранее. Ключ выбирается по kid.
+// После создания набор не меняется: при ротации собирается новый.
+type Keyring struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewKeyring собирает набор ключей; active подписывает новые токены
+func NewKeyring(active *SigningKey, others ...*SigningKey) *Keyring {
+	k := &Keyring{active: active, keys: map[string]*SigningKey{active.ID: active}}
+	for _, key := range others {
+		k.keys[key.ID] = key
+	}
+	return k
+}
+
+// Active — ключ для подписи новых токенов
+func (k *Keyring) Active() *SigningKey {
+	return k.active
+}
+
+// Key ищет ключ по kid; пустой kid — токен, выпущенный до ротации ключей
+func (k *Keyring) Key(kid string) *SigningKey {
+	if kid == "" {
+		kid = legacyKeyID
+	}
+	key := k.keys[kid]
+	if key == nil || !key.usable(time.Now()) {
+		return nil
+	}
+	return key
+}
+
+// Sign подписывает claims активным ключом и указывает его kid в заголовке
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key := k.Active()
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey())
+}
+
+// Verify проверяет подпись ключом из kid и сроки действия токена. Алгоритм
+// токена должен совпадать с алгоритмом ключа: иначе открытый ключ RS256
+// можно было бы выдать за секрет HS256.
+func (k *Keyring) Verify(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key := k.Key(kid)
+		if key == nil {
+			return nil, errUnknownKeyID
+		}
+		if t.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return key.verifyKey(), nil
+	})
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Inner == errUnknownKeyID {
+		return errUnknownKeyID
+	}
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// JWK — открытый ключ в формате RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKSet — документ /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS — открытые ключи всех действующих асимметричных ключей.
+// Ключ HS256 не публикуется: по нему можно было бы подделать токен.
+func (k *Keyring) JWKS() JWKSet {
+	// Новые ключи первыми
+	now := time.Now()
+	var published []*SigningKey
+	for _, key := range k.keys {
+		if key.private != nil && key.usable(now) {
+			published = append(published, key)
+		}
+	}
+	sort.Slice(published, func(i, j int) bool { return published[i].CreatedAt.After(published[j].CreatedAt) })
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range published {
+		jwk := JWK{KeyID: key.ID, Algorithm: key.Algorithm, Use: "sig"}
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
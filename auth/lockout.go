@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"HabitMaster/emailTemplates"
+	"HabitMaster/envConfig"
+
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Причины в истории входов
+const (
+	loginOK                 = "ok"
+	loginMFARequired        = "mfa_required"
+	loginOIDC               = "oidc"
+	loginInvalidCredentials = "invalid_credentials"
+	loginInvalidMFACode     = "invalid_mfa_code"
+	loginNotVerified        = "email_not_verified"
+	loginAccountLocked      = "account_locked"
+	loginIPThrottled        = "ip_throttled"
+	loginResetRequired      = "password_reset_required"
+)
+
+// loginLockoutThreshold — сколько неудачных попыток подряд допускается до блокировки аккаунта
+func loginLockoutThreshold() int {
+	return envConfig.Int("LOGIN_LOCKOUT_THRESHOLD", 5)
+}
+
+// loginIPThreshold — сколько неудачных попыток с одного IP допускается за loginIPWindow
+func loginIPThreshold() int {
+	return envConfig.Int("LOGIN_IP_THRESHOLD", 20)
+}
+
+// loginIPWindow — окно подсчёта неудачных попыток с одного IP
+func loginIPWindow() time.Duration {
+	return envConfig.Duration("LOGIN_IP_WINDOW", 15*time.Minute)
+}
+
+// loginBackoffBase и loginBackoffMax — первая и максимальная задержка; каждая
+// следующая неудачная попытка сверх порога удваивает задержку
+func loginBackoffBase() time.Duration {
+	return envConfig.Duration("LOGIN_BACKOFF_BASE", time.Minute)
+}
+
+func loginBackoffMax() time.Duration {
+	return envConfig.Duration("LOGIN_BACKOFF_MAX", time.Hour)
+}
+
+// LockoutDuration — задержка после failures неудачных попыток: 0 до порога,
+// затем base, 2*base, 4*base... но не больше max
+func LockoutDuration(failures, threshold int, base, max time.Duration) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	exponent := failures - threshold
+	if exponent > 30 {
+		return max
+	}
+	d := time.Duration(float64(base) * math.Pow(2, float64(exponent)))
+	if d > max || d <= 0 {
+		return max
+	}
+	return d
+}
+
+// recordLoginAttempt записывает попытку входа в историю
+func recordLoginAttempt(r *http.Request, userID int, email string, success bool, reason string) {
+	var user sql.NullInt64
+	if userID > 0 {
+		user = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+	_, err := database().Exec(`INSERT INTO login_attempts (user_id, email, ip, user_agent, success, reason)
+		VALUES ($1, $2, $3, $4, $5, $6)`, user, email, clientIP(r), r.UserAgent(), success, reason)
+	if err != nil {
+		log.Printf("⚠️ Не удалось записать попытку входа: %v", err)
+	}
+}
+
+// ipRetryAfter — сколько ещё ждать клиенту с этого IP после серии неудачных попыток
+func ipRetryAfter(r *http.Request) time.Duration {
+	var failures int
+	var lastFailure sql.NullTime
+	err := database().QueryRow(`SELECT COUNT(*), MAX(created_at) FROM login_attempts
+		WHERE ip = $1 AND NOT success AND reason IN ($2, $3) AND created_at > $4`,
+		clientIP(r), loginInvalidCredentials, loginInvalidMFACode, time.Now().Add(-loginIPWindow())).
+		Scan(&failures, &lastFailure)
+	if err != nil {
+		log.Printf("⚠️ Ошибка проверки попыток входа с IP: %v", err)
+		return 0
+	}
+	if !lastFailure.Valid {
+		return 0
+	}
+	wait := time.Until(lastFailure.Time.Add(LockoutDuration(failures, loginIPThreshold(), loginBackoffBase(), loginBackoffMax())))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// accountRetryAfter — оставшееся время блокировки аккаунта
+func accountRetryAfter(lockedUntil sql.NullTime) time.Duration {
+	if !lockedUntil.Valid {
+		return 0
+	}
+	if wait := time.Until(lockedUntil.Time); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// respondTooManyAttempts отвечает 429 с заголовком Retry-After
+func respondTooManyAttempts(w http.ResponseWriter, wait time.Duration, message string) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	respondJSON(w, http.StatusTooManyRequests, map[string]string{"error": message})
+}
+
+// registerFailedLogin увеличивает счётчик неудачных попыток и блокирует аккаунт
+// по достижении порога. О первой блокировке в серии пользователь узнаёт по email.
+func registerFailedLogin(userID int, email string) {
+	var failures int
+	err := database().QueryRow(`UPDATE users SET failed_login_count = failed_login_count + 1
+		WHERE user_id = $1 RETURNING failed_login_count`, userID).Scan(&failures)
+	if err != nil {
+		log.Printf("❌ Ошибка обновления счётчика неудачных входов: %v", err)
+		return
+	}
+
+	lockout := LockoutDuration(failures, loginLockoutThreshold(), loginBackoffBase(), loginBackoffMax())
+	if lockout == 0 {
+		return
+	}
+	lockedUntil := time.Now().Add(lockout)
+	if _, err := database().Exec(`UPDATE users SET locked_until = $1 WHERE user_id = $2`, lockedUntil, userID); err != nil {
+		log.Printf("❌ Ошибка блокировки аккаунта: %v", err)
+		return
+	}
+
+	log.Printf("🔒 Аккаунт %d заблокирован на %s после %d неудачных попыток", userID, lockout, failures)
+	if failures == loginLockoutThreshold() {
+		go sendLockoutEmail(email, failures, lockedUntil)
+	}
+}
+
+// resetFailedLogins снимает блокировку после успешного входа или разблокировки администратором
+func resetFailedLogins(userID int) (int64, error) {
+	res, err := database().Exec(`UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// sendLockoutEmail предупреждает пользователя о блокировке аккаунта
+func sendLockoutEmail(email string, failures int, lockedUntil time.Time) {
+	prefs := emailPreferences(email)
+	err := sendTemplate(email, prefs.Locale, emailTemplates.AccountLocked, emailTemplates.Data{
+		"Failures":    failures,
+		"LockedUntil": lockedUntil.In(prefs.Location()).Format(emailTimeFormat),
+		"LoginURL":    appURL("/login.html"),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка отправки письма о блокировке: %v", err)
+		return
+	}
+	log.Printf("✅ Письмо о блокировке отправлено: %s", email)
+}
+
+// LoginAttempt — запись истории входов
+type LoginAttempt struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AdminUnlockUser — POST /api/admin/users/{id}/unlock, снимает блокировку входа
+func AdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathInt(r, "id")
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user id"})
+		return
+	}
+	if !requireManageable(w, r, userID) {
+		return
+	}
+
+	updated, err := resetFailedLogins(userID)
+	if err != nil {
+		log.Printf("❌ Ошибка разблокировки пользователя: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if updated == 0 {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+
+	principal, _ := PrincipalFromContext(r.Context())
+	log.Printf("🔓 Администратор %d разблокировал пользователя %d", principal.UserID, userID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "User unlocked"})
+}
+
+// AdminLoginHistory — GET /api/admin/users/{id}/logins, последние попытки входа пользователя
+func AdminLoginHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathInt(r, "id")
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user id"})
+		return
+	}
+
+	rows, err := database().Query(`SELECT id, email, ip, user_agent, success, reason, created_at
+		FROM login_attempts WHERE user_id = $1 ORDER BY created_at DESC LIMIT 100`, userID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения истории входов: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	attempts := []LoginAttempt{}
+	for rows.Next() {
+		var a LoginAttempt
+		if err := rows.Scan(&a.ID, &a.Email, &a.IP, &a.UserAgent, &a.Success, &a.Reason, &a.CreatedAt); err != nil {
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			return
+		}
+		attempts = append(attempts, a)
+	}
+	respondJSON(w, http.StatusOK, attempts)
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"HabitMaster/emailTemplates"
+	"HabitMaster/envConfig"
+
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// loginAlertTTL — сколько действует ссылка «это был не я» из письма о новом входе
+func loginAlertTTL() time.Duration {
+	return envConfig.Duration("LOGIN_ALERT_TTL", 7*24*time.Hour)
+}
+
+// userAgentVersion — номера версий в User-Agent: обновление браузера не делает устройство новым
+var userAgentVersion = regexp.MustCompile(`\d+([._]\d+)*`)
+
+// DeviceFingerprint — отпечаток устройства по User-Agent без номеров версий
+func DeviceFingerprint(userAgent string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(userAgentVersion.ReplaceAllString(userAgent, ""))), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:16])
+}
+
+// IPRange — сеть адреса: /24 для IPv4 и /48 для IPv6, чтобы смена адреса
+// у того же провайдера не считалась новым местом входа
+func IPRange(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// rememberDevice запоминает устройство и сеть входа и сообщает, встречались ли они
+// раньше. Новым считается вход с незнакомого устройства или из незнакомой сети;
+// самый первый вход пользователя новым не считается.
+func rememberDevice(userID int, r *http.Request) (fingerprint, ipRange string, isNew bool, err error) {
+	fingerprint, ipRange = DeviceFingerprint(r.UserAgent()), IPRange(clientIP(r))
+
+	var known, knownDevice, knownRange bool
+	err = database().QueryRow(`SELECT COUNT(*) > 0, COALESCE(BOOL_OR(fingerprint = $2), FALSE), COALESCE(BOOL_OR(ip_range = $3), FALSE)
+		FROM known_devices WHERE user_id = $1`, userID, fingerprint, ipRange).Scan(&known, &knownDevice, &knownRange)
+	if err != nil {
+		return fingerprint, ipRange, false, err
+	}
+
+	_, err = database().Exec(`INSERT INTO known_devices (user_id, fingerprint, ip_range, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, fingerprint, ip_range)
+		DO UPDATE SET user_agent = EXCLUDED.user_agent, ip = EXCLUDED.ip, last_seen_at = NOW()`,
+		userID, fingerprint, ipRange, r.UserAgent(), clientIP(r))
+	return fingerprint, ipRange, known && !(knownDevice && knownRange), err
+}
+
+// checkNewDevice вызывается после успешного входа: при входе с нового устройства
+// или из новой сети пользователю уходит письмо со ссылкой «это был не я»
+func checkNewDevice(r *http.Request, userID int, email string) {
+	fingerprint, ipRange, isNew, err := rememberDevice(userID, r)
+	if err != nil {
+		log.Printf("⚠️ Не удалось проверить устройство входа: %v", err)
+		return
+	}
+	if !isNew {
+		return
+	}
+
+	token, hash, err := generateToken()
+	if err == nil {
+		_, err = database().Exec(`INSERT INTO login_alerts (user_id, token_hash, fingerprint, ip_range, ip, user_agent, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			userID, hash, fingerprint, ipRange, clientIP(r), r.UserAgent(), time.Now().Add(loginAlertTTL()))
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка создания оповещения о входе: %v", err)
+		return
+	}
+
+	log.Printf("🆕 Вход пользователя %d с нового устройства или из новой сети: %s", userID, clientIP(r))
+	go sendNewDeviceEmail(email, token, time.Now(), clientIP(r), r.UserAgent())
+}
+
+// sendNewDeviceEmail сообщает о входе с нового устройства
+func sendNewDeviceEmail(email, token string, at time.Time, ip, userAgent string) {
+	if userAgent == "" {
+		userAgent = "unknown"
+	}
+	prefs := emailPreferences(email)
+	err := sendTemplate(email, prefs.Locale, emailTemplates.NewDevice, emailTemplates.Data{
+		"Time":   at.In(prefs.Location()).Format(emailTimeFormat),
+		"IP":     ip,
+		"Device": userAgent,
+		"Link":   appURL("/reset-password.html?" + url.Values{"not_me": {token}}.Encode()),
+		"TTL":    loginAlertTTL(),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка отправки письма о новом входе: %v", err)
+		return
+	}
+	log.Printf("✅ Письмо о новом входе отправлено: %s", email)
+}
+
+// ReportUnrecognizedLogin — POST /login/not-me, ссылка «это был не я» из письма о новом входе.
+// Завершает все сессии и API-токены, забывает подозрительное устройство и требует
+// сменить пароль: вход по паролю закрыт до сброса. В ответе — токен для сброса пароля.
+func ReportUnrecognizedLogin(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Token is required"})
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var alertID, userID int
+	var fingerprint, ipRange string
+	err = tx.QueryRow(`SELECT id, user_id, fingerprint, ip_range FROM login_alerts
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() FOR UPDATE`, hashToken(request.Token)).
+		Scan(&alertID, &userID, &fingerprint, &ipRange)
+	if err == sql.ErrNoRows {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired link"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка БД при обработке ссылки «это был не я»: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	_, err = tx.Exec(`UPDATE login_alerts SET used_at = NOW() WHERE id = $1`, alertID)
+	if err == nil {
+		err = RevokeAllAccess(tx, userID, "not_me")
+	}
+	if err == nil {
+		_, err = tx.Exec(`UPDATE users SET password_reset_required = TRUE, tokens_valid_after = NOW(), updated_at = NOW()
+			WHERE user_id = $1`, userID)
+	}
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM known_devices WHERE user_id = $1 AND (fingerprint = $2 OR ip_range = $3)`,
+			userID, fingerprint, ipRange)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка БД при обработке ссылки «это был не я»: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	resetToken, err := createPasswordReset(userID)
+	if err != nil {
+		log.Printf("❌ Ошибка создания токена сброса пароля: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create password reset"})
+		return
+	}
+
+	log.Printf("🚨 Пользователь %d не узнал вход: сессии завершены, требуется сброс пароля", userID)
+	respondJSON(w, http.StatusOK, map[string]string{
+		"message":     "All sessions have been signed out. Choose a new password to secure your account.",
+		"reset_token": resetToken,
+	})
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"HabitMaster/emailTemplates"
+	"HabitMaster/envConfig"
+
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Причины в истории входов для входа по ссылке
+const (
+	loginMagicLink        = "magic_link"
+	loginInvalidMagicLink = "invalid_magic_link"
+)
+
+// magicLinkTTL — срок действия ссылки для входа без пароля
+func magicLinkTTL() time.Duration {
+	return envConfig.Duration("MAGIC_LINK_TTL", 15*time.Minute)
+}
+
+// magicLinkCooldown — не чаще одной ссылки на пользователя за этот период
+func magicLinkCooldown() time.Duration {
+	return envConfig.Duration("MAGIC_LINK_COOLDOWN", time.Minute)
+}
+
+var errMagicLinkInvalid = errors.New("invalid magic link")
+
+// signMagicLink подписывает случайное значение ключом SECRET_KEY: ссылка имеет вид
+// «значение.подпись», поддельная ссылка отклоняется без обращения к БД
+func signMagicLink(nonce string) (string, error) {
+	key, err := signingKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("magic-link:" + nonce))
+	return nonce + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyMagicLink проверяет подпись и возвращает случайное значение из ссылки
+func verifyMagicLink(token string) (string, error) {
+	nonce, _, ok := strings.Cut(token, ".")
+	if !ok || nonce == "" {
+		return "", errMagicLinkInvalid
+	}
+	expected, err := signMagicLink(nonce)
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal([]byte(expected), []byte(token)) {
+		return "", errMagicLinkInvalid
+	}
+	return nonce, nil
+}
+
+// sendMagicLinkEmail отправляет ссылку для входа
+func sendMagicLinkEmail(email, token string) {
+	err := sendTemplate(email, emailPreferences(email).Locale, emailTemplates.MagicLink, emailTemplates.Data{
+		"Link": appURL("/login.html#" + url.Values{"magic_token": {token}}.Encode()),
+		"TTL":  magicLinkTTL(),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка отправки ссылки для входа: %v", err)
+		return
+	}
+	log.Printf("✅ Ссылка для входа отправлена: %s", email)
+}
+
+// RequestMagicLink — POST /login/magic, отправляет одноразовую ссылку для входа без пароля.
+// Ответ одинаковый независимо от того, существует ли email.
+func RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Email == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Email is required"})
+		return
+	}
+
+	response := map[string]string{"message": "If an account with this email exists, a sign-in link has been sent."}
+
+	var userID int
+	var email string
+	var lastSent sql.NullTime
+	err := database().QueryRow(`SELECT u.user_id, u.email, (SELECT MAX(created_at) FROM magic_links m WHERE m.user_id = u.user_id)
+		FROM users u WHERE LOWER(u.email) = LOWER($1)`, request.Email).Scan(&userID, &email, &lastSent)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("❌ Ошибка БД при запросе ссылки для входа: %v", err)
+		}
+		respondJSON(w, http.StatusOK, response)
+		return
+	}
+	if lastSent.Valid && time.Since(lastSent.Time) < magicLinkCooldown() {
+		respondJSON(w, http.StatusOK, response)
+		return
+	}
+
+	nonce, hash, err := generateToken()
+	if err == nil {
+		_, err = database().Exec(`INSERT INTO magic_links (user_id, token_hash, ip, expires_at) VALUES ($1, $2, $3, $4)`,
+			userID, hash, clientIP(r), time.Now().Add(magicLinkTTL()))
+	}
+	var token string
+	if err == nil {
+		token, err = signMagicLink(nonce)
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка создания ссылки для входа: %v", err)
+		respondJSON(w, http.StatusOK, response)
+		return
+	}
+
+	// Письмо отправляем в фоне, чтобы время ответа не выдавало существование аккаунта
+	go sendMagicLinkEmail(email, token)
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// ConsumeMagicLink — POST /login/magic/verify, завершает вход по ссылке из письма.
+// Ссылка открывает login.html, а та отправляет токен сюда: так почтовые сканеры,
+// которые переходят по ссылкам сами, не погасят её раньше пользователя.
+func ConsumeMagicLink(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Token is required"})
+		return
+	}
+
+	nonce, err := verifyMagicLink(request.Token)
+	if err != nil {
+		if err != errMagicLinkInvalid {
+			log.Printf("❌ Ошибка проверки ссылки для входа: %v", err)
+		}
+		recordLoginAttempt(r, 0, "", false, loginInvalidMagicLink)
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or expired sign-in link"})
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var email, role string
+	var totpEnabled bool
+	var lockedUntil sql.NullTime
+	err = tx.QueryRow(`SELECT u.user_id, u.email, u.role, u.totp_enabled, u.locked_until
+		FROM magic_links m JOIN users u ON u.user_id = m.user_id
+		WHERE m.token_hash = $1 AND m.used_at IS NULL AND m.expires_at > NOW()
+		FOR UPDATE OF m`, hashToken(nonce)).Scan(&userID, &email, &role, &totpEnabled, &lockedUntil)
+	if err == sql.ErrNoRows {
+		recordLoginAttempt(r, 0, "", false, loginInvalidMagicLink)
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or expired sign-in link"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка БД при входе по ссылке: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	if wait := accountRetryAfter(lockedUntil); wait > 0 {
+		recordLoginAttempt(r, userID, email, false, loginAccountLocked)
+		respondTooManyAttempts(w, wait, "Account is temporarily locked due to failed login attempts")
+		return
+	}
+
+	// Ссылка гасится вместе с остальными неиспользованными; переход по ней
+	// подтверждает владение адресом, поэтому email считается подтверждённым,
+	// а пароль неподтверждённого аккаунта, заданный при регистрации, сбрасывается
+	_, err = tx.Exec(`UPDATE magic_links SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err == nil {
+		err = claimUnverifiedAccount(tx, userID, "magic_link_claim")
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка БД при входе по ссылке: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	// Ссылка заменяет только пароль: с включённой 2FA нужен второй шаг
+	if totpEnabled {
+		mfaToken, err := createMFAChallenge(userID)
+		if err != nil {
+			log.Printf("❌ Ошибка создания MFA-запроса: %v", err)
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error generating token"})
+			return
+		}
+		recordLoginAttempt(r, userID, email, true, loginMFARequired)
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int(mfaChallengeTTL().Seconds()),
+		})
+		return
+	}
+
+	if writeLoginResponse(w, r, userID, email, role, false) {
+		recordLoginAttempt(r, userID, email, true, loginMagicLink)
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"HabitMaster/emailSender"
+	"HabitMaster/emailTemplates"
+	"HabitMaster/preferences"
+
+	"os"
+	"strings"
+	"sync"
+)
+
+// emailTimeFormat — формат даты и времени в письмах
+const emailTimeFormat = "2006-01-02 15:04 MST"
+
+var (
+	mailerMu sync.Mutex
+	mailer   emailSender.EmailSender
+)
+
+// SetEmailSender задаёт отправителя писем для авторизации (используется в main и тестах)
+func SetEmailSender(sender emailSender.EmailSender) {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	mailer = sender
+}
+
+// emails возвращает отправителя писем, по умолчанию — SMTP из окружения
+func emails() emailSender.EmailSender {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	if mailer == nil {
+		mailer = emailSender.NewEmailSender()
+	}
+	return mailer
+}
+
+// appURL — абсолютная ссылка на страницу приложения для писем
+func appURL(path string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// emailPreferences — настройки владельца адреса (язык и часовой пояс писем);
+// для незнакомого адреса — настройки по умолчанию
+func emailPreferences(email string) preferences.Preferences {
+	prefs, err := preferences.LoadByEmail(database(), email)
+	if err != nil {
+		return preferences.Default()
+	}
+	return prefs
+}
+
+// sendTemplate отправляет письмо из шаблона name на языке locale. Письма авторизации
+// несут коды и одноразовые ссылки, поэтому уходят как письма с секретом.
+func sendTemplate(to, locale, name string, data emailTemplates.Data) error {
+	message, err := emailTemplates.Render(name, locale, data)
+	if err != nil {
+		return err
+	}
+	return emails().SendSensitiveEmail([]string{to}, message.Subject, message.HTML, message.Text)
+}
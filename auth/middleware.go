@@ -1,45 +1,86 @@
 package auth
 
 import (
+	"database/sql"
 	"net/http"
-	"os"
 	"strings"
-
-	"github.com/dgrijalva/jwt-go"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
+// authenticate проверяет токен из заголовка Authorization и возвращает пользователя
+func authenticate(r *http.Request) (*Principal, string) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, "Unauthorized: Missing token"
+	}
 
-		if authHeader == "" {
-			http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-			return
-		}
+	tokenString, err := bearerToken(authHeader)
+	if err != nil {
+		return nil, "Unauthorized: Invalid token format"
+	}
+	if strings.HasPrefix(tokenString, apiTokenPrefix) {
+		return authenticateAPIToken(tokenString)
+	}
+
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return nil, "Unauthorized: Invalid token"
+	}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Unauthorized: Invalid token format", http.StatusUnauthorized)
+	// Сессия должна быть активной, а токен — выданным после последней смены пароля
+	var sessionActive bool
+	var validAfter sql.NullTime
+	err = database().QueryRow(`
+		SELECT s.revoked_at IS NULL, u.tokens_valid_after
+		FROM sessions s JOIN users u ON u.user_id = s.user_id
+		WHERE s.id = $1 AND s.user_id = $2`, claims.SessionID, claims.UserID).Scan(&sessionActive, &validAfter)
+	if err != nil || !sessionActive || (validAfter.Valid && claims.IssuedAt < validAfter.Time.Unix()) {
+		return nil, "Unauthorized: Token revoked"
+	}
+
+	touchSession(claims.SessionID)
+
+	return &Principal{UserID: claims.UserID, SessionID: claims.SessionID, Email: claims.Email, Role: claims.Role, MFA: claims.MFA}, ""
+}
+
+// AuthMiddleware пропускает только запросы с действительным токеном
+// и добавляет Principal в контекст
+func AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, problem := authenticate(r)
+		if principal == nil {
+			http.Error(w, problem, http.StatusUnauthorized)
 			return
 		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
 
-		tokenString := parts[1]
-		claims := &jwt.StandardClaims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			secretKey := os.Getenv("SECRET_KEY")
-			if secretKey == "" {
-				http.Error(w, "Server error: Missing SECRET_KEY", http.StatusInternalServerError)
-				return nil, nil
+// OptionalAuthMiddleware добавляет Principal, если передан действительный токен,
+// но пропускает и анонимные запросы
+func OptionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			if principal, _ := authenticate(r); principal != nil {
+				r = r.WithContext(WithPrincipal(r.Context(), principal))
 			}
-			return []byte(secretKey), nil
-		})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Unauthorized: Invalid token", http.StatusUnauthorized)
+// RequireMFA пропускает только сессии, подтверждённые вторым фактором.
+// Используется после AuthMiddleware.
+func RequireMFA(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !principal.MFA {
+			http.Error(w, "Forbidden: Two-factor authentication required", http.StatusForbidden)
 			return
 		}
-
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"HabitMaster/envConfig"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oidcStateTTL — сколько ждём возврата пользователя от провайдера
+func oidcStateTTL() time.Duration {
+	return envConfig.Duration("OIDC_STATE_TTL", 10*time.Minute)
+}
+
+// errOIDCEmailUnverified — провайдер не подтвердил email, связать аккаунт нельзя
+var errOIDCEmailUnverified = errors.New("email is not verified by the identity provider")
+
+var (
+	oidcMu     sync.Mutex
+	oidcCached *OIDCProvider
+)
+
+// oidcProvider — провайдер из переменных OIDC_*; nil, если вход через OIDC не настроен.
+// Ошибка discovery не кешируется, следующий запрос попробует снова.
+func oidcProvider() (*OIDCProvider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if oidcCached != nil {
+		return oidcCached, nil
+	}
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = appURL("/auth/oidc/callback")
+	}
+	provider, err := NewOIDCProvider(OIDCConfig{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	oidcCached = provider
+	return provider, nil
+}
+
+// redirectToLogin возвращает браузер на страницу входа с результатом во фрагменте URL,
+// чтобы токены не попадали в логи сервера и заголовок Referer
+func redirectToLogin(w http.ResponseWriter, r *http.Request, values url.Values) {
+	http.Redirect(w, r, appURL("/login.html")+"#"+values.Encode(), http.StatusFound)
+}
+
+// OIDCLogin — GET /auth/oidc/login, перенаправляет к провайдеру (authorization code + PKCE)
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, err := oidcProvider()
+	if err != nil {
+		log.Printf("❌ Ошибка настройки OIDC-провайдера: %v", err)
+		http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+	if provider == nil {
+		http.Error(w, "OIDC login is not configured", http.StatusNotFound)
+		return
+	}
+
+	state, stateHash, err := generateToken()
+	var nonce, verifier string
+	if err == nil {
+		nonce, _, err = generateToken()
+	}
+	if err == nil {
+		verifier, _, err = generateToken()
+	}
+	if err == nil {
+		_, err = database().Exec(`INSERT INTO oidc_states (state_hash, nonce, code_verifier, expires_at) VALUES ($1, $2, $3, $4)`,
+			stateHash, nonce, verifier, time.Now().Add(oidcStateTTL()))
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка начала OIDC-входа: %v", err)
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, provider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// OIDCCallback — GET /auth/oidc/callback, завершает вход через провайдера
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("⚠️ OIDC-провайдер вернул ошибку: %s", providerError)
+		redirectToLogin(w, r, url.Values{"error": {"Sign-in was cancelled or denied"}})
+		return
+	}
+
+	provider, err := oidcProvider()
+	if err != nil || provider == nil {
+		http.Error(w, "OIDC login is not configured", http.StatusNotFound)
+		return
+	}
+
+	// state одноразовый: удаляем его сразу при использовании
+	var nonce, verifier string
+	err = database().QueryRow(`DELETE FROM oidc_states WHERE state_hash = $1 AND expires_at > NOW()
+		RETURNING nonce, code_verifier`, hashToken(query.Get("state"))).Scan(&nonce, &verifier)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("❌ Ошибка БД при проверке OIDC state: %v", err)
+		}
+		redirectToLogin(w, r, url.Values{"error": {"Sign-in session expired, please try again"}})
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(query.Get("code"), verifier)
+	var claims *IDTokenClaims
+	if err == nil {
+		claims, err = provider.VerifyIDToken(rawIDToken, nonce)
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка OIDC-входа: %v", err)
+		redirectToLogin(w, r, url.Values{"error": {"Sign-in with the identity provider failed"}})
+		return
+	}
+
+	userID, email, role, totpEnabled, err := resolveOIDCUser(claims)
+	if err == errOIDCEmailUnverified {
+		redirectToLogin(w, r, url.Values{"error": {"Your email is not verified by the identity provider"}})
+		return
+	}
+	if err == errRegistrationClosed || err == errInvitationInvalid {
+		redirectToLogin(w, r, url.Values{"error": {"No HabitMaster account exists for this email and registration requires an invitation"}})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка связывания OIDC-аккаунта: %v", err)
+		redirectToLogin(w, r, url.Values{"error": {"Sign-in failed"}})
+		return
+	}
+
+	// Блокировка после подбора пароля действует и при входе через провайдера
+	var lockedUntil sql.NullTime
+	if err := database().QueryRow(`SELECT locked_until FROM users WHERE user_id = $1`, userID).Scan(&lockedUntil); err == nil {
+		if accountRetryAfter(lockedUntil) > 0 {
+			recordLoginAttempt(r, userID, email, false, loginAccountLocked)
+			redirectToLogin(w, r, url.Values{"error": {"Account is temporarily locked due to failed login attempts"}})
+			return
+		}
+	}
+
+	// Включённая 2FA действует и при входе через провайдера
+	if totpEnabled {
+		mfaToken, err := createMFAChallenge(userID)
+		if err != nil {
+			log.Printf("❌ Ошибка создания MFA-запроса: %v", err)
+			redirectToLogin(w, r, url.Values{"error": {"Sign-in failed"}})
+			return
+		}
+		recordLoginAttempt(r, userID, email, true, loginMFARequired)
+		redirectToLogin(w, r, url.Values{"mfa_required": {"true"}, "mfa_token": {mfaToken}})
+		return
+	}
+
+	tokens, err := startSession(r, userID, email, role, false)
+	if err == errPasswordResetRequired {
+		recordLoginAttempt(r, userID, email, false, loginResetRequired)
+		redirectToLogin(w, r, url.Values{"error": {"Password reset required. Use \"Forgot password\" to choose a new password."}})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка создания сессии: %v", err)
+		redirectToLogin(w, r, url.Values{"error": {"Sign-in failed"}})
+		return
+	}
+
+	recordLoginAttempt(r, userID, email, true, loginOIDC)
+	log.Printf("📩 Пользователь вошёл через OIDC: %s", email)
+	redirectToLogin(w, r, url.Values{
+		"email":         {email},
+		"role":          {role},
+		"token":         {tokens.AccessToken},
+		"refresh_token": {tokens.RefreshToken},
+	})
+}
+
+// resolveOIDCUser находит пользователя по связанной внешней учётной записи.
+// Новая учётная запись связывается с существующим пользователем по подтверждённому
+// email, иначе создаётся новый пользователь.
+func resolveOIDCUser(claims *IDTokenClaims) (userID int, email, role string, totpEnabled bool, err error) {
+	tx, err := database().Begin()
+	if err != nil {
+		return 0, "", "", false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		SELECT u.user_id, u.email, u.role, u.totp_enabled
+		FROM user_identities i JOIN users u ON u.user_id = i.user_id
+		WHERE i.issuer = $1 AND i.subject = $2`, claims.Issuer, claims.Subject).
+		Scan(&userID, &email, &role, &totpEnabled)
+	if err == nil {
+		_, err = tx.Exec(`UPDATE user_identities SET last_login_at = NOW() WHERE issuer = $1 AND subject = $2`,
+			claims.Issuer, claims.Subject)
+		if err == nil {
+			err = tx.Commit()
+		}
+		return userID, email, role, totpEnabled, err
+	}
+	if err != sql.ErrNoRows {
+		return 0, "", "", false, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, "", "", false, errOIDCEmailUnverified
+	}
+
+	err = tx.QueryRow(`SELECT user_id, email, role, totp_enabled FROM users WHERE LOWER(email) = LOWER($1) FOR UPDATE`,
+		claims.Email).Scan(&userID, &email, &role, &totpEnabled)
+	switch {
+	case err == sql.ErrNoRows:
+		// Новый пользователь: в режиме invite нужно действующее приглашение на этот адрес
+		mode := registrationMode()
+		if err = checkRegistrationAllowed(mode, ""); err != nil && err != errInvitationRequired {
+			return 0, "", "", false, err
+		}
+		userID, err = createOIDCUser(tx, claims)
+		email, role = claims.Email, "user"
+		if err == nil && mode == RegistrationInvite {
+			role, err = acceptInvitation(tx, "", claims.Email, userID)
+			if err == nil {
+				_, err = tx.Exec(`UPDATE users SET role = $1 WHERE user_id = $2`, role, userID)
+			}
+		}
+	case err == nil:
+		// Провайдер подтвердил владение адресом — подтверждение кодом больше не нужно
+		err = claimUnverifiedAccount(tx, userID, "oidc_claim")
+	}
+	if err != nil {
+		return 0, "", "", false, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at) VALUES ($1, $2, $3, $4, NOW())`,
+		userID, claims.Issuer, claims.Subject, claims.Email)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err == nil {
+		log.Printf("🔗 Внешняя учётная запись %s связана с пользователем %d", claims.Issuer, userID)
+	}
+	return userID, email, role, totpEnabled, err
+}
+
+// unusablePasswordHash — хеш случайного значения: по такому паролю войти нельзя,
+// пока пользователь не задаст свой через сброс пароля
+func unusablePasswordHash() (string, error) {
+	randomPassword, _, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// claimUnverifiedAccount подтверждает email, владение которым доказано не кодом,
+// а входом через провайдера или по ссылке из письма. Неподтверждённый аккаунт мог
+// заранее зарегистрировать кто-то другой со своим паролем, поэтому пароль заменяется
+// непригодным для входа, а все сессии и API-токены отзываются. Подтверждённый
+// аккаунт не меняется.
+func claimUnverifiedAccount(tx *sql.Tx, userID int, reason string) error {
+	var verified bool
+	err := tx.QueryRow(`SELECT is_verified FROM users WHERE user_id = $1 FOR UPDATE`, userID).Scan(&verified)
+	if err != nil || verified {
+		return err
+	}
+	hashedPassword, err := unusablePasswordHash()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE users SET is_verified = TRUE, verification_code = NULL, password = $1,
+			tokens_valid_after = NOW(), updated_at = NOW()
+		WHERE user_id = $2`, hashedPassword, userID)
+	if err == nil {
+		err = RevokeAllAccess(tx, userID, reason)
+	}
+	if err == nil {
+		log.Printf("🔐 Неподтверждённый аккаунт %d подтверждён владельцем адреса, прежний пароль сброшен", userID)
+	}
+	return err
+}
+
+// createOIDCUser создаёт подтверждённого пользователя без пароля:
+// в поле password хранится хеш случайного значения, войти по нему нельзя
+func createOIDCUser(tx *sql.Tx, claims *IDTokenClaims) (int, error) {
+	hashedPassword, err := unusablePasswordHash()
+	if err != nil {
+		return 0, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	var userID int
+	err = tx.QueryRow(`INSERT INTO users (name, email, password, role, is_verified, created_at, updated_at)
+		VALUES ($1, $2, $3, 'user', TRUE, NOW(), NOW()) RETURNING user_id`,
+		name, claims.Email, hashedPassword).Scan(&userID)
+	return userID, err
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"HabitMaster/emailTemplates"
+	"HabitMaster/envConfig"
+
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTTL — срок действия ссылки для сброса пароля
+func passwordResetTTL() time.Duration {
+	return envConfig.Duration("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// ForgotPassword отправляет одноразовую ссылку для сброса пароля.
+// Ответ одинаковый независимо от того, существует ли email.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Email == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Email is required"})
+		return
+	}
+
+	response := map[string]string{"message": "If an account with this email exists, a password reset link has been sent."}
+
+	var userID int
+	var email string
+	err := database().QueryRow(`SELECT user_id, email FROM users WHERE LOWER(email) = LOWER($1)`, request.Email).
+		Scan(&userID, &email)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("❌ Ошибка БД при запросе сброса пароля: %v", err)
+		}
+		respondJSON(w, http.StatusOK, response)
+		return
+	}
+
+	token, err := createPasswordReset(userID)
+	if err != nil {
+		log.Printf("❌ Ошибка создания токена сброса пароля: %v", err)
+		respondJSON(w, http.StatusOK, response)
+		return
+	}
+
+	// Письмо отправляем в фоне, чтобы время ответа не выдавало существование аккаунта
+	go sendPasswordResetEmail(email, token)
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// createPasswordReset сохраняет хеш нового токена и отменяет предыдущие
+func createPasswordReset(userID int) (string, error) {
+	token, hash, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`,
+		userID, hash, time.Now().Add(passwordResetTTL()))
+	if err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// sendPasswordResetEmail отправляет письмо со ссылкой для сброса пароля
+func sendPasswordResetEmail(email, token string) {
+	err := sendTemplate(email, emailPreferences(email).Locale, emailTemplates.PasswordReset, emailTemplates.Data{
+		"Link": appURL("/reset-password.html?token=" + url.QueryEscape(token)),
+		"TTL":  passwordResetTTL(),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка отправки письма для сброса пароля: %v", err)
+		return
+	}
+	log.Printf("✅ Письмо для сброса пароля отправлено: %s", email)
+}
+
+// ResetPassword устанавливает новый пароль по одноразовому токену
+// и делает недействительными все выданные ранее токены входа
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
+		return
+	}
+	if request.Token == "" || request.Password == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Token and password are required"})
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var email string
+	err = tx.QueryRow(`SELECT pr.user_id, u.email FROM password_resets pr JOIN users u ON u.user_id = pr.user_id
+		WHERE pr.token_hash = $1 AND pr.used_at IS NULL AND pr.expires_at > NOW()
+		FOR UPDATE OF pr`, hashToken(request.Token)).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка БД при сбросе пароля: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	if err := ValidatePassword(request.Password, email); err != nil {
+		respondPasswordError(w, err)
+		return
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error hashing password"})
+		return
+	}
+
+	if err = setPassword(tx, userID, string(hashedPassword), "password_reset"); err == nil {
+		_, err = tx.Exec(`UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка БД при сбросе пароля: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database update failed"})
+		return
+	}
+
+	log.Printf("✅ Пароль сброшен для пользователя %d", userID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset. Please log in again."})
+}
+
+// setPassword сохраняет новый хеш пароля, снимает требование сменить пароль
+// и отзывает все сессии и API-токены пользователя
+func setPassword(tx *sql.Tx, userID int, passwordHash, reason string) error {
+	_, err := tx.Exec(`UPDATE users SET password = $1, password_reset_required = FALSE, tokens_valid_after = NOW(), updated_at = NOW()
+		WHERE user_id = $2`, passwordHash, userID)
+	if err != nil {
+		return err
+	}
+	return RevokeAllAccess(tx, userID, reason)
+}
+
+// ChangePassword — POST /api/me/password, смена пароля с подтверждением текущего.
+// Как и после сброса, все сессии и API-токены отзываются и нужно войти заново.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
+		return
+	}
+	if request.CurrentPassword == "" || request.NewPassword == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Current and new password are required"})
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var email, passwordHash string
+	err = tx.QueryRow(`SELECT email, password FROM users WHERE user_id = $1 FOR UPDATE`, principal.UserID).
+		Scan(&email, &passwordHash)
+	if err != nil {
+		log.Printf("❌ Ошибка БД при смене пароля: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(request.CurrentPassword)) != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Current password is incorrect"})
+		return
+	}
+	if request.NewPassword == request.CurrentPassword {
+		respondPasswordError(w, &PasswordPolicyError{Violations: []PasswordViolation{
+			{Code: "unchanged", Message: "New password must differ from the current one"},
+		}})
+		return
+	}
+	if err := ValidatePassword(request.NewPassword, email); err != nil {
+		respondPasswordError(w, err)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error hashing password"})
+		return
+	}
+	if err = setPassword(tx, principal.UserID, string(hashedPassword), "password_change"); err == nil {
+		_, err = tx.Exec(`UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, principal.UserID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка БД при смене пароля: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database update failed"})
+		return
+	}
+
+	log.Printf("✅ Пользователь %d сменил пароль", principal.UserID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Password changed. Please log in again."})
+}
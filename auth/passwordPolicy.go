@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"HabitMaster/envConfig"
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes — bcrypt учитывает только первые 72 байта пароля
+const bcryptMaxBytes = 72
+
+// PasswordPolicy — требования к паролю
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// PasswordPolicyFromEnv — политика из переменных PASSWORD_MIN_LENGTH и PASSWORD_REQUIRE_*.
+// По умолчанию требуется только длина от 8 символов.
+func PasswordPolicyFromEnv() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:     envConfig.Int("PASSWORD_MIN_LENGTH", 8),
+		RequireUpper:  os.Getenv("PASSWORD_REQUIRE_UPPER") == "true",
+		RequireLower:  os.Getenv("PASSWORD_REQUIRE_LOWER") == "true",
+		RequireDigit:  os.Getenv("PASSWORD_REQUIRE_DIGIT") == "true",
+		RequireSymbol: os.Getenv("PASSWORD_REQUIRE_SYMBOL") == "true",
+	}
+}
+
+// PasswordViolation — одно нарушенное требование
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError — пароль не прошёл проверку; содержит все нарушения сразу
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// Check проверяет пароль на соответствие политике. email нужен, чтобы
+// запретить пароль, совпадающий с адресом или его частью до @.
+func (p PasswordPolicy) Check(password, email string) error {
+	var violations []PasswordViolation
+	add := func(code, message string) {
+		violations = append(violations, PasswordViolation{Code: code, Message: message})
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		add("too_short", fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > bcryptMaxBytes {
+		add("too_long", fmt.Sprintf("Password must be at most %d bytes long", bcryptMaxBytes))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		add("missing_upper", "Password must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		add("missing_lower", "Password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		add("missing_digit", "Password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		add("missing_symbol", "Password must contain a symbol")
+	}
+
+	if email != "" {
+		local := strings.SplitN(strings.ToLower(email), "@", 2)[0]
+		lowered := strings.ToLower(password)
+		if lowered == strings.ToLower(email) || (len(local) >= 3 && strings.Contains(lowered, local)) {
+			add("contains_email", "Password must not contain your email address")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// BreachedPasswords — локальный список скомпрометированных паролей в виде SHA-1.
+// Как в k-anonymity API Have I Been Pwned, хеш делится на префикс из 5 символов
+// и суффикс. Источник — либо один файл со строками «HASH[:COUNT]», либо каталог
+// с файлами по префиксам (имя файла — префикс, строки «SUFFIX[:COUNT]»).
+type BreachedPasswords struct {
+	dir      string
+	prefixes map[string]map[string]struct{}
+}
+
+// LoadBreachedPasswords открывает список из файла или каталога path
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &BreachedPasswords{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &BreachedPasswords{prefixes: make(map[string]map[string]struct{})}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash := hashFromLine(scanner.Text())
+		if len(hash) != sha1.Size*2 {
+			continue
+		}
+		prefix, suffix := hash[:5], hash[5:]
+		if list.prefixes[prefix] == nil {
+			list.prefixes[prefix] = make(map[string]struct{})
+		}
+		list.prefixes[prefix][suffix] = struct{}{}
+	}
+	return list, scanner.Err()
+}
+
+// hashFromLine достаёт хеш из строки «HASH:COUNT» в верхнем регистре
+func hashFromLine(line string) string {
+	hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	return strings.ToUpper(hash)
+}
+
+// Contains — встречается ли пароль в списке
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	if b.dir == "" {
+		_, found := b.prefixes[prefix][suffix]
+		return found, nil
+	}
+
+	f, err := os.Open(filepath.Join(b.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if hashFromLine(scanner.Text()) == suffix {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+var (
+	breachedMu   sync.Mutex
+	breachedPath string
+	breachedList *BreachedPasswords
+)
+
+// breachedPasswords — список из BREACHED_PASSWORDS_FILE; nil, если проверка не настроена.
+// Файл читается один раз и перечитывается только при смене пути.
+func breachedPasswords() *BreachedPasswords {
+	path := os.Getenv("BREACHED_PASSWORDS_FILE")
+	if path == "" {
+		return nil
+	}
+
+	breachedMu.Lock()
+	defer breachedMu.Unlock()
+	if path == breachedPath {
+		return breachedList
+	}
+	list, err := LoadBreachedPasswords(path)
+	if err != nil {
+		log.Printf("⚠️ Не удалось загрузить список скомпрометированных паролей %s: %v", path, err)
+		return nil
+	}
+	breachedPath, breachedList = path, list
+	return list
+}
+
+// ValidatePassword проверяет пароль по политике из окружения и по списку
+// скомпрометированных паролей. Нарушения возвращаются как *PasswordPolicyError.
+func ValidatePassword(password, email string) error {
+	err := PasswordPolicyFromEnv().Check(password, email)
+	var policyErr *PasswordPolicyError
+	if err != nil {
+		policyErr = err.(*PasswordPolicyError)
+	}
+
+	if list := breachedPasswords(); list != nil {
+		breached, checkErr := list.Contains(password)
+		if checkErr != nil {
+			log.Printf("⚠️ Ошибка проверки пароля по списку утечек: %v", checkErr)
+		}
+		if breached {
+			if policyErr == nil {
+				policyErr = &PasswordPolicyError{}
+			}
+			policyErr.Violations = append(policyErr.Violations, PasswordViolation{
+				Code:    "breached",
+				Message: "This password has appeared in a data breach, choose a different one",
+			})
+		}
+	}
+
+	if policyErr != nil {
+		return policyErr
+	}
+	return nil
+}
+
+// respondPasswordError отвечает 400 со списком нарушенных требований
+func respondPasswordError(w http.ResponseWriter, err error) {
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error":      "Password does not meet the requirements",
+		"violations": policyErr.Violations,
+	})
+}
@@ -0,0 +1,626 @@
+package auth
+
+import (
+	"HabitMaster/envConfig"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Разрешения. Роль пользователя хранится только в users.role, а что она
+// позволяет — в role_permissions; проверки на маршрутах идут по разрешениям.
+const (
+	PermAdminAccess         = "admin:access"
+	PermUsersRead           = "users:read"
+	PermUsersWrite          = "users:write"
+	PermUsersRoles          = "users:roles"
+	PermUsersSecurity       = "users:security"
+	PermInvitationsManage   = "invitations:manage"
+	PermRolesManage         = "roles:manage"
+	PermEmailSendMass       = "email:send_mass"
+	PermEmailSendAttachment = "email:send_attachment"
+	PermAuditRead           = "audit:read"
+	PermEmailOutbox         = "email:outbox"
+	PermEmailTemplates      = "email:templates"
+)
+
+// Permissions — все разрешения с описаниями
+var Permissions = map[string]string{
+	PermAdminAccess:         "Access the admin area (/api/admin/*) and the admin panel",
+	PermUsersRead:           "List and view users",
+	PermUsersWrite:          "Create, edit, verify and delete users",
+	PermUsersRoles:          "Assign and revoke user roles",
+	PermUsersSecurity:       "Manage other users' sessions, lockouts and login history",
+	PermInvitationsManage:   "Create, list and revoke invitations",
+	PermRolesManage:         "Create, edit and delete roles",
+	PermEmailSendMass:       "Send mass emails",
+	PermEmailSendAttachment: "Send emails with attachments",
+	PermAuditRead:           "View the log of emails sent by administrators",
+	PermEmailOutbox:         "Inspect the outgoing email queue and retry failed messages",
+	PermEmailTemplates:      "Preview email templates with sample data",
+}
+
+// Встроенные роли: user — без административных прав, admin — все разрешения
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+var (
+	errUnknownRole      = errors.New("role does not exist")
+	errRoleNotGrantable = errors.New("role grants permissions the actor does not have")
+)
+
+// ValidRoleName — допустимое имя роли: латиница в нижнем регистре, цифры, _ и -
+func ValidRoleName(name string) bool {
+	return roleNamePattern.MatchString(name)
+}
+
+// ValidatePermissions проверяет, что все разрешения известны и не повторяются
+func ValidatePermissions(permissions []string) error {
+	seen := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		if _, ok := Permissions[p]; !ok {
+			return fmt.Errorf("unknown permission %q", p)
+		}
+		if seen[p] {
+			return fmt.Errorf("duplicate permission %q", p)
+		}
+		seen[p] = true
+	}
+	return nil
+}
+
+// allPermissions — все разрешения в алфавитном порядке
+func allPermissions() []string {
+	result := make([]string, 0, len(Permissions))
+	for p := range Permissions {
+		result = append(result, p)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// rolePermissionsTTL — сколько кешируются разрешения ролей; изменения через API
+// сбрасывают кеш сразу, другим экземплярам сервера нужно до этого времени
+func rolePermissionsTTL() time.Duration {
+	return envConfig.Duration("ROLE_PERMISSIONS_TTL", 30*time.Second)
+}
+
+var (
+	permMu       sync.Mutex
+	permCache    map[string]map[string]bool
+	permLoadedAt time.Time
+)
+
+// invalidatePermissions сбрасывает кеш разрешений после изменения ролей
+func invalidatePermissions() {
+	permMu.Lock()
+	permCache = nil
+	permMu.Unlock()
+}
+
+// rolePermissions — разрешения роли. У admin всегда есть все разрешения,
+// чтобы его нельзя было случайно лишить доступа к управлению ролями.
+func rolePermissions(role string) (map[string]bool, error) {
+	if role == RoleAdmin {
+		all := make(map[string]bool, len(Permissions))
+		for p := range Permissions {
+			all[p] = true
+		}
+		return all, nil
+	}
+
+	permMu.Lock()
+	defer permMu.Unlock()
+	if permCache == nil || time.Since(permLoadedAt) > rolePermissionsTTL() {
+		rows, err := database().Query(`SELECT r.name, p.permission FROM role_permissions p JOIN roles r ON r.id = p.role_id`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		cache := make(map[string]map[string]bool)
+		for rows.Next() {
+			var name, permission string
+			if err := rows.Scan(&name, &permission); err != nil {
+				return nil, err
+			}
+			if cache[name] == nil {
+				cache[name] = make(map[string]bool)
+			}
+			cache[name][permission] = true
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		permCache, permLoadedAt = cache, time.Now()
+	}
+	return permCache[role], nil
+}
+
+// isPrivilegedRole — есть ли у роли хоть одно разрешение. Таким ролям,
+// как и администраторам, нужна двухфакторная аутентификация.
+func isPrivilegedRole(role string) bool {
+	permissions, err := rolePermissions(role)
+	if err != nil {
+		log.Printf("⚠️ Ошибка получения разрешений роли %s: %v", role, err)
+		return role == RoleAdmin
+	}
+	return len(permissions) > 0
+}
+
+// RequirePermission пропускает только пользователей, чья роль даёт разрешение
+// permission. Используется после AuthMiddleware.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			permissions, err := rolePermissions(principal.Role)
+			if err != nil {
+				log.Printf("❌ Ошибка проверки разрешений: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !permissions[permission] {
+				http.Error(w, "Forbidden: missing permission "+permission, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// adminPathPrefix — общий префикс маршрутов администрирования
+const adminPathPrefix = "/api/admin"
+
+// AdminAreaMiddleware закрывает все маршруты /api/admin*: нужен вход с 2FA
+// и разрешение admin:access. Разрешения конкретных действий проверяются на самих
+// маршрутах; эта проверка страхует маршруты, где их забыли. Используется после
+// OptionalAuthMiddleware.
+func AdminAreaMiddleware(next http.Handler) http.Handler {
+	guarded := RequirePermission(PermAdminAccess)(RequireMFA(next))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, adminPathPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		guarded.ServeHTTP(w, r)
+	})
+}
+
+// RoleExists — есть ли роль в справочнике
+func RoleExists(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, name string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)`, name).Scan(&exists)
+	return exists, err
+}
+
+// PermissionsWithin — есть ли все разрешения granted среди held
+func PermissionsWithin(granted, held map[string]bool) bool {
+	for p, ok := range granted {
+		if ok && !held[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// CanGrantRole — может ли пользователь с ролью actorRole назначать роль role
+// и управлять её обладателями. Роль admin — только администратор, остальные —
+// если у actorRole есть все их разрешения: узкая роль не выдаст больше, чем имеет сама.
+func CanGrantRole(actorRole, role string) (bool, error) {
+	if actorRole == RoleAdmin {
+		return true, nil
+	}
+	if role == RoleAdmin {
+		return false, nil
+	}
+	held, err := rolePermissions(actorRole)
+	if err != nil {
+		return false, err
+	}
+	granted, err := rolePermissions(role)
+	if err != nil {
+		return false, err
+	}
+	return PermissionsWithin(granted, held), nil
+}
+
+// CanManageUser — может ли пользователь с ролью actorRole изменять пользователя userID
+// (email, подтверждение, блокировка, сессии): его роль должна быть из тех, что actorRole
+// вправе выдавать. Для несуществующего пользователя возвращает sql.ErrNoRows.
+func CanManageUser(db *sql.DB, actorRole string, userID int) (bool, error) {
+	var role string
+	if err := db.QueryRow(`SELECT role FROM users WHERE user_id = $1`, userID).Scan(&role); err != nil {
+		return false, err
+	}
+	return CanGrantRole(actorRole, role)
+}
+
+// requireManageable отвечает 404/403, если пользователь userID не существует
+// или его роль шире роли текущего пользователя; false — обработку нужно прервать
+func requireManageable(w http.ResponseWriter, r *http.Request, userID int) bool {
+	var role string
+	if principal, ok := PrincipalFromContext(r.Context()); ok {
+		role = principal.Role
+	}
+	allowed, err := CanManageUser(database(), role, userID)
+	if err == sql.ErrNoRows {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return false
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка проверки прав на пользователя: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return false
+	}
+	if !allowed {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "You cannot manage a user with more permissions than you"})
+		return false
+	}
+	return true
+}
+
+// AssignRole назначает пользователю роль от имени пользователя с ролью actorRole.
+// Назначить можно только роль, которую actorRole вправе выдавать, и только
+// пользователю, чья текущая роль тоже не шире actorRole. Выданные токены доступа
+// с прежней ролью перестают действовать, новая роль попадёт в токен при обновлении.
+// Возвращает false, если у пользователя уже была эта роль или его нет.
+func AssignRole(db *sql.DB, actorRole string, userID int, role string) (bool, error) {
+	exists, err := RoleExists(db, role)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, errUnknownRole
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow(`SELECT role FROM users WHERE user_id = $1 FOR UPDATE`, userID).Scan(&current)
+	if err == sql.ErrNoRows || (err == nil && current == role) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, r := range []string{current, role} {
+		allowed, err := CanGrantRole(actorRole, r)
+		if err != nil {
+			return false, err
+		}
+		if !allowed {
+			return false, errRoleNotGrantable
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE users SET role = $1, tokens_valid_after = NOW(), updated_at = NOW() WHERE user_id = $2`,
+		role, userID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	return err == nil, err
+}
+
+// IsUnknownRole — ошибка AssignRole из-за несуществующей роли
+func IsUnknownRole(err error) bool {
+	return err == errUnknownRole
+}
+
+// IsRoleNotGrantable — ошибка AssignRole: роль шире прав назначающего
+func IsRoleNotGrantable(err error) bool {
+	return err == errRoleNotGrantable
+}
+
+// Role — роль с разрешениями
+type Role struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	BuiltIn     bool      `json:"built_in"`
+	Permissions []string  `json:"permissions"`
+	Users       int       `json:"users"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListPermissions — GET /api/admin/permissions, справочник разрешений
+func ListPermissions(w http.ResponseWriter, r *http.Request) {
+	type permission struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	result := []permission{}
+	for _, p := range allPermissions() {
+		result = append(result, permission{p, Permissions[p]})
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+// ListRoles — GET /api/admin/roles, роли с разрешениями и числом пользователей
+func ListRoles(w http.ResponseWriter, r *http.Request) {
+	rows, err := database().Query(`SELECT r.id, r.name, r.description, r.built_in, r.created_at,
+			COALESCE(ARRAY(SELECT permission FROM role_permissions p WHERE p.role_id = r.id ORDER BY permission), '{}'),
+			(SELECT COUNT(*) FROM users u WHERE u.role = r.name)
+		FROM roles r ORDER BY r.built_in DESC, r.name`)
+	if err != nil {
+		log.Printf("❌ Ошибка получения ролей: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.BuiltIn, &role.CreatedAt,
+			pq.Array(&role.Permissions), &role.Users); err != nil {
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			return
+		}
+		if role.Name == RoleAdmin {
+			role.Permissions = allPermissions()
+		}
+		roles = append(roles, role)
+	}
+	respondJSON(w, http.StatusOK, roles)
+}
+
+// roleRequest — тело запросов создания и изменения роли
+type roleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// setRolePermissions заменяет набор разрешений роли
+func setRolePermissions(tx *sql.Tx, roleID int, permissions []string) error {
+	if _, err := tx.Exec(`DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO role_permissions (role_id, permission) SELECT $1, unnest($2::TEXT[])`,
+		roleID, pq.Array(permissions))
+	return err
+}
+
+// actorHoldsPermissions проверяет, что у пользователя есть все разрешения, которые
+// он выдаёт роли; иначе отвечает 403. Администратор выдаёт любые разрешения.
+func actorHoldsPermissions(w http.ResponseWriter, r *http.Request, permissions []string) bool {
+	principal, _ := PrincipalFromContext(r.Context())
+	if principal.Role == RoleAdmin {
+		return true
+	}
+	held, err := rolePermissions(principal.Role)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return false
+	}
+	granted := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		granted[p] = true
+	}
+	if !PermissionsWithin(granted, held) {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "You cannot grant permissions you do not have"})
+		return false
+	}
+	return true
+}
+
+// CreateRole — POST /api/admin/roles {name, description, permissions}
+func CreateRole(w http.ResponseWriter, r *http.Request) {
+	var request roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if !ValidRoleName(request.Name) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Role name must be 2-32 lowercase letters, digits, _ or -"})
+		return
+	}
+	if err := ValidatePermissions(request.Permissions); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if !actorHoldsPermissions(w, r, request.Permissions) {
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var roleID int
+	err = tx.QueryRow(`INSERT INTO roles (name, description) VALUES ($1, $2)
+		ON CONFLICT (name) DO NOTHING RETURNING id`, request.Name, request.Description).Scan(&roleID)
+	if err == sql.ErrNoRows {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Role already exists"})
+		return
+	}
+	if err == nil {
+		err = setRolePermissions(tx, roleID, request.Permissions)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка создания роли: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	invalidatePermissions()
+
+	principal, _ := PrincipalFromContext(r.Context())
+	log.Printf("🛡️ Пользователь %d создал роль %s с разрешениями %v", principal.UserID, request.Name, request.Permissions)
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"id": roleID, "name": request.Name, "description": request.Description, "permissions": request.Permissions,
+	})
+}
+
+// loadCustomRole блокирует роль для изменения; встроенные роли менять нельзя
+func loadCustomRole(w http.ResponseWriter, tx *sql.Tx, name string) (int, bool) {
+	var roleID int
+	var builtIn bool
+	err := tx.QueryRow(`SELECT id, built_in FROM roles WHERE name = $1 FOR UPDATE`, name).Scan(&roleID, &builtIn)
+	switch {
+	case err == sql.ErrNoRows:
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Role not found"})
+	case err != nil:
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	case builtIn:
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "Built-in roles cannot be modified"})
+	default:
+		return roleID, true
+	}
+	return 0, false
+}
+
+// UpdateRole — PUT /api/admin/roles/{name} {description, permissions}, заменяет разрешения роли
+func UpdateRole(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var request roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON format"})
+		return
+	}
+	if err := ValidatePermissions(request.Permissions); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if !actorHoldsPermissions(w, r, request.Permissions) {
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	roleID, ok := loadCustomRole(w, tx, name)
+	if !ok {
+		return
+	}
+	_, err = tx.Exec(`UPDATE roles SET description = $1 WHERE id = $2`, request.Description, roleID)
+	if err == nil {
+		err = setRolePermissions(tx, roleID, request.Permissions)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка изменения роли: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	invalidatePermissions()
+
+	principal, _ := PrincipalFromContext(r.Context())
+	log.Printf("🛡️ Пользователь %d изменил роль %s: %v", principal.UserID, name, request.Permissions)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"id": roleID, "name": name, "description": request.Description, "permissions": request.Permissions,
+	})
+}
+
+// DeleteRole — DELETE /api/admin/roles/{name}; роль не должна быть назначена пользователям
+func DeleteRole(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	roleID, ok := loadCustomRole(w, tx, name)
+	if !ok {
+		return
+	}
+	var assigned int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE role = $1`, name).Scan(&assigned); err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if assigned > 0 {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("Role is assigned to %d users, revoke it first", assigned)})
+		return
+	}
+
+	_, err = tx.Exec(`DELETE FROM roles WHERE id = $1`, roleID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка удаления роли: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	invalidatePermissions()
+
+	principal, _ := PrincipalFromContext(r.Context())
+	log.Printf("🛡️ Пользователь %d удалил роль %s", principal.UserID, name)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Role deleted"})
+}
+
+// RevokeUserRole — DELETE /api/admin/users/{id}/role, возвращает пользователю роль user
+func RevokeUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathInt(r, "id")
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user id"})
+		return
+	}
+	principal, _ := PrincipalFromContext(r.Context())
+	if principal.UserID == userID {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "You cannot revoke your own role"})
+		return
+	}
+
+	var previous string
+	err := database().QueryRow(`SELECT role FROM users WHERE user_id = $1`, userID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+		return
+	}
+	if err == nil {
+		_, err = AssignRole(database(), principal.Role, userID, RoleUser)
+	}
+	if IsRoleNotGrantable(err) {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "You cannot change the role of a user with more permissions than you"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка отзыва роли: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	log.Printf("🛡️ Пользователь %d отозвал роль %s у пользователя %d", principal.UserID, previous, userID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Role revoked", "role": RoleUser})
+}
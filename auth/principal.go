@@ -0,0 +1,40 @@
+package auth
+
+import "context"
+
+// Principal — аутентифицированный пользователь текущего запроса
+type Principal struct {
+	UserID    int
+	SessionID int
+	Email     string
+	Role      string
+	MFA       bool
+	TokenID   int      // персональный API-токен; 0 — вход через сессию
+	Scopes    []string // области доступа API-токена
+}
+
+// HasScope — есть ли у пользователя доступ к области. Сессии ограничений не имеют.
+func (p *Principal) HasScope(scope string) bool {
+	if p.TokenID == 0 {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal добавляет пользователя в контекст запроса
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext возвращает пользователя, добавленный AuthMiddleware
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
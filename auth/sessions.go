@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"HabitMaster/envConfig"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// refreshTokenTTL — время жизни refresh-токена; каждый обмен выдаёт новый
+func refreshTokenTTL() time.Duration {
+	return envConfig.Duration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// errRefreshReused — предъявлен уже использованный refresh-токен
+var errRefreshReused = errors.New("refresh token reuse detected")
+
+// tokenPair — ответ с токеном доступа и refresh-токеном
+type tokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// clientIP — адрес клиента без порта
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// issueRefreshToken сохраняет хеш нового refresh-токена сессии
+func issueRefreshToken(tx *sql.Tx, sessionID int) (string, error) {
+	token, hash, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)`,
+		sessionID, hash, time.Now().Add(refreshTokenTTL()))
+	return token, err
+}
+
+// errPasswordResetRequired — пароль помечен скомпрометированным, вход закрыт до его сброса
+var errPasswordResetRequired = errors.New("password reset required")
+
+// startSession создаёт сессию для входа пользователя и выдаёт пару токенов.
+// Проверка password_reset_required здесь закрывает все способы входа: пароль,
+// ссылку для входа и внешнего провайдера.
+func startSession(r *http.Request, userID int, email, role string, mfa bool) (tokenPair, error) {
+	tx, err := database().Begin()
+	if err != nil {
+		return tokenPair{}, err
+	}
+	defer tx.Rollback()
+
+	var resetRequired bool
+	if err := tx.QueryRow(`SELECT password_reset_required FROM users WHERE user_id = $1`, userID).Scan(&resetRequired); err != nil {
+		return tokenPair{}, err
+	}
+	if resetRequired {
+		return tokenPair{}, errPasswordResetRequired
+	}
+
+	var sessionID int
+	err = tx.QueryRow(`INSERT INTO sessions (user_id, user_agent, ip, mfa) VALUES ($1, $2, $3, $4) RETURNING id`,
+		userID, r.UserAgent(), clientIP(r), mfa).Scan(&sessionID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	refreshToken, err := issueRefreshToken(tx, sessionID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return tokenPair{}, err
+	}
+	checkNewDevice(r, userID, email)
+
+	accessToken, _, err := IssueToken(userID, sessionID, email, role, mfa)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	return tokenPair{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: int(accessTokenTTL().Seconds())}, nil
+}
+
+// rotateRefreshToken обменивает refresh-токен на новую пару токенов.
+// Повторное использование токена отзывает всю сессию.
+func rotateRefreshToken(refreshToken string) (tokenPair, error) {
+	tx, err := database().Begin()
+	if err != nil {
+		return tokenPair{}, err
+	}
+	defer tx.Rollback()
+
+	var (
+		tokenID, sessionID, userID int
+		usedAt                     sql.NullTime
+		expiresAt                  time.Time
+		sessionActive, mfa         bool
+		email, role                string
+	)
+	err = tx.QueryRow(`
+		SELECT rt.id, rt.session_id, rt.used_at, rt.expires_at, s.revoked_at IS NULL, s.mfa, u.user_id, u.email, u.role
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.session_id
+		JOIN users u ON u.user_id = s.user_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s`, hashToken(refreshToken)).
+		Scan(&tokenID, &sessionID, &usedAt, &expiresAt, &sessionActive, &mfa, &userID, &email, &role)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	if usedAt.Valid {
+		// Токен уже обменивался — вероятно, он украден. Отзываем сессию целиком.
+		if _, err := tx.Exec(`UPDATE sessions SET revoked_at = NOW(), revoked_reason = 'refresh_token_reuse'
+			WHERE id = $1 AND revoked_at IS NULL`, sessionID); err != nil {
+			return tokenPair{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return tokenPair{}, err
+		}
+		log.Printf("⛔ Повторное использование refresh-токена, сессия %d отозвана", sessionID)
+		return tokenPair{}, errRefreshReused
+	}
+	if !sessionActive || time.Now().After(expiresAt) {
+		return tokenPair{}, sql.ErrNoRows
+	}
+
+	if _, err = tx.Exec(`UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, tokenID); err != nil {
+		return tokenPair{}, err
+	}
+	if _, err = tx.Exec(`UPDATE sessions SET last_seen_at = NOW() WHERE id = $1`, sessionID); err != nil {
+		return tokenPair{}, err
+	}
+	newRefreshToken, err := issueRefreshToken(tx, sessionID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return tokenPair{}, err
+	}
+
+	accessToken, _, err := IssueToken(userID, sessionID, email, role, mfa)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	return tokenPair{AccessToken: accessToken, RefreshToken: newRefreshToken, ExpiresIn: int(accessTokenTTL().Seconds())}, nil
+}
+
+// execer — общий интерфейс *sql.DB и *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// revokeSessions отзывает сессии пользователя: одну (sessionID > 0) или все
+func revokeSessions(exec execer, userID, sessionID int, reason string) (int64, error) {
+	query := `UPDATE sessions SET revoked_at = NOW(), revoked_reason = $2
+	          WHERE user_id = $1 AND revoked_at IS NULL`
+	args := []interface{}{userID, reason}
+	if sessionID > 0 {
+		query += ` AND id = $3`
+		args = append(args, sessionID)
+	}
+	res, err := exec.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RefreshToken обменивает refresh-токен на новую пару токенов
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "refresh_token is required"})
+		return
+	}
+
+	tokens, err := rotateRefreshToken(request.RefreshToken)
+	switch {
+	case err == nil:
+		respondJSON(w, http.StatusOK, tokens)
+	case err == sql.ErrNoRows || err == errRefreshReused:
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or expired refresh token"})
+	default:
+		log.Printf("❌ Ошибка обновления токена: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error refreshing token"})
+	}
+}
+
+// Logout отзывает текущую сессию
+func Logout(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	if _, err := revokeSessions(database(), principal.UserID, principal.SessionID, "logout"); err != nil {
+		log.Printf("❌ Ошибка отзыва сессии: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to log out"})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
+}
+
+// LogoutAll отзывает все сессии пользователя («выйти на всех устройствах»)
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	revoked, err := revokeSessions(database(), principal.UserID, 0, "logout_all")
+	if err != nil {
+		log.Printf("❌ Ошибка отзыва сессий: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to log out"})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":          "Logged out from all devices",
+		"revoked_sessions": revoked,
+	})
+}
+
+// Session — активная сессия (устройство) пользователя
+type Session struct {
+	ID         int       `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// touchSession обновляет время последней активности не чаще раза в минуту
+func touchSession(sessionID int) {
+	_, err := database().Exec(`UPDATE sessions SET last_seen_at = NOW()
+		WHERE id = $1 AND last_seen_at < NOW() - INTERVAL '1 minute'`, sessionID)
+	if err != nil {
+		log.Printf("⚠️ Не удалось обновить активность сессии %d: %v", sessionID, err)
+	}
+}
+
+// listSessions возвращает неотозванные сессии, которые ещё можно продлить
+func listSessions(userID, currentSessionID int) ([]Session, error) {
+	rows, err := database().Query(`
+		SELECT s.id, s.user_agent, s.ip, s.created_at, s.last_seen_at
+		FROM sessions s
+		WHERE s.user_id = $1 AND s.revoked_at IS NULL
+		  AND EXISTS (SELECT 1 FROM refresh_tokens rt
+		              WHERE rt.session_id = s.id AND rt.used_at IS NULL AND rt.expires_at > NOW())
+		ORDER BY s.last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		s.Current = s.ID == currentSessionID
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// pathInt читает числовой параметр маршрута
+func pathInt(r *http.Request, name string) (int, bool) {
+	value, err := strconv.Atoi(mux.Vars(r)[name])
+	return value, err == nil
+}
+
+// writeSessions отправляет список сессий пользователя
+func writeSessions(w http.ResponseWriter, userID, currentSessionID int) {
+	sessions, err := listSessions(userID, currentSessionID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения сессий: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve sessions"})
+		return
+	}
+	respondJSON(w, http.StatusOK, sessions)
+}
+
+// revokeSessionResponse отзывает одну сессию пользователя и отправляет результат
+func revokeSessionResponse(w http.ResponseWriter, userID, sessionID int, reason string) {
+	revoked, err := revokeSessions(database(), userID, sessionID, reason)
+	if err != nil {
+		log.Printf("❌ Ошибка отзыва сессии: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to revoke session"})
+		return
+	}
+	if revoked == 0 {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "Session not found"})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+}
+
+// ListSessions — GET /api/sessions, активные сессии текущего пользователя
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	writeSessions(w, principal.UserID, principal.SessionID)
+}
+
+// RevokeSession — DELETE /api/sessions/{id}, завершает одну из своих сессий
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	sessionID, ok := pathInt(r, "id")
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid session id"})
+		return
+	}
+	revokeSessionResponse(w, principal.UserID, sessionID, "user_revoked")
+}
+
+// AdminListSessions — GET /api/admin/users/{id}/sessions
+func AdminListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathInt(r, "id")
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user id"})
+		return
+	}
+	writeSessions(w, userID, 0)
+}
+
+// AdminRevokeSession — DELETE /api/admin/users/{id}/sessions/{sid}
+func AdminRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathInt(r, "id")
+	sessionID, okSession := pathInt(r, "sid")
+	if !ok || !okSession {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user or session id"})
+		return
+	}
+	if !requireManageable(w, r, userID) {
+		return
+	}
+	principal, _ := PrincipalFromContext(r.Context())
+	log.Printf("🛡️ Администратор %d отзывает сессию %d пользователя %d", principal.UserID, sessionID, userID)
+	revokeSessionResponse(w, userID, sessionID, "admin_revoked")
+}
+
+// RevokeAllAccess отзывает все сессии и API-токены пользователя
+func RevokeAllAccess(tx *sql.Tx, userID int, reason string) error {
+	if _, err := revokeSessions(tx, userID, 0, reason); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE api_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	return err
+}
@@ -0,0 +1,363 @@
+package auth
+
+import (
+	"HabitMaster/envConfig"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// keyReloadThrottle — не чаще этого перечитывать ключи из-за неизвестного kid
+const keyReloadThrottle = 30 * time.Second
+
+// currentKeys — ключи подписи, загруженные из БД при запуске; nil — только SECRET_KEY
+var currentKeys atomic.Pointer[Keyring]
+
+// activeKeyring — текущий набор ключей. Пока ротация не запущена (например, в тестах),
+// токены подписываются HS256 секретом SECRET_KEY, как до появления ротации.
+func activeKeyring() (*Keyring, error) {
+	if keys := currentKeys.Load(); keys != nil {
+		return keys, nil
+	}
+	secret, err := signingKey()
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(LegacySigningKey(secret)), nil
+}
+
+// keyRotation — настройки ротации ключей подписи, заданные при запуске
+type keyRotation struct {
+	db          *sql.DB
+	secret      []byte
+	algorithm   string
+	interval    time.Duration // срок работы ключа до замены
+	prepublish  time.Duration // за сколько до использования ключ появляется в JWKS
+	grace       time.Duration // сколько выведенный ключ ещё проверяет токены
+	acceptHS256 bool
+
+	mu         sync.Mutex
+	lastReload time.Time
+}
+
+var rotation *keyRotation
+
+// StartKeyRotation загружает ключи подписи из БД, при необходимости выпускает новый
+// и периодически ротирует их. Настройки читаются при вызове, после загрузки .env:
+// JWT_SIGNING_ALG (RS256, EdDSA или HS256), JWT_KEY_ROTATION_INTERVAL,
+// JWT_KEY_PREPUBLISH, JWT_KEY_RETIRE_GRACE, JWT_KEY_CHECK_INTERVAL и
+// JWT_ACCEPT_HS256=false, чтобы перестать принимать токены HS256.
+func StartKeyRotation(db *sql.DB) error {
+	algorithm, err := ParseSigningAlgorithm(os.Getenv("JWT_SIGNING_ALG"))
+	if err != nil {
+		return err
+	}
+	secret, err := signingKey()
+	if err != nil {
+		return err
+	}
+
+	kr := &keyRotation{
+		db:          db,
+		secret:      secret,
+		algorithm:   algorithm,
+		interval:    envConfig.Duration("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour),
+		prepublish:  envConfig.Duration("JWT_KEY_PREPUBLISH", time.Hour),
+		grace:       envConfig.Duration("JWT_KEY_RETIRE_GRACE", 24*time.Hour),
+		acceptHS256: algorithm == AlgHS256 || os.Getenv("JWT_ACCEPT_HS256") != "false",
+	}
+	if kr.grace < accessTokenTTL() {
+		kr.grace = accessTokenTTL()
+	}
+	if err := kr.rotate(); err != nil {
+		return err
+	}
+	rotation = kr
+	log.Printf("🔑 Токены подписываются %s, ключ %s", algorithm, currentKeys.Load().Active().ID)
+
+	go func() {
+		ticker := time.NewTicker(envConfig.Duration("JWT_KEY_CHECK_INTERVAL", time.Hour))
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := kr.rotate(); err != nil {
+				log.Printf("❌ Ошибка ротации ключей подписи: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// rotate выпускает следующий ключ заранее, переключается на него, когда он
+// опубликован достаточно долго, выводит старые ключи и удаляет просроченные
+func (kr *keyRotation) rotate() error {
+	tx, err := kr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Несколько экземпляров сервера не должны выпустить ключи одновременно
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('signing_keys'))`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM signing_keys WHERE expires_at <= NOW()`); err != nil {
+		return err
+	}
+	if err := kr.retireUndecryptable(tx); err != nil {
+		return err
+	}
+
+	activeID := ""
+	if kr.algorithm != AlgHS256 {
+		var activeCreated time.Time
+		var pending bool
+		err := tx.QueryRow(`SELECT kid, created_at FROM signing_keys
+			WHERE algorithm = $1 AND retired_at IS NULL AND activates_at <= NOW()
+			ORDER BY activates_at DESC LIMIT 1`, kr.algorithm).Scan(&activeID, &activeCreated)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM signing_keys
+				WHERE algorithm = $1 AND retired_at IS NULL AND activates_at > NOW())`, kr.algorithm).Scan(&pending)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case activeID == "":
+			// Первый ключ нужен сразу: ждать публикации нечего
+			if activeID, err = kr.insertKey(tx, 0); err != nil {
+				return err
+			}
+		case !pending && time.Since(activeCreated) >= kr.interval-kr.prepublish:
+			if _, err := kr.insertKey(tx, kr.prepublish); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Выведенные ключи ещё проверяют выпущенные ими токены в течение grace
+	_, err = tx.Exec(`UPDATE signing_keys SET retired_at = NOW(), expires_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE retired_at IS NULL AND activates_at <= NOW() AND kid <> $1`, activeID, int(kr.grace.Seconds()))
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return kr.reload()
+}
+
+// retireUndecryptable выводит ключи, зашифрованные другим SECRET_KEY (секрет сменили):
+// этот сервер не может ими ни подписывать, ни проверять, поэтому они считаются
+// отсутствующими и rotate сразу выпускает новый ключ. До конца grace их ещё могут
+// использовать экземпляры сервера со старым секретом.
+func (kr *keyRotation) retireUndecryptable(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT kid, private_key FROM signing_keys WHERE retired_at IS NULL`)
+	if err != nil {
+		return err
+	}
+	var unusable []string
+	for rows.Next() {
+		var kid string
+		var sealed []byte
+		if err := rows.Scan(&kid, &sealed); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, err := openPrivateKey(kr.secret, sealed); err != nil {
+			log.Printf("⚠️ Ключ подписи %s не расшифровывается текущим SECRET_KEY и выводится: %v", kid, err)
+			unusable = append(unusable, kid)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(unusable) == 0 {
+		return nil
+	}
+	_, err = tx.Exec(`UPDATE signing_keys SET retired_at = NOW(), expires_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE kid = ANY($1)`, pq.Array(unusable), int(kr.grace.Seconds()))
+	return err
+}
+
+// insertKey выпускает ключ, который начнёт подписывать токены через delay
+func (kr *keyRotation) insertKey(tx *sql.Tx, delay time.Duration) (string, error) {
+	key, err := GenerateSigningKey(kr.algorithm)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealPrivateKey(kr.secret, key.private)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`INSERT INTO signing_keys (kid, algorithm, private_key, activates_at)
+		VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 second')`, key.ID, key.Algorithm, sealed, int(delay.Seconds()))
+	if err != nil {
+		return "", err
+	}
+	log.Printf("🔑 Выпущен ключ подписи %s (%s), используется через %s", key.ID, key.Algorithm, delay)
+	return key.ID, nil
+}
+
+// reload перечитывает ключи из БД и заменяет текущий набор
+func (kr *keyRotation) reload() error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.lastReload = time.Now()
+
+	rows, err := kr.db.Query(`SELECT kid, algorithm, private_key, created_at, retired_at, expires_at,
+			retired_at IS NULL AND activates_at <= NOW()
+		FROM signing_keys
+		WHERE expires_at IS NULL OR expires_at > NOW()
+		ORDER BY activates_at DESC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var active *SigningKey
+	var others []*SigningKey
+	for rows.Next() {
+		key := &SigningKey{}
+		var sealed []byte
+		var retiredAt, expiresAt sql.NullTime
+		var current bool
+		if err := rows.Scan(&key.ID, &key.Algorithm, &sealed, &key.CreatedAt, &retiredAt, &expiresAt, &current); err != nil {
+			return err
+		}
+		if key.private, err = openPrivateKey(kr.secret, sealed); err != nil {
+			// Ключ зашифрован другим SECRET_KEY: rotate уже вывел его и выпустил замену
+			log.Printf("⚠️ Не удалось расшифровать ключ подписи %s: %v", key.ID, err)
+			continue
+		}
+		if retiredAt.Valid {
+			key.RetiredAt = &retiredAt.Time
+		}
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		if current && active == nil && key.Algorithm == kr.algorithm {
+			active = key
+			continue
+		}
+		others = append(others, key)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	legacy := LegacySigningKey(kr.secret)
+	if kr.acceptHS256 {
+		others = append(others, legacy)
+	}
+	if kr.algorithm == AlgHS256 {
+		active = legacy
+	}
+	if active == nil {
+		return errors.New("no usable signing key")
+	}
+	currentKeys.Store(NewKeyring(active, others...))
+	return nil
+}
+
+// reloadForUnknownKey перечитывает ключи, если токен подписан неизвестным kid:
+// его мог выпустить другой экземпляр сервера. Возвращает true, если ключи обновлены.
+func (kr *keyRotation) reloadForUnknownKey() bool {
+	kr.mu.Lock()
+	recent := time.Since(kr.lastReload) < keyReloadThrottle
+	kr.mu.Unlock()
+	if recent {
+		return false
+	}
+	if err := kr.reload(); err != nil {
+		log.Printf("❌ Ошибка загрузки ключей подписи: %v", err)
+		return false
+	}
+	return true
+}
+
+// keyEncryptionKey — ключ AES-256 для хранения закрытых ключей в БД, выводится из SECRET_KEY
+func keyEncryptionKey(secret []byte) []byte {
+	sum := sha256.Sum256(append([]byte("signing-keys:"), secret...))
+	return sum[:]
+}
+
+// sealPrivateKey шифрует закрытый ключ (PKCS #8) AES-GCM; результат — nonce и шифротекст
+func sealPrivateKey(secret []byte, key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(keyEncryptionKey(secret))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, der, nil), nil
+}
+
+// openPrivateKey расшифровывает ключ, сохранённый sealPrivateKey
+func openPrivateKey(secret, sealed []byte) (crypto.Signer, error) {
+	block, err := aes.NewCipher(keyEncryptionKey(secret))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed key is too short")
+	}
+	der, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return signer, nil
+}
+
+// JWKS — GET /.well-known/jwks.json, открытые ключи для проверки токенов HabitMaster
+// без обращения к серверу. Следующий ключ публикуется заранее (JWT_KEY_PREPUBLISH),
+// поэтому кеш на несколько минут не мешает ротации.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := activeKeyring()
+	if err != nil {
+		log.Printf("❌ Ошибка получения ключей подписи: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Signing keys are not available"})
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, http.StatusOK, keys.JWKS())
+}
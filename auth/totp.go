@@ -0,0 +1,419 @@
+package auth
+
+import (
+	"HabitMaster/envConfig"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Параметры TOTP (RFC 6238), которые поддерживают все приложения-аутентификаторы
+const (
+	totpIssuer        = "HabitMaster"
+	totpDigits        = 6
+	totpPeriod        = 30
+	recoveryCodeCount = 10
+)
+
+// mfaChallengeTTL — сколько действует токен второго шага входа
+func mfaChallengeTTL() time.Duration {
+	return envConfig.Duration("MFA_CHALLENGE_TTL", 5*time.Minute)
+}
+
+// mfaMaxAttempts — число попыток ввода кода на один вход
+func mfaMaxAttempts() int {
+	return envConfig.Int("MFA_MAX_ATTEMPTS", 5)
+}
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret создаёт новый секрет в кодировке base32
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// totpStep — номер 30-секундного интервала для момента времени
+func totpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// hotp вычисляет код для номера интервала (RFC 4226)
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// decodeTOTPSecret принимает секрет в любом регистре, с пробелами и паддингом
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return totpEncoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// TOTPCode — код для секрета в указанный момент времени
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, totpStep(t)), nil
+}
+
+// ValidateTOTP проверяет код с допуском ±1 интервал на расхождение часов.
+// Возвращает номер совпавшего интервала, чтобы код нельзя было использовать повторно.
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := totpStep(t)
+	for step := current - 1; step <= current+1; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI — otpauth:// ссылка для QR-кода в приложении-аутентификаторе
+func totpURI(secret, email string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", totpIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+email) + "?" + query.Encode()
+}
+
+// normalizeRecoveryCode убирает регистр, пробелы и дефисы из кода восстановления
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// replaceRecoveryCodes выдаёт новый набор одноразовых кодов восстановления
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))
+		codes[i] = code[:4] + "-" + code[4:]
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// checkSecondFactor принимает TOTP-код или неиспользованный код восстановления
+func checkSecondFactor(tx *sql.Tx, userID int, code string) (bool, error) {
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+	err := tx.QueryRow(`SELECT totp_secret, totp_last_step FROM users WHERE user_id = $1 FOR UPDATE`, userID).
+		Scan(&secret, &lastStep)
+	if err != nil {
+		return false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if secret.Valid {
+		if step, ok := ValidateTOTP(secret.String, code, time.Now()); ok {
+			if lastStep.Valid && step <= lastStep.Int64 {
+				return false, nil
+			}
+			_, err = tx.Exec(`UPDATE users SET totp_last_step = $1 WHERE user_id = $2`, step, userID)
+			return err == nil, err
+		}
+	}
+
+	res, err := tx.Exec(`UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	used, err := res.RowsAffected()
+	if used > 0 {
+		log.Printf("🔑 Пользователь %d вошёл по коду восстановления", userID)
+	}
+	return used > 0, err
+}
+
+// createMFAChallenge сохраняет хеш токена для второго шага входа
+func createMFAChallenge(userID int) (string, error) {
+	token, hash, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = database().Exec(`INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`,
+		userID, hash, time.Now().Add(mfaChallengeTTL()))
+	return token, err
+}
+
+// LoginSecondFactor — второй шаг входа: проверка TOTP-кода или кода восстановления
+func LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.MFAToken == "" || request.Code == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "mfa_token and code are required"})
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		challengeID, userID, attempts int
+		email, role                   string
+		lockedUntil                   sql.NullTime
+	)
+	err = tx.QueryRow(`
+		SELECT c.id, c.attempts, u.user_id, u.email, u.role, u.locked_until
+		FROM mfa_challenges c JOIN users u ON u.user_id = c.user_id
+		WHERE c.token_hash = $1 AND c.used_at IS NULL AND c.expires_at > NOW()
+		FOR UPDATE OF c`, hashToken(request.MFAToken)).Scan(&challengeID, &attempts, &userID, &email, &role, &lockedUntil)
+	if err == sql.ErrNoRows {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Login session expired, please log in again"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка БД при проверке второго фактора: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if attempts >= mfaMaxAttempts() {
+		respondJSON(w, http.StatusTooManyRequests, map[string]string{"error": "Too many failed attempts, please log in again"})
+		return
+	}
+	// Неверные коды считаются вместе с неверными паролями: новые mfa_token
+	// не дают обойти блокировку аккаунта
+	if wait := accountRetryAfter(lockedUntil); wait > 0 {
+		recordLoginAttempt(r, userID, email, false, loginAccountLocked)
+		respondTooManyAttempts(w, wait, "Account is temporarily locked due to failed login attempts")
+		return
+	}
+
+	ok, err := checkSecondFactor(tx, userID, request.Code)
+	if err == nil {
+		if ok {
+			_, err = tx.Exec(`UPDATE mfa_challenges SET used_at = NOW() WHERE id = $1`, challengeID)
+		} else {
+			_, err = tx.Exec(`UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1`, challengeID)
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка БД при проверке второго фактора: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if !ok {
+		recordLoginAttempt(r, userID, email, false, loginInvalidMFACode)
+		registerFailedLogin(userID, email)
+		log.Printf("⚠️ Неверный код второго фактора для пользователя %d", userID)
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid authentication code"})
+		return
+	}
+
+	if _, err := resetFailedLogins(userID); err != nil {
+		log.Printf("⚠️ Не удалось сбросить счётчик неудачных входов: %v", err)
+	}
+	if writeLoginResponse(w, r, userID, email, role, true) {
+		recordLoginAttempt(r, userID, email, true, loginOK)
+	}
+}
+
+// EnrollTOTP — POST /api/2fa/enroll, создаёт секрет, который ещё нужно подтвердить кодом
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to generate secret"})
+		return
+	}
+
+	res, err := database().Exec(`UPDATE users SET totp_secret = $1, totp_last_step = NULL
+		WHERE user_id = $2 AND NOT totp_enabled`, secret, principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения TOTP-секрета: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_uri": totpURI(secret, principal.Email),
+	})
+}
+
+// ConfirmTOTP — POST /api/2fa/confirm, включает 2FA и возвращает коды восстановления
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Code is required"})
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var secret sql.NullString
+	var enabled bool
+	err = tx.QueryRow(`SELECT totp_secret, totp_enabled FROM users WHERE user_id = $1 FOR UPDATE`, principal.UserID).
+		Scan(&secret, &enabled)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if enabled {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if !secret.Valid {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Start enrollment first"})
+		return
+	}
+	step, ok := ValidateTOTP(secret.String, strings.TrimSpace(request.Code), time.Now())
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, principal.UserID)
+	if err == nil {
+		_, err = tx.Exec(`UPDATE users SET totp_enabled = TRUE, totp_last_step = $1, updated_at = NOW() WHERE user_id = $2`,
+			step, principal.UserID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка включения 2FA: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	log.Printf("🔐 2FA включена для пользователя %d", principal.UserID)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":        "Two-factor authentication enabled. Store the recovery codes in a safe place.",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP — POST /api/2fa/disable, требует пароль и действующий код.
+// Администраторы отключить 2FA не могут.
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	var request struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Password == "" || request.Code == "" {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Password and code are required"})
+		return
+	}
+
+	tx, err := database().Begin()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var passwordHash, role string
+	var enabled bool
+	err = tx.QueryRow(`SELECT password, role, totp_enabled FROM users WHERE user_id = $1`, principal.UserID).
+		Scan(&passwordHash, &role, &enabled)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if !enabled {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if isPrivilegedRole(role) {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "Users with administrative permissions must keep two-factor authentication enabled"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(request.Password)) != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid password"})
+		return
+	}
+	ok, err := checkSecondFactor(tx, principal.UserID, request.Code)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid authentication code"})
+		return
+	}
+
+	_, err = tx.Exec(`UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = NULL, updated_at = NOW()
+		WHERE user_id = $1`, principal.UserID)
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, principal.UserID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка отключения 2FA: %v", err)
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		return
+	}
+
+	log.Printf("🔓 2FA отключена для пользователя %d", principal.UserID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
@@ -73,5 +73,11 @@ func ConnectBD() *sql.DB {
 	}
 
 	log.Println("✅ Подключение к базе данных успешно установлено.")
+
+	// Создаём недостающие таблицы и колонки
+	if err = EnsureSchema(db); err != nil {
+		log.Fatalf("❌ Ошибка обновления схемы: %v", err)
+	}
+
 	return db
 }
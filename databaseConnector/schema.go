@@ -0,0 +1,347 @@
+package databaseConnector
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// schemaStatements — идемпотентные DDL-запросы для таблиц и колонок,
+// которых нет в исходной схеме. Новые запросы добавляются в конец списка.
+var schemaStatements = []string{
+	// История изменений целей и привычек
+	`CREATE TABLE IF NOT EXISTS revisions (
+		id          SERIAL PRIMARY KEY,
+		entity_type TEXT        NOT NULL,
+		entity_id   INT         NOT NULL,
+		version     INT         NOT NULL,
+		action      TEXT        NOT NULL,
+		snapshot    JSONB       NOT NULL,
+		changed_by  INT,
+		changed_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		UNIQUE (entity_type, entity_id, version)
+	)`,
+
+	// Измеримые (SMART) цели
+	`ALTER TABLE goals
+		ADD COLUMN IF NOT EXISTS metric_unit      TEXT,
+		ADD COLUMN IF NOT EXISTS metric_start     DOUBLE PRECISION,
+		ADD COLUMN IF NOT EXISTS metric_target    DOUBLE PRECISION,
+		ADD COLUMN IF NOT EXISTS metric_direction TEXT`,
+	`CREATE TABLE IF NOT EXISTS goal_progress (
+		id          SERIAL PRIMARY KEY,
+		goal_id     INT              NOT NULL REFERENCES goals (id) ON DELETE CASCADE,
+		value       DOUBLE PRECISION NOT NULL,
+		note        TEXT             NOT NULL DEFAULT '',
+		recorded_at TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS goal_progress_goal_id_idx ON goal_progress (goal_id, recorded_at)`,
+
+	// OKR: объективы и ключевые результаты
+	`ALTER TABLE goals
+		ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES goals (id) ON DELETE SET NULL,
+		ADD COLUMN IF NOT EXISTS weight    DOUBLE PRECISION NOT NULL DEFAULT 1,
+		ADD COLUMN IF NOT EXISTS score     DOUBLE PRECISION,
+		ADD COLUMN IF NOT EXISTS quarter   TEXT`,
+	`CREATE INDEX IF NOT EXISTS goals_quarter_idx ON goals (quarter) WHERE parent_id IS NULL`,
+
+	// Срок действия и попытки ввода кода верификации
+	`ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS verification_code_expires_at TIMESTAMPTZ,
+		ADD COLUMN IF NOT EXISTS verification_attempts        INT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS verification_sent_at         TIMESTAMPTZ`,
+
+	// Сброс пароля
+	`CREATE TABLE IF NOT EXISTS password_resets (
+		id         SERIAL PRIMARY KEY,
+		user_id    INT         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		token_hash TEXT        NOT NULL UNIQUE,
+		expires_at TIMESTAMPTZ NOT NULL,
+		used_at    TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMPTZ`,
+
+	// Сессии и refresh-токены
+	`CREATE TABLE IF NOT EXISTS sessions (
+		id             SERIAL PRIMARY KEY,
+		user_id        INT         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		user_agent     TEXT        NOT NULL DEFAULT '',
+		ip             TEXT        NOT NULL DEFAULT '',
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_seen_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		revoked_at     TIMESTAMPTZ,
+		revoked_reason TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id)`,
+	`CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id         SERIAL PRIMARY KEY,
+		session_id INT         NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+		token_hash TEXT        NOT NULL UNIQUE,
+		expires_at TIMESTAMPTZ NOT NULL,
+		used_at    TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+
+	// Двухфакторная аутентификация (TOTP)
+	`ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS totp_secret    TEXT,
+		ADD COLUMN IF NOT EXISTS totp_enabled   BOOLEAN NOT NULL DEFAULT FALSE,
+		ADD COLUMN IF NOT EXISTS totp_last_step BIGINT`,
+	`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS mfa BOOLEAN NOT NULL DEFAULT FALSE`,
+	`CREATE TABLE IF NOT EXISTS recovery_codes (
+		id         SERIAL PRIMARY KEY,
+		user_id    INT         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		code_hash  TEXT        NOT NULL,
+		used_at    TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id)`,
+	`CREATE TABLE IF NOT EXISTS mfa_challenges (
+		id         SERIAL PRIMARY KEY,
+		user_id    INT         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		token_hash TEXT        NOT NULL UNIQUE,
+		attempts   INT         NOT NULL DEFAULT 0,
+		expires_at TIMESTAMPTZ NOT NULL,
+		used_at    TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+
+	// Вход через внешнего OpenID Connect провайдера
+	`CREATE TABLE IF NOT EXISTS user_identities (
+		id            SERIAL PRIMARY KEY,
+		user_id       INT         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		issuer        TEXT        NOT NULL,
+		subject       TEXT        NOT NULL,
+		email         TEXT        NOT NULL DEFAULT '',
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_login_at TIMESTAMPTZ,
+		UNIQUE (issuer, subject)
+	)`,
+	`CREATE TABLE IF NOT EXISTS oidc_states (
+		id            SERIAL PRIMARY KEY,
+		state_hash    TEXT        NOT NULL UNIQUE,
+		nonce         TEXT        NOT NULL,
+		code_verifier TEXT        NOT NULL,
+		expires_at    TIMESTAMPTZ NOT NULL,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+
+	// Защита от подбора пароля и история входов
+	`ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS failed_login_count INT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS locked_until       TIMESTAMPTZ`,
+	`CREATE TABLE IF NOT EXISTS login_attempts (
+		id         SERIAL PRIMARY KEY,
+		user_id    INT         REFERENCES users (user_id) ON DELETE SET NULL,
+		email      TEXT        NOT NULL DEFAULT '',
+		ip         TEXT        NOT NULL DEFAULT '',
+		user_agent TEXT        NOT NULL DEFAULT '',
+		success    BOOLEAN     NOT NULL,
+		reason     TEXT        NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS login_attempts_ip_idx ON login_attempts (ip, created_at)`,
+	`CREATE INDEX IF NOT EXISTS login_attempts_user_id_idx ON login_attempts (user_id, created_at)`,
+
+	// Персональные API-токены
+	`CREATE TABLE IF NOT EXISTS api_tokens (
+		id           SERIAL PRIMARY KEY,
+		user_id      INT         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		name         TEXT        NOT NULL,
+		token_hash   TEXT        NOT NULL UNIQUE,
+		prefix       TEXT        NOT NULL,
+		scopes       TEXT[]      NOT NULL,
+		expires_at   TIMESTAMPTZ,
+		last_used_at TIMESTAMPTZ,
+		revoked_at   TIMESTAMPTZ,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON api_tokens (user_id)`,
+
+	// Владелец привычек и целей; удаление аккаунта с отсрочкой
+	`ALTER TABLE habits ADD COLUMN IF NOT EXISTS user_id INT REFERENCES users (user_id) ON DELETE CASCADE`,
+	`ALTER TABLE goals ADD COLUMN IF NOT EXISTS user_id INT REFERENCES users (user_id) ON DELETE CASCADE`,
+	`CREATE INDEX IF NOT EXISTS habits_user_id_idx ON habits (user_id)`,
+	`CREATE INDEX IF NOT EXISTS goals_user_id_idx ON goals (user_id)`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_for TIMESTAMPTZ`,
+
+	// Смена email с подтверждением
+	`CREATE TABLE IF NOT EXISTS email_changes (
+		id                 SERIAL PRIMARY KEY,
+		user_id            INT         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		old_email          TEXT        NOT NULL,
+		new_email          TEXT        NOT NULL,
+		confirm_token_hash TEXT        NOT NULL UNIQUE,
+		revert_token_hash  TEXT        NOT NULL UNIQUE,
+		expires_at         TIMESTAMPTZ NOT NULL,
+		revert_expires_at  TIMESTAMPTZ NOT NULL,
+		confirmed_at       TIMESTAMPTZ,
+		cancelled_at       TIMESTAMPTZ,
+		created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+
+	// Настройки пользователя (часовой пояс, язык, уведомления)
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS preferences JSONB NOT NULL DEFAULT '{}'`,
+
+	// Приглашения на регистрацию (режим REGISTRATION_MODE=invite)
+	`CREATE TABLE IF NOT EXISTS invitations (
+		id          SERIAL PRIMARY KEY,
+		email       TEXT        NOT NULL,
+		role        TEXT        NOT NULL DEFAULT 'user',
+		token_hash  TEXT        NOT NULL UNIQUE,
+		created_by  INT         REFERENCES users (user_id) ON DELETE SET NULL,
+		accepted_by INT         REFERENCES users (user_id) ON DELETE SET NULL,
+		expires_at  TIMESTAMPTZ NOT NULL,
+		accepted_at TIMESTAMPTZ,
+		revoked_at  TIMESTAMPTZ,
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (LOWER(email))`,
+
+	// Одноразовые ссылки для входа без пароля
+	`CREATE TABLE IF NOT EXISTS magic_links (
+		id         SERIAL PRIMARY KEY,
+		user_id    INT         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		token_hash TEXT        NOT NULL UNIQUE,
+		ip         TEXT        NOT NULL DEFAULT '',
+		expires_at TIMESTAMPTZ NOT NULL,
+		used_at    TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_magic_links_user ON magic_links (user_id, created_at)`,
+
+	// Роли и разрешения. Роль пользователя хранится только в users.role
+	// (user_roles больше не используется), roles — справочник ролей.
+	`CREATE TABLE IF NOT EXISTS roles (
+		id   SERIAL PRIMARY KEY,
+		name TEXT NOT NULL
+	)`,
+	`ALTER TABLE roles
+		ADD COLUMN IF NOT EXISTS description TEXT        NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS built_in    BOOLEAN     NOT NULL DEFAULT FALSE,
+		ADD COLUMN IF NOT EXISTS created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+	// В старых базах roles могла содержать одинаковые имена: перед созданием
+	// уникального индекса остаётся строка с наименьшим id, разрешения и ссылки
+	// из user_roles переносятся на неё
+	`DO $$
+	BEGIN
+		IF to_regclass('role_permissions') IS NOT NULL THEN
+			INSERT INTO role_permissions (role_id, permission)
+			SELECT keep.id, rp.permission
+			FROM role_permissions rp
+			JOIN roles dup ON dup.id = rp.role_id
+			JOIN (SELECT name, MIN(id) AS id FROM roles GROUP BY name) keep ON keep.name = dup.name AND keep.id <> dup.id
+			ON CONFLICT DO NOTHING;
+		END IF;
+		IF to_regclass('user_roles') IS NOT NULL THEN
+			DELETE FROM user_roles ur USING roles dup
+			WHERE ur.role_id = dup.id AND EXISTS (
+				SELECT 1 FROM user_roles other JOIN roles r ON r.id = other.role_id
+				WHERE other.user_id = ur.user_id AND r.name = dup.name AND r.id < dup.id);
+			UPDATE user_roles ur SET role_id = keep.id
+			FROM roles dup
+			JOIN (SELECT name, MIN(id) AS id FROM roles GROUP BY name) keep ON keep.name = dup.name AND keep.id <> dup.id
+			WHERE ur.role_id = dup.id;
+		END IF;
+		DELETE FROM roles dup USING roles keep WHERE keep.name = dup.name AND keep.id < dup.id;
+	END $$`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS roles_name_idx ON roles (name)`,
+	`INSERT INTO roles (name, description, built_in) VALUES
+		('user', 'Regular user without administrative permissions', TRUE),
+		('admin', 'Full administrative access', TRUE)
+		ON CONFLICT (name) DO UPDATE SET built_in = TRUE`,
+	`CREATE TABLE IF NOT EXISTS role_permissions (
+		role_id    INT  NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+		permission TEXT NOT NULL,
+		PRIMARY KEY (role_id, permission)
+	)`,
+
+	// Журнал писем, отправленных администраторами
+	`CREATE TABLE IF NOT EXISTS admin_email_log (
+		id               SERIAL PRIMARY KEY,
+		actor_id         INT         REFERENCES users (user_id) ON DELETE SET NULL,
+		kind             TEXT        NOT NULL,
+		subject          TEXT        NOT NULL,
+		recipients_count INT         NOT NULL,
+		attachment_name  TEXT        NOT NULL DEFAULT '',
+		status           TEXT        NOT NULL,
+		error            TEXT        NOT NULL DEFAULT '',
+		ip               TEXT        NOT NULL DEFAULT '',
+		created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+
+	// Ключи подписи токенов доступа; закрытые ключи зашифрованы ключом из SECRET_KEY
+	`CREATE TABLE IF NOT EXISTS signing_keys (
+		kid          TEXT PRIMARY KEY,
+		algorithm    TEXT        NOT NULL,
+		private_key  BYTEA       NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		activates_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		retired_at   TIMESTAMPTZ,
+		expires_at   TIMESTAMPTZ
+	)`,
+
+	// Известные устройства и сети входа; письма о входе с нового устройства
+	`CREATE TABLE IF NOT EXISTS known_devices (
+		id            SERIAL PRIMARY KEY,
+		user_id       INT         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		fingerprint   TEXT        NOT NULL,
+		ip_range      TEXT        NOT NULL,
+		user_agent    TEXT        NOT NULL DEFAULT '',
+		ip            TEXT        NOT NULL DEFAULT '',
+		first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		UNIQUE (user_id, fingerprint, ip_range)
+	)`,
+	`CREATE TABLE IF NOT EXISTS login_alerts (
+		id          SERIAL PRIMARY KEY,
+		user_id     INT         NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		token_hash  TEXT        NOT NULL UNIQUE,
+		fingerprint TEXT        NOT NULL,
+		ip_range    TEXT        NOT NULL,
+		ip          TEXT        NOT NULL DEFAULT '',
+		user_agent  TEXT        NOT NULL DEFAULT '',
+		expires_at  TIMESTAMPTZ NOT NULL,
+		used_at     TIMESTAMPTZ,
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE`,
+
+	// Очередь исходящих писем: pending → sending → sent, после всех попыток — dead
+	`CREATE TABLE IF NOT EXISTS email_outbox (
+		id              SERIAL PRIMARY KEY,
+		recipients      TEXT[]      NOT NULL,
+		subject         TEXT        NOT NULL,
+		body            TEXT        NOT NULL,
+		attachment_name TEXT        NOT NULL DEFAULT '',
+		attachment      BYTEA,
+		status          TEXT        NOT NULL DEFAULT 'pending',
+		attempts        INT         NOT NULL DEFAULT 0,
+		last_error      TEXT        NOT NULL DEFAULT '',
+		next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		locked_until    TIMESTAMPTZ,
+		sent_at         TIMESTAMPTZ,
+		created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_email_outbox_due ON email_outbox (status, next_attempt_at)`,
+
+	// Текстовая версия писем из шаблонов (body — HTML)
+	`ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS text_body TEXT NOT NULL DEFAULT ''`,
+
+	// Письма с секретами (коды, ссылки входа и сброса) не показываются в API очереди;
+	// текст отправленных писем не хранится
+	`ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS sensitive BOOLEAN NOT NULL DEFAULT FALSE`,
+	`UPDATE email_outbox SET body = '', text_body = '', attachment = NULL
+		WHERE status = 'sent' AND (body <> '' OR text_body <> '' OR attachment IS NOT NULL)`,
+}
+
+// EnsureSchema применяет schemaStatements к базе данных
+func EnsureSchema(db *sql.DB) error {
+	for _, stmt := range schemaStatements {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("schema migration failed: %w", err)
+		}
+	}
+	return nil
+}
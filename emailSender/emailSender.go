@@ -11,6 +11,11 @@ import (
 type EmailSender interface {
 	SendEmail(to []string, subject, body string) error
 	SendEmailWithAttachment(to []string, subject, body, fileName string, fileData []byte) error
+	// SendMultipartEmail отправляет письмо с HTML и текстовой версией (multipart/alternative)
+	SendMultipartEmail(to []string, subject, htmlBody, textBody string) error
+	// SendSensitiveEmail отправляет письмо с секретом (код, ссылка для входа или сброса):
+	// очередь не хранит и не показывает его текст
+	SendSensitiveEmail(to []string, subject, htmlBody, textBody string) error
 }
 
 type RealEmailSender struct {
@@ -67,3 +72,21 @@ func (e *RealEmailSender) SendEmailWithAttachment(to []string, subject, body, fi
 
 	return d.DialAndSend(m)
 }
+
+func (e *RealEmailSender) SendMultipartEmail(to []string, subject, htmlBody, textBody string) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", e.Username)
+	m.SetHeader("To", to...)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/plain", textBody)
+	m.AddAlternative("text/html", htmlBody)
+
+	d := gomail.NewDialer(e.Host, e.Port, e.Username, e.Password)
+
+	return d.DialAndSend(m)
+}
+
+// SendSensitiveEmail — письмо с секретом отправляется как обычное письмо с двумя версиями
+func (e *RealEmailSender) SendSensitiveEmail(to []string, subject, htmlBody, textBody string) error {
+	return e.SendMultipartEmail(to, subject, htmlBody, textBody)
+}
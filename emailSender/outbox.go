@@ -0,0 +1,374 @@
+package emailSender
+
+import (
+	"HabitMaster/envConfig"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Статусы писем в очереди email_outbox
+const (
+	StatusPending = "pending" // ждёт первой или повторной отправки
+	StatusSending = "sending" // взято обработчиком
+	StatusSent    = "sent"
+	StatusDead    = "dead" // попытки исчерпаны, нужен повтор вручную
+)
+
+// ErrMessageNotRetryable — письмо уже отправлено, отправляется прямо сейчас
+// или его текст уже стёрт
+var ErrMessageNotRetryable = errors.New("message is not pending or dead")
+
+// Execer — *sql.DB или *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// queuedEmail — письмо для вставки в email_outbox
+type queuedEmail struct {
+	to        []string
+	subject   string
+	body      string // HTML
+	textBody  string
+	fileName  string
+	fileData  []byte
+	sensitive bool
+}
+
+// Enqueue ставит письмо в очередь. Внутри транзакции письмо станет видно
+// обработчикам только после её фиксации, а при откате не уйдёт вовсе.
+func Enqueue(exec Execer, to []string, subject, body, fileName string, fileData []byte) error {
+	return enqueue(exec, queuedEmail{to: to, subject: subject, body: body, fileName: fileName, fileData: fileData})
+}
+
+// EnqueueMultipart ставит в очередь письмо с HTML и текстовой версией
+func EnqueueMultipart(exec Execer, to []string, subject, htmlBody, textBody string) error {
+	return enqueue(exec, queuedEmail{to: to, subject: subject, body: htmlBody, textBody: textBody})
+}
+
+// EnqueueSensitive ставит в очередь письмо с секретом (код подтверждения, ссылка для
+// входа или сброса пароля). Его текст не отдаётся через API очереди и стирается
+// сразу после отправки.
+func EnqueueSensitive(exec Execer, to []string, subject, htmlBody, textBody string) error {
+	return enqueue(exec, queuedEmail{to: to, subject: subject, body: htmlBody, textBody: textBody, sensitive: true})
+}
+
+func enqueue(exec Execer, m queuedEmail) error {
+	if len(m.to) == 0 {
+		return errors.New("no recipients")
+	}
+	_, err := exec.Exec(`INSERT INTO email_outbox (recipients, subject, body, text_body, attachment_name, attachment, sensitive)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`, pq.Array(m.to), m.subject, m.body, m.textBody, m.fileName, m.fileData, m.sensitive)
+	return err
+}
+
+// QueuedEmailSender кладёт письма в email_outbox вместо отправки: запрос не ждёт SMTP,
+// а письмо переживает перезапуск сервера
+type QueuedEmailSender struct {
+	db   *sql.DB
+	wake chan struct{}
+}
+
+func (q *QueuedEmailSender) SendEmail(to []string, subject, body string) error {
+	return q.SendEmailWithAttachment(to, subject, body, "", nil)
+}
+
+func (q *QueuedEmailSender) SendEmailWithAttachment(to []string, subject, body, fileName string, fileData []byte) error {
+	return q.notify(Enqueue(q.db, to, subject, body, fileName, fileData))
+}
+
+func (q *QueuedEmailSender) SendMultipartEmail(to []string, subject, htmlBody, textBody string) error {
+	return q.notify(EnqueueMultipart(q.db, to, subject, htmlBody, textBody))
+}
+
+func (q *QueuedEmailSender) SendSensitiveEmail(to []string, subject, htmlBody, textBody string) error {
+	return q.notify(EnqueueSensitive(q.db, to, subject, htmlBody, textBody))
+}
+
+// notify будит обработчик, не дожидаясь следующего опроса очереди
+func (q *QueuedEmailSender) notify(err error) error {
+	if err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// OutboxConfig — настройки обработчиков очереди
+type OutboxConfig struct {
+	Workers      int
+	MaxAttempts  int
+	BackoffBase  time.Duration // задержка перед второй попыткой; дальше удваивается
+	BackoffMax   time.Duration
+	PollInterval time.Duration
+	Lease        time.Duration // через сколько зависшая отправка считается прерванной
+	Retention    time.Duration // сколько хранятся отправленные и dead-письма
+}
+
+// OutboxConfigFromEnv — настройки из EMAIL_OUTBOX_WORKERS, EMAIL_MAX_ATTEMPTS,
+// EMAIL_RETRY_BASE, EMAIL_RETRY_MAX, EMAIL_OUTBOX_POLL_INTERVAL и EMAIL_OUTBOX_RETENTION
+func OutboxConfigFromEnv() OutboxConfig {
+	return OutboxConfig{
+		Workers:      envConfig.Int("EMAIL_OUTBOX_WORKERS", 4),
+		MaxAttempts:  envConfig.Int("EMAIL_MAX_ATTEMPTS", 8),
+		BackoffBase:  envConfig.Duration("EMAIL_RETRY_BASE", 30*time.Second),
+		BackoffMax:   envConfig.Duration("EMAIL_RETRY_MAX", time.Hour),
+		PollInterval: envConfig.Duration("EMAIL_OUTBOX_POLL_INTERVAL", 2*time.Second),
+		Lease:        5 * time.Minute,
+		Retention:    envConfig.Duration("EMAIL_OUTBOX_RETENTION", 30*24*time.Hour),
+	}
+}
+
+// Backoff — задержка после attempts неудачных попыток: base, 2*base, 4*base... но не больше max
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	if attempts < 1 {
+		return base
+	}
+	if attempts > 30 {
+		return max
+	}
+	d := time.Duration(float64(base) * math.Pow(2, float64(attempts-1)))
+	if d > max || d <= 0 {
+		return max
+	}
+	return d
+}
+
+// Outbox — пул обработчиков, отправляющих письма из email_outbox через sender
+type Outbox struct {
+	db     *sql.DB
+	sender EmailSender
+	config OutboxConfig
+	wake   chan struct{}
+	once   sync.Once
+}
+
+// NewOutbox создаёт очередь; sender — настоящий отправитель (SMTP)
+func NewOutbox(db *sql.DB, sender EmailSender, config OutboxConfig) *Outbox {
+	return &Outbox{db: db, sender: sender, config: config, wake: make(chan struct{}, 1)}
+}
+
+// Sender — EmailSender для обработчиков запросов: письма ставятся в эту очередь
+func (o *Outbox) Sender() EmailSender {
+	return &QueuedEmailSender{db: o.db, wake: o.wake}
+}
+
+// Start запускает обработчики очереди (повторный вызов ничего не делает)
+func (o *Outbox) Start() {
+	o.once.Do(func() {
+		for i := 0; i < o.config.Workers; i++ {
+			go o.work()
+		}
+		go o.purgeLoop()
+		log.Printf("📮 Очередь писем запущена: %d обработчиков", o.config.Workers)
+	})
+}
+
+// purgeLoop раз в час удаляет письма старше Retention
+func (o *Outbox) purgeLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if n, err := PurgeOutbox(o.db, o.config.Retention); err != nil {
+			log.Printf("❌ Ошибка очистки очереди писем: %v", err)
+		} else if n > 0 {
+			log.Printf("🧹 Из очереди писем удалено старых писем: %d", n)
+		}
+		<-ticker.C
+	}
+}
+
+// PurgeOutbox удаляет отправленные и dead-письма, которые не менялись дольше retention
+func PurgeOutbox(db *sql.DB, retention time.Duration) (int64, error) {
+	res, err := db.Exec(`DELETE FROM email_outbox
+		WHERE status IN ('sent', 'dead') AND updated_at < NOW() - $1 * INTERVAL '1 second'`, int(retention.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// work отправляет письма, пока они есть, затем ждёт нового письма или опроса
+func (o *Outbox) work() {
+	for {
+		sent, err := o.processNext()
+		if err != nil {
+			log.Printf("❌ Ошибка очереди писем: %v", err)
+		}
+		if sent && err == nil {
+			continue
+		}
+		select {
+		case <-o.wake:
+		case <-time.After(o.config.PollInterval):
+		}
+	}
+}
+
+// processNext берёт одно письмо из очереди и пытается его отправить.
+// Возвращает false, если отправлять нечего.
+func (o *Outbox) processNext() (bool, error) {
+	var id, attempts int
+	var to []string
+	var subject, body, textBody, fileName string
+	var fileData []byte
+	var sensitive bool
+	// SKIP LOCKED позволяет нескольким обработчикам и экземплярам сервера брать разные письма;
+	// письмо, застрявшее в sending дольше Lease (сервер упал во время отправки), берётся снова
+	err := o.db.QueryRow(`UPDATE email_outbox
+		SET status = 'sending', attempts = attempts + 1, locked_until = NOW() + $1 * INTERVAL '1 second', updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM email_outbox
+			WHERE (status = 'pending' AND next_attempt_at <= NOW()) OR (status = 'sending' AND locked_until < NOW())
+			ORDER BY next_attempt_at
+			LIMIT 1 FOR UPDATE SKIP LOCKED)
+		RETURNING id, recipients, subject, body, text_body, attachment_name, attachment, sensitive, attempts`,
+		int(o.config.Lease.Seconds())).
+		Scan(&id, pq.Array(&to), &subject, &body, &textBody, &fileName, &fileData, &sensitive, &attempts)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var sendErr error
+	switch {
+	case sensitive:
+		sendErr = o.sender.SendSensitiveEmail(to, subject, body, textBody)
+	case textBody != "":
+		sendErr = o.sender.SendMultipartEmail(to, subject, body, textBody)
+	default:
+		sendErr = o.sender.SendEmailWithAttachment(to, subject, body, fileName, fileData)
+	}
+	if sendErr != nil {
+		return true, o.fail(id, attempts, sendErr)
+	}
+	// Отправленное письмо больше не нужно: текст и вложение стираются, остаются тема и адресаты
+	_, err = o.db.Exec(`UPDATE email_outbox
+		SET status = 'sent', sent_at = NOW(), locked_until = NULL, last_error = '', updated_at = NOW(),
+			body = '', text_body = '', attachment = NULL
+		WHERE id = $1`, id)
+	return true, err
+}
+
+// fail откладывает письмо с экспоненциальной задержкой или переводит его в dead.
+// У dead-письма с секретом текст стирается: повторять его нельзя, ссылка к тому
+// времени всё равно устареет, и пользователь запросит новую.
+func (o *Outbox) fail(id, attempts int, sendErr error) error {
+	if attempts >= o.config.MaxAttempts {
+		log.Printf("☠️ Письмо %d не отправлено после %d попыток: %v", id, attempts, sendErr)
+		_, err := o.db.Exec(`UPDATE email_outbox
+			SET status = 'dead', locked_until = NULL, last_error = $2, updated_at = NOW(),
+				body = CASE WHEN sensitive THEN '' ELSE body END,
+				text_body = CASE WHEN sensitive THEN '' ELSE text_body END
+			WHERE id = $1`, id, sendErr.Error())
+		return err
+	}
+
+	delay := Backoff(attempts, o.config.BackoffBase, o.config.BackoffMax)
+	log.Printf("⚠️ Письмо %d не отправлено (попытка %d), повтор через %s: %v", id, attempts, delay, sendErr)
+	_, err := o.db.Exec(`UPDATE email_outbox
+		SET status = 'pending', locked_until = NULL, last_error = $2,
+			next_attempt_at = NOW() + $3 * INTERVAL '1 second', updated_at = NOW()
+		WHERE id = $1`, id, sendErr.Error(), int(delay.Seconds()))
+	return err
+}
+
+// OutboxMessage — письмо в очереди
+type OutboxMessage struct {
+	ID             int        `json:"id"`
+	Recipients     []string   `json:"recipients"`
+	Subject        string     `json:"subject"`
+	Body           string     `json:"body,omitempty"`
+	TextBody       string     `json:"text_body,omitempty"`
+	AttachmentName string     `json:"attachment_name,omitempty"`
+	AttachmentSize int        `json:"attachment_size,omitempty"`
+	Sensitive      bool       `json:"sensitive"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	SentAt         *time.Time `json:"sent_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// outboxColumns — поля письма без текста и вложения
+const outboxColumns = `id, recipients, subject, attachment_name, COALESCE(LENGTH(attachment), 0), sensitive,
+	status, attempts, last_error, next_attempt_at, sent_at, created_at, updated_at`
+
+func scanOutboxMessage(row interface{ Scan(...interface{}) error }, extra ...interface{}) (OutboxMessage, error) {
+	var m OutboxMessage
+	var sentAt sql.NullTime
+	dest := append([]interface{}{&m.ID, pq.Array(&m.Recipients), &m.Subject, &m.AttachmentName, &m.AttachmentSize, &m.Sensitive,
+		&m.Status, &m.Attempts, &m.LastError, &m.NextAttemptAt, &sentAt, &m.CreatedAt, &m.UpdatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return m, err
+	}
+	if sentAt.Valid {
+		m.SentAt = &sentAt.Time
+	}
+	return m, nil
+}
+
+// ListOutbox — последние письма очереди; status может быть пустым
+func ListOutbox(db *sql.DB, status string, limit int) ([]OutboxMessage, error) {
+	rows, err := db.Query(`SELECT `+outboxColumns+` FROM email_outbox
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []OutboxMessage{}
+	for rows.Next() {
+		m, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// GetOutboxMessage — письмо вместе с HTML и текстовой версией. Текст писем с секретом
+// не возвращается никогда, у отправленных писем он уже стёрт.
+func GetOutboxMessage(db *sql.DB, id int) (OutboxMessage, error) {
+	var body, textBody string
+	m, err := scanOutboxMessage(db.QueryRow(`SELECT `+outboxColumns+`,
+			CASE WHEN sensitive THEN '' ELSE body END, CASE WHEN sensitive THEN '' ELSE text_body END
+		FROM email_outbox WHERE id = $1`, id),
+		&body, &textBody)
+	m.Body, m.TextBody = body, textBody
+	return m, err
+}
+
+// RetryOutboxMessage ставит письмо в dead или pending на немедленную отправку
+// с полным числом попыток. Dead-письмо с секретом не повторяется: его текст стёрт.
+// Для неизвестного id возвращает sql.ErrNoRows.
+func RetryOutboxMessage(db *sql.DB, id int) error {
+	var status string
+	err := db.QueryRow(`SELECT status FROM email_outbox WHERE id = $1`, id).Scan(&status)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec(`UPDATE email_outbox SET status = 'pending', attempts = 0, next_attempt_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND (status = 'pending' OR (status = 'dead' AND NOT sensitive))`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMessageNotRetryable
+	}
+	return nil
+}
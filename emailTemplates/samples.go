@@ -0,0 +1,36 @@
+package emailTemplates
+
+import "time"
+
+// samples — данные-примеры для предпросмотра шаблонов администратором
+var samples = map[string]Data{
+	Verification:  {"Code": "482913", "TTL": 15 * time.Minute},
+	PasswordReset: {"Link": "https://habitmaster.example.com/reset-password.html?token=sample", "TTL": time.Hour},
+	MagicLink:     {"Link": "https://habitmaster.example.com/login.html#magic_token=sample", "TTL": 15 * time.Minute},
+	Invitation: {
+		"Link":      "https://habitmaster.example.com/register.html?invite=sample&email=jane%40example.com",
+		"ExpiresAt": "2026-01-15 18:00 UTC",
+	},
+	AccountLocked: {"Failures": 5, "LockedUntil": "2026-01-08 12:30 UTC", "LoginURL": "https://habitmaster.example.com/login.html"},
+	NewDevice: {
+		"Time":   "2026-01-08 12:00 UTC",
+		"IP":     "203.0.113.7",
+		"Device": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Firefox/121.0",
+		"Link":   "https://habitmaster.example.com/reset-password.html?not_me=sample",
+		"TTL":    7 * 24 * time.Hour,
+	},
+	EmailChangeConfirm: {"Link": "https://habitmaster.example.com/email-change.html?action=confirm&token=sample", "TTL": 24 * time.Hour},
+	EmailChangeNotice: {
+		"NewEmail": "jane.new@example.com",
+		"OldEmail": "jane@example.com",
+		"Link":     "https://habitmaster.example.com/email-change.html?action=revert&token=sample",
+		"TTL":      7 * 24 * time.Hour,
+	},
+	AccountDeletion: {"ScheduledFor": "2026-02-07 12:00 UTC"},
+}
+
+// Sample — данные-пример для шаблона name
+func Sample(name string) (Data, bool) {
+	data, ok := samples[name]
+	return data, ok
+}
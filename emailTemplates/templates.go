@@ -0,0 +1,211 @@
+// Package emailTemplates — шаблоны писем HabitMaster: HTML и текстовая версия на каждом
+// языке, общий макет и частичные шаблоны. HTML собирается через html/template, поэтому
+// подставляемые значения экранируются, а опасные ссылки (javascript: и т. п.) вырезаются.
+package emailTemplates
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Имена шаблонов
+const (
+	Verification       = "verification"
+	PasswordReset      = "password_reset"
+	MagicLink          = "magic_link"
+	Invitation         = "invitation"
+	AccountLocked      = "account_locked"
+	NewDevice          = "new_device"
+	EmailChangeConfirm = "email_change_confirm"
+	EmailChangeNotice  = "email_change_notice"
+	AccountDeletion    = "account_deletion"
+)
+
+// DefaultLocale — язык, на который шаблон откатывается, если перевода нет
+const DefaultLocale = "en"
+
+//go:embed templates
+var files embed.FS
+
+// Data — значения для подстановки в шаблон
+type Data map[string]interface{}
+
+// Email — готовое письмо
+type Email struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// compiled — HTML и текстовая версия одного шаблона на одном языке
+type compiled struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// registry — шаблоны по языку и имени; собираются один раз при запуске
+var registry = mustLoad()
+
+func mustLoad() map[string]map[string]compiled {
+	locales, err := fs.ReadDir(files, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := make(map[string]map[string]compiled)
+	for _, entry := range locales {
+		if !entry.IsDir() {
+			continue
+		}
+		locale := entry.Name()
+		names, err := fs.Glob(files, "templates/"+locale+"/*.html")
+		if err != nil {
+			panic(err)
+		}
+		loaded[locale] = make(map[string]compiled)
+		for _, path := range names {
+			name := strings.TrimSuffix(path[strings.LastIndex(path, "/")+1:], ".html")
+			if name == "partials" {
+				continue
+			}
+			funcs := funcMap(locale)
+			loaded[locale][name] = compiled{
+				html: htmltemplate.Must(htmltemplate.New(name).Option("missingkey=error").Funcs(funcs).ParseFS(files,
+					"templates/layout.html", "templates/"+locale+"/partials.html", path)),
+				text: texttemplate.Must(texttemplate.New(name).Option("missingkey=error").Funcs(funcs).ParseFS(files,
+					"templates/layout.txt", "templates/"+locale+"/partials.txt", "templates/"+locale+"/"+name+".txt")),
+			}
+		}
+	}
+	return loaded
+}
+
+// funcMap — функции, доступные в шаблонах языка locale
+func funcMap(locale string) map[string]interface{} {
+	return map[string]interface{}{
+		"duration": func(d time.Duration) string { return FormatDuration(locale, d) },
+		// dict передаёт несколько значений в частичный шаблон: {{template "button" dict "URL" .Link "Label" "..."}}
+		"dict": func(pairs ...interface{}) (map[string]interface{}, error) {
+			if len(pairs)%2 != 0 {
+				return nil, fmt.Errorf("dict needs key/value pairs")
+			}
+			m := make(map[string]interface{}, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				key, ok := pairs[i].(string)
+				if !ok {
+					return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+				}
+				m[key] = pairs[i+1]
+			}
+			return m, nil
+		},
+	}
+}
+
+// Render собирает письмо name на языке locale (или на DefaultLocale, если перевода нет)
+func Render(name, locale string, data Data) (Email, error) {
+	tmpl, ok := registry[locale][name]
+	if !ok {
+		locale = DefaultLocale
+		if tmpl, ok = registry[locale][name]; !ok {
+			return Email{}, fmt.Errorf("unknown email template %q", name)
+		}
+	}
+
+	values := make(Data, len(data)+1)
+	for k, v := range data {
+		values[k] = v
+	}
+	values["Locale"] = locale
+
+	var subject, html, text bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", values); err != nil {
+		return Email{}, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", values); err != nil {
+		return Email{}, err
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "layout", values); err != nil {
+		return Email{}, err
+	}
+	return Email{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
+
+// Names — имена всех шаблонов
+func Names() []string {
+	names := make([]string, 0, len(registry[DefaultLocale]))
+	for name := range registry[DefaultLocale] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Locales — языки, для которых есть шаблоны
+func Locales() []string {
+	locales := make([]string, 0, len(registry))
+	for locale := range registry {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// HasLocale — есть ли шаблоны на языке locale
+func HasLocale(locale string) bool {
+	_, ok := registry[locale]
+	return ok
+}
+
+// FormatDuration — длительность словами: «15 minutes», «7 дней». Берётся самая крупная
+// единица, которой длительность выражается целым числом.
+func FormatDuration(locale string, d time.Duration) string {
+	type unit struct {
+		size  time.Duration
+		en    [2]string
+		ru    [3]string
+		exact bool
+	}
+	units := []unit{
+		{24 * time.Hour, [2]string{"day", "days"}, [3]string{"день", "дня", "дней"}, true},
+		{time.Hour, [2]string{"hour", "hours"}, [3]string{"час", "часа", "часов"}, true},
+		{time.Minute, [2]string{"minute", "minutes"}, [3]string{"минуту", "минуты", "минут"}, false},
+	}
+	for _, u := range units {
+		if u.exact && (d < u.size || d%u.size != 0) {
+			continue
+		}
+		n := int((d + u.size/2) / u.size)
+		if locale == "ru" {
+			return fmt.Sprintf("%d %s", n, u.ru[russianPlural(n)])
+		}
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, u.en[0])
+		}
+		return fmt.Sprintf("%d %s", n, u.en[1])
+	}
+	return d.String()
+}
+
+// russianPlural — форма слова для числа n: 1 минуту, 2 минуты, 5 минут
+func russianPlural(n int) int {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return 0
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return 1
+	default:
+		return 2
+	}
+}
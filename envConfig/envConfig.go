@@ -0,0 +1,44 @@
+// Package envConfig читает настройки из переменных окружения. Пакет не
+// зависит от остальных пакетов приложения, поэтому им пользуются и auth,
+// и handlers, и emailSender.
+//
+// Значения нужно читать при использовании, а не в инициализаторах переменных
+// пакета: .env загружается в databaseConnector.ConnectBD уже после инициализации.
+package envConfig
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Duration читает положительную длительность из переменной окружения (например "15m").
+// Пустое или некорректное значение заменяется на def.
+func Duration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️ Некорректное значение %s=%q, используется %s", name, value, def)
+		return def
+	}
+	return d
+}
+
+// Int читает положительное целое из переменной окружения.
+// Пустое или некорректное значение заменяется на def.
+func Int(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("⚠️ Некорректное значение %s=%q, используется %d", name, value, def)
+		return def
+	}
+	return n
+}
@@ -1,9 +1,11 @@
 const apiBaseUrl = 'https://localhost:8080'; // Замените на нужный URL (или http://localhost:8080)
 
+// authHeaders и authFetch — в auth.js
+
 // Общая функция для выполнения запросов
 async function fetchData(endpoint, options = {}) {
     try {
-        const response = await fetch(`${apiBaseUrl}${endpoint}`, options);
+        const response = await authFetch(`${apiBaseUrl}${endpoint}`, options);
         if (!response.ok) {
             throw new Error(`Error: ${response.statusText}`);
         }
@@ -39,8 +41,9 @@ async function sendPromotionalEmail() {
 
     // Отправка данных на сервер
     try {
-        const response = await fetch(`${apiBaseUrl}/api/admin/send-mass-email`, {
+        const response = await authFetch(`${apiBaseUrl}/api/admin/send-mass-email`, {
             method: 'POST',
+            headers: authHeaders(),
             body: formData, // Используем FormData для загрузки файла
         });
 
@@ -142,11 +145,11 @@ async function createUser() {
     const user = { name, email, password };
 
     try {
-        const response = await fetch(`${apiBaseUrl}/api/users`, {
+        const response = await authFetch(`${apiBaseUrl}/api/users`, {
             method: 'POST',
-            headers: {
+            headers: authHeaders({
                 'Content-Type': 'application/json',
-            },
+            }),
             body: JSON.stringify(user),
         });
 
@@ -173,14 +176,14 @@ async function updateUser() {
         return;
     }
 
-    const user = { id, name, email };
+    const user = { id: parseInt(id), name, email };
 
     try {
-        const response = await fetch(`${apiBaseUrl}/api/users`, {
+        const response = await authFetch(`${apiBaseUrl}/api/users`, {
             method: 'PUT',
-            headers: {
+            headers: authHeaders({
                 'Content-Type': 'application/json',
-            },
+            }),
             body: JSON.stringify(user),
         });
 
@@ -206,8 +209,9 @@ async function deleteUser() {
     }
 
     try {
-        const response = await fetch(`${apiBaseUrl}/api/users?id=${id}`, {
+        const response = await authFetch(`${apiBaseUrl}/api/users?id=${id}`, {
             method: 'DELETE',
+            headers: authHeaders(),
         });
 
         if (response.ok) {
@@ -222,6 +226,88 @@ async function deleteUser() {
     }
 }
 
+// Ручное подтверждение email пользователя
+async function verifyUser() {
+    const id = prompt('Enter user ID to verify:');
+    if (!id) {
+        alert('ID is required!');
+        return;
+    }
+
+    try {
+        const response = await authFetch(`${apiBaseUrl}/api/users/${parseInt(id)}/verify`, {
+            method: 'POST',
+            headers: authHeaders(),
+        });
+
+        if (response.ok) {
+            alert('User verified successfully!');
+            getUsers();
+        } else {
+            throw new Error(await response.text());
+        }
+    } catch (error) {
+        console.error('Error verifying user:', error);
+        alert('Failed to verify user.');
+    }
+}
+
+// Изменение роли пользователя
+async function changeUserRole() {
+    const id = prompt('Enter user ID:');
+    const role = prompt('Enter new role name (user, admin or a custom role):');
+    if (!id || !role) {
+        alert('ID and role are required!');
+        return;
+    }
+
+    try {
+        const response = await authFetch(`${apiBaseUrl}/api/users/${parseInt(id)}/role`, {
+            method: 'PUT',
+            headers: authHeaders({
+                'Content-Type': 'application/json',
+            }),
+            body: JSON.stringify({ role: role.trim() }),
+        });
+
+        if (response.ok) {
+            alert('User role updated successfully!');
+            getUsers();
+        } else {
+            throw new Error(await response.text());
+        }
+    } catch (error) {
+        console.error('Error changing user role:', error);
+        alert('Failed to change user role.');
+    }
+}
+
+// Отзыв роли: пользователь возвращается к роли user
+async function revokeUserRole() {
+    const id = prompt('Enter user ID:');
+    if (!id) {
+        alert('ID is required!');
+        return;
+    }
+
+    try {
+        const response = await authFetch(`${apiBaseUrl}/api/admin/users/${parseInt(id)}/role`, {
+            method: 'DELETE',
+            headers: authHeaders(),
+        });
+
+        if (response.ok) {
+            alert('User role revoked successfully!');
+            getUsers();
+        } else {
+            throw new Error(await response.text());
+        }
+    } catch (error) {
+        console.error('Error revoking user role:', error);
+        alert('Failed to revoke user role.');
+    }
+}
+
 // Поиск пользователя по email
 async function searchUserByEmail() {
     const email = document.getElementById('searchEmail').value;
@@ -319,7 +405,7 @@ async function createHabit() {
     const habit = { name, description };
 
     try {
-        const response = await fetch(`${apiBaseUrl}/api/habits`, {
+        const response = await authFetch(`${apiBaseUrl}/api/habits`, {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
@@ -353,7 +439,7 @@ async function updateHabit() {
     const habit = { id, name, description };
 
     try {
-        const response = await fetch(`${apiBaseUrl}/api/habits`, {
+        const response = await authFetch(`${apiBaseUrl}/api/habits`, {
             method: 'PUT',
             headers: {
                 'Content-Type': 'application/json',
@@ -383,7 +469,7 @@ async function deleteHabit() {
     }
 
     try {
-        const response = await fetch(`${apiBaseUrl}/api/habits?id=${id}`, {
+        const response = await authFetch(`${apiBaseUrl}/api/habits?id=${id}`, {
             method: 'DELETE',
         });
 
@@ -448,11 +534,11 @@ document.getElementById('assign-role-form').addEventListener('submit', async (ev
     const roleId = document.getElementById('role-id').value;
 
     try {
-        const response = await fetch(`${apiBaseUrl}/api/assign-role`, {
+        const response = await authFetch(`${apiBaseUrl}/api/assign-role`, {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
-                'Authorization': `Bearer ${localStorage.getItem('authToken')}`
+                ...authHeaders()
             },
             body: JSON.stringify({ user_id: parseInt(userId), role_id: parseInt(roleId) })
         });
@@ -474,10 +560,10 @@ document.getElementById('assign-role-form').addEventListener('submit', async (ev
 // Проверка доступа администратора
 async function checkAdminAccess() {
     try {
-        const response = await fetch(`${apiBaseUrl}/api/admin-action`, {
+        const response = await authFetch(`${apiBaseUrl}/api/admin-action`, {
             method: 'GET',
             headers: {
-                'Authorization': `Bearer ${localStorage.getItem('authToken')}`
+                ...authHeaders()
             }
         });
 
@@ -0,0 +1,91 @@
+// Общая авторизация страниц: заголовок с access-токеном и его обновление.
+// Access-токен живёт недолго (15 минут), поэтому при ответе 401 запрос
+// повторяется один раз после обмена refresh-токена на новую пару.
+const authBaseUrl = 'https://localhost:8080'; // Замените на нужный URL (или http://localhost:8080)
+
+// Заголовок авторизации с токеном, сохранённым при входе
+function authHeaders(headers = {}) {
+    const token = localStorage.getItem('token') || localStorage.getItem('authToken');
+    return token ? { ...headers, 'Authorization': `Bearer ${token}` } : headers;
+}
+
+// Удаление сохранённых токенов (выход или истёкшая сессия)
+function clearSession() {
+    localStorage.removeItem('username');
+    localStorage.removeItem('token');
+    localStorage.removeItem('authToken');
+    localStorage.removeItem('refreshToken');
+}
+
+let refreshInFlight = null;
+
+// Результат обмена refresh-токена
+const REFRESH_OK = 'ok';           // получена новая пара токенов
+const REFRESH_RETRY = 'retry';     // сервер временно недоступен (429, сеть) — сессия сохраняется
+const REFRESH_EXPIRED = 'expired'; // refresh-токен недействителен — нужен повторный вход
+
+const sleep = (ms) => new Promise((resolve) => setTimeout(resolve, ms));
+
+// Один запрос обмена refresh-токена
+async function requestTokenRefresh(refreshToken) {
+    try {
+        const response = await fetch(`${authBaseUrl}/token/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refreshToken }),
+        });
+        if (response.status === 429) {
+            return { result: REFRESH_RETRY, retryAfter: Number(response.headers.get('Retry-After')) || 1 };
+        }
+        if (!response.ok) {
+            return { result: REFRESH_EXPIRED };
+        }
+        const tokens = await response.json();
+        localStorage.setItem('token', tokens.token);
+        localStorage.setItem('refreshToken', tokens.refresh_token);
+        return { result: REFRESH_OK };
+    } catch (error) {
+        console.error('Token refresh error:', error);
+        return { result: REFRESH_RETRY, retryAfter: 1 };
+    }
+}
+
+// Обмен refresh-токена на новую пару. Refresh-токен одноразовый, поэтому
+// параллельные запросы ждут один общий обмен. Ответ 429 означает «повторить позже»,
+// а не истёкшую сессию: обмен повторяется один раз после паузы.
+function refreshAccessToken() {
+    if (!refreshInFlight) {
+        refreshInFlight = (async () => {
+            const refreshToken = localStorage.getItem('refreshToken');
+            if (!refreshToken) {
+                return REFRESH_EXPIRED;
+            }
+            const first = await requestTokenRefresh(refreshToken);
+            if (first.result !== REFRESH_RETRY) {
+                return first.result;
+            }
+            await sleep(Math.min(first.retryAfter, 5) * 1000);
+            return (await requestTokenRefresh(refreshToken)).result;
+        })().finally(() => { refreshInFlight = null; });
+    }
+    return refreshInFlight;
+}
+
+// fetch с авторизацией: при 401 обновляет токен и повторяет запрос.
+// Если refresh-токен недействителен, сессия очищается и открывается страница входа;
+// при временной ошибке обмена возвращается исходный ответ, а сессия сохраняется.
+async function authFetch(url, options = {}) {
+    const response = await fetch(url, { ...options, headers: authHeaders(options.headers) });
+    if (response.status !== 401 || !localStorage.getItem('refreshToken')) {
+        return response;
+    }
+    const refreshed = await refreshAccessToken();
+    if (refreshed === REFRESH_OK) {
+        return fetch(url, { ...options, headers: authHeaders(options.headers) });
+    }
+    if (refreshed === REFRESH_EXPIRED) {
+        clearSession();
+        window.location.href = 'login.html';
+    }
+    return response;
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/emailSender"
+	"HabitMaster/emailTemplates"
+	"HabitMaster/envConfig"
+	"HabitMaster/preferences"
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var accountLog = logrus.New()
+
+func init() {
+	accountLog.SetFormatter(&logrus.JSONFormatter{})
+	accountLog.SetLevel(logrus.InfoLevel)
+}
+
+// accountDeletionGrace — через сколько после запроса аккаунт удаляется окончательно
+func accountDeletionGrace() time.Duration {
+	return envConfig.Duration("ACCOUNT_DELETION_GRACE", 14*24*time.Hour)
+}
+
+// DeleteAccount — DELETE /api/me, планирует удаление аккаунта после отсрочки.
+// Все сессии и API-токены отзываются сразу; до окончания отсрочки можно
+// войти снова и отменить удаление через POST /api/me/cancel-deletion.
+func DeleteAccount(db *sql.DB, emailService emailSender.EmailSender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		var request struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Password == "" {
+			jsonError(w, "Password is required to delete the account", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		var email, passwordHash string
+		var scheduled sql.NullTime
+		err = tx.QueryRow(`SELECT email, password, deletion_scheduled_for FROM users WHERE user_id = $1 FOR UPDATE`,
+			principal.UserID).Scan(&email, &passwordHash, &scheduled)
+		if err != nil {
+			accountLog.WithFields(logrus.Fields{"error": err.Error(), "user_id": principal.UserID}).Error("Failed to load account")
+			jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(request.Password)) != nil {
+			jsonError(w, "Invalid password", http.StatusUnauthorized)
+			return
+		}
+		if scheduled.Valid {
+			jsonError(w, "Account deletion is already scheduled", http.StatusConflict)
+			return
+		}
+
+		scheduledFor := time.Now().Add(accountDeletionGrace())
+		_, err = tx.Exec(`UPDATE users SET deletion_scheduled_for = $1, updated_at = NOW() WHERE user_id = $2`,
+			scheduledFor, principal.UserID)
+		if err == nil {
+			err = auth.RevokeAllAccess(tx, principal.UserID, "account_deletion")
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			accountLog.WithFields(logrus.Fields{"error": err.Error(), "user_id": principal.UserID}).Error("Failed to schedule account deletion")
+			jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		prefs, err := preferences.Load(db, principal.UserID)
+		if err != nil {
+			prefs = preferences.Default()
+		}
+		go func() {
+			message, err := emailTemplates.Render(emailTemplates.AccountDeletion, prefs.Locale, emailTemplates.Data{
+				"ScheduledFor": scheduledFor.In(prefs.Location()).Format("2006-01-02 15:04 MST"),
+			})
+			if err == nil {
+				err = emailService.SendMultipartEmail([]string{email}, message.Subject, message.HTML, message.Text)
+			}
+			if err != nil {
+				accountLog.WithFields(logrus.Fields{"error": err.Error(), "user_id": principal.UserID}).Warn("Failed to send deletion email")
+			}
+		}()
+
+		accountLog.WithFields(logrus.Fields{"user_id": principal.UserID, "scheduled_for": scheduledFor}).Info("Account deletion scheduled")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":       "Account deletion scheduled",
+			"scheduled_for": scheduledFor,
+		})
+	}
+}
+
+// CancelAccountDeletion — POST /api/me/cancel-deletion, отменяет запланированное удаление
+func CancelAccountDeletion(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		res, err := db.Exec(`UPDATE users SET deletion_scheduled_for = NULL, updated_at = NOW()
+			WHERE user_id = $1 AND deletion_scheduled_for IS NOT NULL`, principal.UserID)
+		if err != nil {
+			jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, "Account deletion is not scheduled", http.StatusNotFound)
+			return
+		}
+
+		accountLog.WithField("user_id", principal.UserID).Info("Account deletion cancelled")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Account deletion cancelled"})
+	}
+}
+
+// purgeAccount окончательно удаляет пользователя. Привычки, цели с прогрессом,
+// сессии и токены удаляются каскадно по внешним ключам.
+func purgeAccount(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`DELETE FROM revisions WHERE (entity_type = 'goal' AND entity_id IN (SELECT id FROM goals WHERE user_id = $1))
+		    OR (entity_type = 'habit' AND entity_id IN (SELECT id FROM habits WHERE user_id = $1))`,
+		`UPDATE revisions SET changed_by = NULL WHERE changed_by = $1`,
+		`DELETE FROM login_attempts WHERE user_id = $1`,
+		`DELETE FROM users WHERE user_id = $1 AND deletion_scheduled_for <= NOW()`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PurgeDueAccounts удаляет аккаунты, у которых истекла отсрочка
+func PurgeDueAccounts(db *sql.DB) {
+	rows, err := db.Query(`SELECT user_id FROM users WHERE deletion_scheduled_for <= NOW()`)
+	if err != nil {
+		accountLog.WithError(err).Error("Failed to find accounts due for deletion")
+		return
+	}
+	var due []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			due = append(due, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range due {
+		if err := purgeAccount(db, id); err != nil {
+			accountLog.WithFields(logrus.Fields{"error": err.Error(), "user_id": id}).Error("Failed to purge account")
+			continue
+		}
+		accountLog.WithField("user_id", id).Info("Account purged")
+	}
+}
+
+// StartAccountPurger периодически удаляет аккаунты с истёкшей отсрочкой
+func StartAccountPurger(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			PurgeDueAccounts(db)
+			<-ticker.C
+		}
+	}()
+}
+
+// exportQueries — что попадает в архив с данными пользователя (файл → запрос)
+var exportQueries = []struct {
+	file  string
+	query string
+}{
+	{"profile.json", `SELECT user_id, name, email, role, is_verified, totp_enabled, created_at, updated_at, deletion_scheduled_for
+		FROM users WHERE user_id = $1`},
+	{"permissions.json", `SELECT p.permission FROM role_permissions p JOIN roles r ON r.id = p.role_id
+		JOIN users u ON u.role = r.name WHERE u.user_id = $1 ORDER BY p.permission`},
+	{"habits.json", `SELECT id, name, description, created_at, updated_at FROM habits WHERE user_id = $1 ORDER BY id`},
+	{"goals.json", `SELECT ` + goalColumns + ` FROM goals WHERE user_id = $1 ORDER BY id`},
+	{"goal_progress.json", `SELECT p.goal_id, p.value, p.note, p.recorded_at
+		FROM goal_progress p JOIN goals g ON g.id = p.goal_id WHERE g.user_id = $1 ORDER BY p.goal_id, p.recorded_at`},
+	{"revisions.json", `SELECT entity_type, entity_id, version, action, snapshot, changed_at
+		FROM revisions WHERE changed_by = $1 ORDER BY changed_at`},
+	{"sessions.json", `SELECT id, user_agent, ip, created_at, last_seen_at, revoked_at, revoked_reason
+		FROM sessions WHERE user_id = $1 ORDER BY created_at`},
+	{"login_history.json", `SELECT email, ip, user_agent, success, reason, created_at
+		FROM login_attempts WHERE user_id = $1 ORDER BY created_at`},
+	{"devices.json", `SELECT user_agent, ip, ip_range, first_seen_at, last_seen_at
+		FROM known_devices WHERE user_id = $1 ORDER BY first_seen_at`},
+	{"api_tokens.json", `SELECT name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_tokens WHERE user_id = $1 ORDER BY created_at`},
+	{"linked_accounts.json", `SELECT issuer, subject, email, created_at, last_login_at
+		FROM user_identities WHERE user_id = $1`},
+}
+
+// ExportFileNames — имена файлов в архиве с данными пользователя
+func ExportFileNames() []string {
+	names := make([]string, len(exportQueries))
+	for i, q := range exportQueries {
+		names[i] = q.file
+	}
+	return names
+}
+
+// exportRows выполняет запрос и возвращает строки как JSON-объекты «колонка → значение»
+func exportRows(db *sql.DB, query string, userID int) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			record[column] = values[i]
+		}
+		result = append(result, record)
+	}
+	return result, rows.Err()
+}
+
+// ExportAccount — GET /api/me/export, ZIP-архив со всеми данными пользователя
+func ExportAccount(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
+		// Собираем всё до начала ответа, чтобы при ошибке вернуть корректный статус
+		files := make(map[string][]map[string]interface{}, len(exportQueries))
+		for _, q := range exportQueries {
+			records, err := exportRows(db, q.query, principal.UserID)
+			if err != nil {
+				accountLog.WithFields(logrus.Fields{"error": err.Error(), "file": q.file}).Error("Failed to export account data")
+				jsonError(w, "Failed to export account data", http.StatusInternalServerError)
+				return
+			}
+			files[q.file] = records
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="habitmaster-export-%d-%s.zip"`, principal.UserID, time.Now().Format("20060102")))
+
+		archive := zip.NewWriter(w)
+		for _, q := range exportQueries {
+			f, err := archive.Create(q.file)
+			if err == nil {
+				encoder := json.NewEncoder(f)
+				encoder.SetIndent("", "  ")
+				err = encoder.Encode(files[q.file])
+			}
+			if err != nil {
+				accountLog.WithFields(logrus.Fields{"error": err.Error(), "file": q.file}).Error("Failed to write export archive")
+				return
+			}
+		}
+		if err := archive.Close(); err != nil {
+			accountLog.WithError(err).Error("Failed to finish export archive")
+			return
+		}
+		accountLog.WithField("user_id", principal.UserID).Info("Account data exported")
+	}
+}
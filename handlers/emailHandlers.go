@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"HabitMaster/emailSender"
+	"HabitMaster/preferences"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/mail"
 	"strings"
+	"time"
 )
 
 // MassEmailRequest структура для массовой рассылки
@@ -24,18 +28,88 @@ type SupportEmailRequest struct {
 	Body    string `json:"body"`
 }
 
+// maxEmailRecipients — ограничение числа получателей одного письма администратора
+const maxEmailRecipients = 500
+
+// parseRecipients разбирает список адресов через запятую, пропуская пустые и повторы
+func parseRecipients(value string) ([]string, error) {
+	seen := make(map[string]bool)
+	var recipients []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q", part)
+		}
+		email := strings.ToLower(addr.Address)
+		if !seen[email] {
+			seen[email] = true
+			recipients = append(recipients, addr.Address)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("at least one recipient is required")
+	}
+	if len(recipients) > maxEmailRecipients {
+		return nil, fmt.Errorf("too many recipients: %d (max %d)", len(recipients), maxEmailRecipients)
+	}
+	return recipients, nil
+}
+
+// recordAdminEmail записывает отправку администратора в журнал admin_email_log.
+// Письма уходят через очередь, поэтому успешная запись означает «поставлено в очередь»;
+// доставку видно в /api/admin/email-outbox.
+func recordAdminEmail(db *sql.DB, r *http.Request, kind, subject string, recipients int, attachment string, sendErr error) {
+	status, errorText := "queued", ""
+	if sendErr != nil {
+		status, errorText = "failed", sendErr.Error()
+	}
+	_, err := db.Exec(`INSERT INTO admin_email_log (actor_id, kind, subject, recipients_count, attachment_name, status, error, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		changedBy(r), kind, subject, recipients, attachment, status, errorText, r.RemoteAddr)
+	if err != nil {
+		log.Printf("Failed to record admin email: %v", err)
+	}
+}
+
 // SendMassEmailHandler обработчик для массовой рассылки
-func SendMassEmailHandler(emailSender emailSender.EmailSender) http.HandlerFunc {
+func SendMassEmailHandler(db *sql.DB, emailSender emailSender.EmailSender) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		r.ParseMultipartForm(10 << 20) // Ограничение размера файла (10MB)
 
 		// Получаем данные формы
-		recipients := r.FormValue("recipients")
 		subject := r.FormValue("subject")
 		body := r.FormValue("body")
+		if subject == "" || body == "" {
+			http.Error(w, "Subject and body are required", http.StatusBadRequest)
+			return
+		}
 
 		// Преобразуем строку получателей в массив
-		to := strings.Split(recipients, ",")
+		to, err := parseRecipients(r.FormValue("recipients"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Рассылка — это product_updates: отписавшиеся её не получают
+		requested := len(to)
+		to, err = preferences.FilterRecipients(db, to, preferences.EmailProductUpdates)
+		if err != nil {
+			http.Error(w, "Failed to load recipient preferences", http.StatusInternalServerError)
+			return
+		}
+		if skipped := requested - len(to); skipped > 0 {
+			log.Printf("Skipping %d recipients who opted out of product updates", skipped)
+		}
+		if len(to) == 0 {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, "No recipients accept product updates")
+			return
+		}
 
 		// Получаем файл
 		file, handler, err := r.FormFile("attachment")
@@ -52,7 +126,7 @@ func SendMassEmailHandler(emailSender emailSender.EmailSender) http.HandlerFunc
 		}
 
 		// Отправляем email с файлом (если он был)
-		log.Printf("Sending email to: %v, subject: %s, file: %s, file size: %d bytes", to, subject, fileName, len(fileBytes))
+		log.Printf("Sending email to %d recipients, subject: %s, file: %s, file size: %d bytes", len(to), subject, fileName, len(fileBytes))
 		err = emailSender.SendEmailWithAttachment(
 			to,
 			subject,
@@ -60,6 +134,7 @@ func SendMassEmailHandler(emailSender emailSender.EmailSender) http.HandlerFunc
 			fileName,
 			fileBytes,
 		)
+		recordAdminEmail(db, r, "mass", subject, len(to), fileName, err)
 		if err != nil {
 			http.Error(w, "Failed to send email", http.StatusInternalServerError)
 			return
@@ -91,7 +166,7 @@ func SendSupportEmailHandler(emailSender emailSender.EmailSender) http.HandlerFu
 }
 
 // SendEmailWithAttachmentHandler обработчик для отправки email с вложением
-func SendEmailWithAttachmentHandler(emailSender emailSender.EmailSender) http.HandlerFunc {
+func SendEmailWithAttachmentHandler(db *sql.DB, emailSender emailSender.EmailSender) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := r.ParseMultipartForm(10 << 20) // Ограничение на размер данных 10 MB
 		if err != nil {
@@ -100,7 +175,11 @@ func SendEmailWithAttachmentHandler(emailSender emailSender.EmailSender) http.Ha
 		}
 
 		// Получаем значения из формы
-		recipients := r.FormValue("recipients")
+		recipients, err := parseRecipients(r.FormValue("recipients"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		subject := r.FormValue("subject")
 		body := r.FormValue("body")
 
@@ -120,13 +199,15 @@ func SendEmailWithAttachmentHandler(emailSender emailSender.EmailSender) http.Ha
 		}
 
 		// Отправка email с вложением
-		if err := emailSender.SendEmailWithAttachment(
-			strings.Split(recipients, ","),
+		err = emailSender.SendEmailWithAttachment(
+			recipients,
 			subject,
 			body,
 			header.Filename,
 			fileBytes,
-		); err != nil {
+		)
+		recordAdminEmail(db, r, "attachment", subject, len(recipients), header.Filename, err)
+		if err != nil {
 			http.Error(w, "Failed to send email with attachment", http.StatusInternalServerError)
 			return
 		}
@@ -135,3 +216,49 @@ func SendEmailWithAttachmentHandler(emailSender emailSender.EmailSender) http.Ha
 		w.Write([]byte("Email with attachment sent successfully"))
 	}
 }
+
+// AdminEmailLogEntry — запись журнала отправок администраторов
+type AdminEmailLogEntry struct {
+	ID              int       `json:"id"`
+	ActorID         *int      `json:"actor_id"`
+	ActorEmail      *string   `json:"actor_email"`
+	Kind            string    `json:"kind"`
+	Subject         string    `json:"subject"`
+	RecipientsCount int       `json:"recipients_count"`
+	AttachmentName  string    `json:"attachment_name,omitempty"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// GetAdminEmailLog — GET /api/admin/email-log, последние отправки администраторов
+func GetAdminEmailLog(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := queryInt(r, "limit", 100)
+		if limit > 500 {
+			limit = 500
+		}
+		rows, err := db.Query(`SELECT l.id, l.actor_id, u.email, l.kind, l.subject, l.recipients_count,
+				l.attachment_name, l.status, l.error, l.created_at
+			FROM admin_email_log l LEFT JOIN users u ON u.user_id = l.actor_id
+			ORDER BY l.created_at DESC LIMIT $1`, limit)
+		if err != nil {
+			jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		entries := []AdminEmailLogEntry{}
+		for rows.Next() {
+			var e AdminEmailLogEntry
+			if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.Kind, &e.Subject, &e.RecipientsCount,
+				&e.AttachmentName, &e.Status, &e.Error, &e.CreatedAt); err != nil {
+				jsonError(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			entries = append(entries, e)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"HabitMaster/emailSender"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// GetEmailOutbox — GET /api/admin/email-outbox?status=pending|sending|sent|dead&limit=N,
+// последние письма очереди без текста и вложений
+func GetEmailOutbox(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", emailSender.StatusPending, emailSender.StatusSending, emailSender.StatusSent, emailSender.StatusDead:
+		default:
+			jsonError(w, "Invalid status filter", http.StatusBadRequest)
+			return
+		}
+		limit := queryInt(r, "limit", 100)
+		if limit > 500 {
+			limit = 500
+		}
+
+		messages, err := emailSender.ListOutbox(db, status, limit)
+		if err != nil {
+			jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(messages)
+	}
+}
+
+// GetEmailOutboxMessage — GET /api/admin/email-outbox/{id}, письмо вместе с текстом.
+// Текст писем с секретом не возвращается, у отправленных писем он уже стёрт.
+func GetEmailOutboxMessage(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			jsonError(w, "Invalid message id", http.StatusBadRequest)
+			return
+		}
+
+		message, err := emailSender.GetOutboxMessage(db, id)
+		if err == sql.ErrNoRows {
+			jsonError(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(message)
+	}
+}
+
+// RetryEmailOutboxMessage — POST /api/admin/email-outbox/{id}/retry, повторная отправка
+// письма из dead (или ожидающего повтора) с полным числом попыток. Письма с секретом
+// из dead не повторяются.
+func RetryEmailOutboxMessage(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			jsonError(w, "Invalid message id", http.StatusBadRequest)
+			return
+		}
+
+		switch err := emailSender.RetryOutboxMessage(db, id); err {
+		case nil:
+		case sql.ErrNoRows:
+			jsonError(w, "Message not found", http.StatusNotFound)
+			return
+		case emailSender.ErrMessageNotRetryable:
+			jsonError(w, "Message has already been sent, is being sent or contains a secret and cannot be resent", http.StatusConflict)
+			return
+		default:
+			jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		logrus.WithField("message_id", id).Info("Outbox message queued for retry")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Message queued for retry"})
+	}
+}
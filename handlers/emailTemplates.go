@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"HabitMaster/emailTemplates"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// GetEmailTemplates — GET /api/admin/email-templates, имена шаблонов писем и доступные языки
+func GetEmailTemplates() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{
+			"templates": emailTemplates.Names(),
+			"locales":   emailTemplates.Locales(),
+		})
+	}
+}
+
+// PreviewEmailTemplate — GET /api/admin/email-templates/{name}/preview?locale=ru&format=html|text|json,
+// шаблон, собранный с данными-примерами. По умолчанию — HTML-версия письма.
+func PreviewEmailTemplate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		data, ok := emailTemplates.Sample(name)
+		if !ok {
+			jsonError(w, "Template not found", http.StatusNotFound)
+			return
+		}
+
+		locale := r.URL.Query().Get("locale")
+		if locale == "" {
+			locale = emailTemplates.DefaultLocale
+		}
+		if !emailTemplates.HasLocale(locale) {
+			jsonError(w, "Unsupported locale", http.StatusBadRequest)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "", "html", "text", "json":
+		default:
+			jsonError(w, "Invalid format, expected html, text or json", http.StatusBadRequest)
+			return
+		}
+
+		message, err := emailTemplates.Render(name, locale, data)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"error": err.Error(), "template": name, "locale": locale}).Error("Failed to render email template")
+			jsonError(w, "Failed to render template", http.StatusInternalServerError)
+			return
+		}
+
+		switch format {
+		case "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte("Subject: " + message.Subject + "\n\n" + message.Text))
+		case "json":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(message)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(message.HTML))
+		}
+	}
+}
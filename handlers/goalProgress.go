@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// Направления изменения метрики
+const (
+	MetricIncrease = "increase"
+	MetricDecrease = "decrease"
+)
+
+// progressRateWindow — за какой период берётся скорость для прогноза
+const progressRateWindow = 30 * 24 * time.Hour
+
+// GoalMetric — измеримая метрика цели (килограммы, сэкономленные деньги, страницы)
+type GoalMetric struct {
+	Unit      string  `json:"unit"`
+	Start     float64 `json:"start"`
+	Target    float64 `json:"target"`
+	Direction string  `json:"direction"`
+
+	// Вычисляемые поля, в запросах игнорируются
+	Current             float64 `json:"current"`
+	PercentComplete     float64 `json:"percent_complete"`
+	ProjectedCompletion *string `json:"projected_completion"`
+	OnTrack             *bool   `json:"on_track"`
+}
+
+// ProgressEntry — запись о прогрессе по метрике цели
+type ProgressEntry struct {
+	ID         int       `json:"id"`
+	GoalID     int       `json:"goal_id"`
+	Value      float64   `json:"value"`
+	Note       string    `json:"note"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// goalMetricColumns — колонки метрики в таблице goals
+const goalMetricColumns = "metric_unit, metric_start, metric_target, metric_direction"
+
+// nullableMetric — метрика в том виде, как она хранится в БД
+type nullableMetric struct {
+	unit      sql.NullString
+	start     sql.NullFloat64
+	target    sql.NullFloat64
+	direction sql.NullString
+}
+
+func (m *nullableMetric) dest() []interface{} {
+	return []interface{}{&m.unit, &m.start, &m.target, &m.direction}
+}
+
+func (m nullableMetric) metric() *GoalMetric {
+	if !m.unit.Valid || !m.start.Valid || !m.target.Valid {
+		return nil
+	}
+	return &GoalMetric{
+		Unit:      m.unit.String,
+		Start:     m.start.Float64,
+		Target:    m.target.Float64,
+		Direction: m.direction.String,
+		Current:   m.start.Float64,
+	}
+}
+
+// metricArgs — значения колонок метрики для INSERT/UPDATE
+func metricArgs(m *GoalMetric) []interface{} {
+	if m == nil {
+		return []interface{}{nil, nil, nil, nil}
+	}
+	return []interface{}{m.Unit, m.Start, m.Target, m.Direction}
+}
+
+// ValidateMetric проверяет метрику и определяет направление, если оно не задано
+func ValidateMetric(m *GoalMetric) error {
+	if m == nil {
+		return nil
+	}
+	m.Unit = strings.TrimSpace(m.Unit)
+	if m.Unit == "" {
+		return errors.New("metric unit is required")
+	}
+	if m.Start == m.Target {
+		return errors.New("metric target must differ from start")
+	}
+
+	if m.Direction == "" {
+		m.Direction = MetricIncrease
+		if m.Target < m.Start {
+			m.Direction = MetricDecrease
+		}
+	}
+	switch m.Direction {
+	case MetricIncrease:
+		if m.Target < m.Start {
+			return errors.New("target must be greater than start for an increasing metric")
+		}
+	case MetricDecrease:
+		if m.Target > m.Start {
+			return errors.New("target must be less than start for a decreasing metric")
+		}
+	default:
+		return errors.New("metric direction must be 'increase' or 'decrease'")
+	}
+	return nil
+}
+
+// parseGoalTime разбирает даты из БД и запросов (timestamp или YYYY-MM-DD)
+func parseGoalTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ComputeGoalProgress заполняет текущее значение, процент выполнения и прогноз
+// даты достижения цели по скорости за последние progressRateWindow.
+// entries должны быть отсортированы по времени.
+func ComputeGoalProgress(m *GoalMetric, createdAt time.Time, deadline string, entries []ProgressEntry, now time.Time) {
+	if m == nil {
+		return
+	}
+	m.Current = m.Start
+	m.PercentComplete = 0
+	m.ProjectedCompletion = nil
+	m.OnTrack = nil
+
+	if len(entries) > 0 {
+		m.Current = entries[len(entries)-1].Value
+	}
+
+	total := m.Target - m.Start
+	done := m.Current - m.Start
+	m.PercentComplete = math.Max(0, math.Min(100, math.Round(done/total*10000)/100))
+
+	var projected *time.Time
+	if m.PercentComplete >= 100 {
+		reachedAt := createdAt
+		if len(entries) > 0 {
+			reachedAt = entries[len(entries)-1].RecordedAt
+		}
+		projected = &reachedAt
+	} else if len(entries) > 0 {
+		// Скорость считаем от самой ранней точки в окне до последней записи
+		last := entries[len(entries)-1]
+		fromValue, fromTime := m.Start, createdAt
+		if len(entries) > 1 {
+			fromValue, fromTime = entries[len(entries)-2].Value, entries[len(entries)-2].RecordedAt
+		}
+		for _, entry := range entries[:len(entries)-1] {
+			if now.Sub(entry.RecordedAt) <= progressRateWindow {
+				fromValue, fromTime = entry.Value, entry.RecordedAt
+				break
+			}
+		}
+
+		elapsed := last.RecordedAt.Sub(fromTime)
+		if elapsed > 0 {
+			rate := (last.Value - fromValue) / elapsed.Hours()
+			remaining := m.Target - last.Value
+			// Прогноз возможен, только если движение идёт в сторону цели
+			if rate != 0 && (rate > 0) == (remaining > 0) {
+				eta := last.RecordedAt.Add(time.Duration(remaining / rate * float64(time.Hour)))
+				projected = &eta
+			}
+		}
+	}
+
+	if projected != nil {
+		value := projected.UTC().Format(time.RFC3339)
+		m.ProjectedCompletion = &value
+	}
+
+	if due, ok := parseGoalTime(deadline); ok {
+		// Дедлайн включает весь последний день
+		due = due.Add(24 * time.Hour)
+		onTrack := projected != nil && !projected.After(due)
+		m.OnTrack = &onTrack
+	}
+}
+
+// loadProgressEntries возвращает записи прогресса для целей, сгруппированные по goal_id
+func loadProgressEntries(db *sql.DB, goalIDs []int) (map[int][]ProgressEntry, error) {
+	rows, err := db.Query(`
+		SELECT id, goal_id, value, note, recorded_at
+		FROM goal_progress WHERE goal_id = ANY($1)
+		ORDER BY recorded_at, id`, pq.Array(goalIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make(map[int][]ProgressEntry)
+	for rows.Next() {
+		var e ProgressEntry
+		if err := rows.Scan(&e.ID, &e.GoalID, &e.Value, &e.Note, &e.RecordedAt); err != nil {
+			return nil, err
+		}
+		entries[e.GoalID] = append(entries[e.GoalID], e)
+	}
+	return entries, rows.Err()
+}
+
+// attachProgress вычисляет прогресс для всех целей с метрикой
+func attachProgress(db *sql.DB, goals []Goal) error {
+	var ids []int
+	for _, g := range goals {
+		if g.Metric != nil {
+			ids = append(ids, g.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	entries, err := loadProgressEntries(db, ids)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range goals {
+		g := &goals[i]
+		if g.Metric == nil {
+			continue
+		}
+		// Без даты создания прогноз считался бы от нулевого времени
+		createdAt, ok := parseGoalTime(g.CreatedAt)
+		if !ok {
+			return fmt.Errorf("goal %d has invalid created_at %q", g.ID, g.CreatedAt)
+		}
+		ComputeGoalProgress(g.Metric, createdAt, g.Deadline, entries[g.ID], now)
+	}
+	return nil
+}
+
+// loadGoal читает одну цель вместе с метрикой
+func loadGoal(db *sql.DB, id int) (Goal, error) {
+	return scanGoal(db.QueryRow("SELECT "+goalColumns+" FROM goals WHERE id = $1", id))
+}
+
+// AddGoalProgress — Обработчик для добавления записи о прогрессе цели
+func AddGoalProgress(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		goalID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid goal id", http.StatusBadRequest)
+			return
+		}
+
+		var input struct {
+			Value      *float64 `json:"value"`
+			Note       string   `json:"note"`
+			RecordedAt string   `json:"recorded_at"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Value == nil {
+			http.Error(w, "Field 'value' is required", http.StatusBadRequest)
+			return
+		}
+
+		recordedAt := time.Now()
+		if input.RecordedAt != "" {
+			t, ok := parseGoalTime(input.RecordedAt)
+			if !ok {
+				http.Error(w, "Invalid recorded_at", http.StatusBadRequest)
+				return
+			}
+			recordedAt = t
+		}
+
+		goal, err := loadGoal(db, goalID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Goal not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			goalLog.WithFields(logrus.Fields{"error": err.Error(), "goal_id": goalID}).Error("Failed to load goal")
+			http.Error(w, "Failed to add progress", http.StatusInternalServerError)
+			return
+		}
+		if goal.Metric == nil {
+			http.Error(w, "Goal has no measurable metric", http.StatusBadRequest)
+			return
+		}
+
+		entry := ProgressEntry{GoalID: goalID, Value: *input.Value, Note: input.Note}
+		err = db.QueryRow(`
+			INSERT INTO goal_progress (goal_id, value, note, recorded_at)
+			VALUES ($1, $2, $3, $4) RETURNING id, recorded_at`,
+			goalID, entry.Value, entry.Note, recordedAt).Scan(&entry.ID, &entry.RecordedAt)
+		if err != nil {
+			goalLog.WithFields(logrus.Fields{"error": err.Error(), "goal_id": goalID}).Error("Failed to add progress")
+			http.Error(w, "Failed to add progress", http.StatusInternalServerError)
+			return
+		}
+
+		goalLog.WithFields(logrus.Fields{"goal_id": goalID, "value": entry.Value}).Info("Progress entry added")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+// GetGoalProgress — Обработчик для получения прогресса цели и всех её записей
+func GetGoalProgress(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		goalID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid goal id", http.StatusBadRequest)
+			return
+		}
+
+		goal, err := loadGoal(db, goalID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Goal not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			goalLog.WithFields(logrus.Fields{"error": err.Error(), "goal_id": goalID}).Error("Failed to load goal")
+			http.Error(w, "Failed to retrieve progress", http.StatusInternalServerError)
+			return
+		}
+
+		entries, err := loadProgressEntries(db, []int{goalID})
+		if err != nil {
+			goalLog.WithFields(logrus.Fields{"error": err.Error(), "goal_id": goalID}).Error("Failed to load progress")
+			http.Error(w, "Failed to retrieve progress", http.StatusInternalServerError)
+			return
+		}
+
+		createdAt, _ := parseGoalTime(goal.CreatedAt)
+		ComputeGoalProgress(goal.Metric, createdAt, goal.Deadline, entries[goalID], time.Now())
+
+		list := entries[goalID]
+		if list == nil {
+			list = []ProgressEntry{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"goal":    goal,
+			"entries": list,
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"strconv"
@@ -18,6 +19,39 @@ type Goal struct {
 	Deadline    string `json:"deadline"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
+
+	// Metric — измеримая метрика цели, nil для обычных целей
+	Metric *GoalMetric `json:"metric,omitempty"`
+
+	// OKR: объектив (без ParentID) или ключевой результат со Score от 0.0 до 1.0
+	ParentID *int     `json:"parent_id,omitempty"`
+	Weight   float64  `json:"weight,omitempty"`
+	Score    *float64 `json:"score,omitempty"`
+	Quarter  string   `json:"quarter,omitempty"`
+}
+
+// goalColumns — колонки, которые читаются для каждой цели
+const goalColumns = "id, name, description, deadline, created_at, updated_at, " + goalMetricColumns + ", " + goalOKRColumns
+
+// rowScanner — общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanGoal читает цель вместе с метрикой и OKR-полями (порядок колонок — goalColumns)
+func scanGoal(row rowScanner) (Goal, error) {
+	var g Goal
+	var nm nullableMetric
+	var okr nullableOKR
+	dest := []interface{}{&g.ID, &g.Name, &g.Description, &g.Deadline, &g.CreatedAt, &g.UpdatedAt}
+	dest = append(dest, nm.dest()...)
+	dest = append(dest, okr.dest()...)
+	if err := row.Scan(dest...); err != nil {
+		return g, err
+	}
+	g.Metric = nm.metric()
+	okr.apply(&g)
+	return g, nil
 }
 
 var goalLog = logrus.New()
@@ -43,13 +77,33 @@ func CreateGoal(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		if err := ValidateMetric(goal.Metric); err != nil {
+			goalLog.WithField("error", err.Error()).Error("Invalid metric for goal creation")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := validateKeyResult(db, &goal); err != nil {
+			goalLog.WithField("error", err.Error()).Error("Invalid OKR fields for goal creation")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		query := `
-            INSERT INTO goals (name, description, deadline, created_at, updated_at)
-            VALUES ($1, $2, $3, NOW(), NOW())
+            INSERT INTO goals (name, description, deadline, created_at, updated_at,
+                               metric_unit, metric_start, metric_target, metric_direction,
+                               parent_id, weight, score, quarter, user_id)
+            VALUES ($1, $2, $3, NOW(), NOW(), $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12)
             RETURNING id, created_at, updated_at
         `
-		err := db.QueryRow(query, goal.Name, goal.Description, goal.Deadline).
-			Scan(&goal.ID, &goal.CreatedAt, &goal.UpdatedAt)
+		owner := changedBy(r)
+		args := append([]interface{}{goal.Name, goal.Description, goal.Deadline}, metricArgs(goal.Metric)...)
+		args = append(args, goal.ParentID, goal.Weight, goal.Score, goal.Quarter, owner)
+		err := goalRevisions.create(db, owner, func(tx *sql.Tx) (int, error) {
+			err := tx.QueryRow(query, args...).
+				Scan(&goal.ID, &goal.CreatedAt, &goal.UpdatedAt)
+			return goal.ID, err
+		})
 		if err != nil {
 			goalLog.WithFields(logrus.Fields{
 				"error":       err.Error(),
@@ -68,6 +122,14 @@ func CreateGoal(db *sql.DB) http.HandlerFunc {
 			"deadline":    goal.Deadline,
 		}).Info("Goal created successfully")
 
+		// Текущее значение и процент считаются так же, как в GetGoals. Цель уже сохранена,
+		// поэтому ошибка расчёта только записывается в лог.
+		created := []Goal{goal}
+		if err := attachProgress(db, created); err != nil {
+			goalLog.WithFields(logrus.Fields{"error": err.Error(), "id": goal.ID}).Error("Failed to load goal progress")
+		}
+		goal = created[0]
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(goal)
 	}
@@ -87,7 +149,7 @@ func GetGoals(db *sql.DB) http.HandlerFunc {
 			offset = (p - 1) * limit
 		}
 
-		query := "SELECT id, name, description, deadline, created_at, updated_at FROM goals"
+		query := "SELECT " + goalColumns + " FROM goals"
 		var args []interface{}
 
 		// Фильтрация по имени (ILIKE '%filter%')
@@ -131,15 +193,8 @@ func GetGoals(db *sql.DB) http.HandlerFunc {
 
 		var goals []Goal
 		for rows.Next() {
-			var g Goal
-			if err := rows.Scan(
-				&g.ID,
-				&g.Name,
-				&g.Description,
-				&g.Deadline,
-				&g.CreatedAt,
-				&g.UpdatedAt,
-			); err != nil {
+			g, err := scanGoal(rows)
+			if err != nil {
 				goalLog.WithFields(logrus.Fields{
 					"error": err.Error(),
 				}).Error("Failed to scan goals row")
@@ -149,6 +204,13 @@ func GetGoals(db *sql.DB) http.HandlerFunc {
 			goals = append(goals, g)
 		}
 
+		// Текущее значение, процент и прогноз для измеримых целей
+		if err := attachProgress(db, goals); err != nil {
+			goalLog.WithField("error", err.Error()).Error("Failed to load goal progress")
+			http.Error(w, "Failed to retrieve goals", http.StatusInternalServerError)
+			return
+		}
+
 		// Если целей нет, вернём пустой массив []
 		w.Header().Set("Content-Type", "application/json")
 		if len(goals) == 0 {
@@ -165,10 +227,14 @@ func GetGoals(db *sql.DB) http.HandlerFunc {
 func UpdateGoal(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var input struct {
-			OldName     string `json:"oldName"`
-			Name        string `json:"name"`
-			Description string `json:"description"`
-			Deadline    string `json:"deadline"`
+			OldName     string      `json:"oldName"`
+			Name        string      `json:"name"`
+			Description string      `json:"description"`
+			Deadline    string      `json:"deadline"`
+			Metric      *GoalMetric `json:"metric"`
+			Weight      *float64    `json:"weight"`
+			Score       *float64    `json:"score"`
+			Quarter     *string     `json:"quarter"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -177,12 +243,47 @@ func UpdateGoal(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := `
-            UPDATE goals
-            SET name = $1, description = $2, deadline = $3, updated_at = NOW()
-            WHERE name = $4
-        `
-		res, err := db.Exec(query, input.Name, input.Description, input.Deadline, input.OldName)
+		if err := ValidateMetric(input.Metric); err != nil {
+			goalLog.WithField("error", err.Error()).Error("Invalid metric for goal update")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := validateOKRValues(input.Weight, input.Score, input.Quarter); err != nil {
+			goalLog.WithField("error", err.Error()).Error("Invalid OKR fields for goal update")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Метрика и OKR-поля меняются, только если они переданы в запросе
+		sets := []string{"name = $1", "description = $2", "deadline = $3", "updated_at = NOW()"}
+		args := []interface{}{input.Name, input.Description, input.Deadline}
+		set := func(column string, value interface{}) {
+			args = append(args, value)
+			sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+		}
+		if input.Metric != nil {
+			metric := metricArgs(input.Metric)
+			for i, column := range strings.Split(goalMetricColumns, ", ") {
+				set(column, metric[i])
+			}
+		}
+		if input.Weight != nil {
+			set("weight", *input.Weight)
+		}
+		if input.Score != nil {
+			set("score", *input.Score)
+		}
+		if input.Quarter != nil {
+			// Пустой квартал хранится как NULL, как и при создании цели
+			set("quarter", sql.NullString{String: *input.Quarter, Valid: *input.Quarter != ""})
+		}
+		query := fmt.Sprintf("UPDATE goals SET %s WHERE id = ANY($%d)", strings.Join(sets, ", "), len(args)+1)
+
+		updated, err := goalRevisions.updateByName(db, input.OldName, changedBy(r), func(tx *sql.Tx, ids []int) error {
+			_, err := tx.Exec(query, append(args, pq.Array(ids))...)
+			return err
+		})
 		if err != nil {
 			goalLog.WithFields(logrus.Fields{
 				"error":   err.Error(),
@@ -193,8 +294,7 @@ func UpdateGoal(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		rowsAffected, _ := res.RowsAffected()
-		if rowsAffected == 0 {
+		if updated == 0 {
 			goalLog.WithField("oldName", input.OldName).Warn("Goal with specified name not found")
 			http.Error(w, "Goal with the specified name not found", http.StatusNotFound)
 			return
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"strconv"
@@ -40,9 +41,13 @@ func CreateHabit(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := `INSERT INTO habits (name, description, created_at, updated_at) 
-		          VALUES ($1, $2, NOW(), NOW()) RETURNING id, created_at, updated_at`
-		err := db.QueryRow(query, habit.Name, habit.Description).Scan(&habit.ID, &habit.CreatedAt, &habit.UpdatedAt)
+		query := `INSERT INTO habits (name, description, created_at, updated_at, user_id) 
+		          VALUES ($1, $2, NOW(), NOW(), $3) RETURNING id, created_at, updated_at`
+		owner := changedBy(r)
+		err := habitRevisions.create(db, owner, func(tx *sql.Tx) (int, error) {
+			err := tx.QueryRow(query, habit.Name, habit.Description, owner).Scan(&habit.ID, &habit.CreatedAt, &habit.UpdatedAt)
+			return habit.ID, err
+		})
 		if err != nil {
 			http.Error(w, "Failed to create habit", http.StatusInternalServerError)
 			return
@@ -136,15 +141,17 @@ func UpdateHabit(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := `UPDATE habits SET name = $1, description = $2, updated_at = NOW() WHERE name = $3`
-		res, err := db.Exec(query, habit.Name, habit.Description, habit.OldName)
+		query := `UPDATE habits SET name = $1, description = $2, updated_at = NOW() WHERE id = ANY($3)`
+		updated, err := habitRevisions.updateByName(db, habit.OldName, changedBy(r), func(tx *sql.Tx, ids []int) error {
+			_, err := tx.Exec(query, habit.Name, habit.Description, pq.Array(ids))
+			return err
+		})
 		if err != nil {
 			http.Error(w, "Failed to update habit", http.StatusInternalServerError)
 			return
 		}
 
-		rowsAffected, _ := res.RowsAffected()
-		if rowsAffected == 0 {
+		if updated == 0 {
 			http.Error(w, "Habit with the specified name not found", http.StatusNotFound)
 			return
 		}
@@ -1,13 +1,13 @@
 package handlers
 
 import (
+	"HabitMaster/auth"
 	"database/sql"
 	"encoding/json"
 	"net/http"
 	"os"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/sirupsen/logrus"
 )
 
@@ -50,14 +50,10 @@ type LoginResponse struct {
 	Token   string `json:"token,omitempty"`
 }
 
-// JWTClaims - структура для хранения данных токена
-type JWTClaims struct {
-	Email string `json:"email"`
-	jwt.StandardClaims
-}
-
 // LoginHandler - обработчик входа пользователя
 
+// AssignRoleToUser — POST /api/assign-role {user_id, role_id}, назначает роль из справочника.
+// У пользователя одна роль (users.role), поэтому назначение заменяет прежнюю.
 func AssignRoleToUser(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var data struct {
@@ -68,8 +64,21 @@ func AssignRoleToUser(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
+		if principal, ok := auth.PrincipalFromContext(r.Context()); ok && principal.UserID == data.UserID {
+			http.Error(w, "You cannot change your own role", http.StatusBadRequest)
+			return
+		}
 
-		_, err := db.Exec("INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2)", data.UserID, data.RoleID)
+		var role string
+		if err := db.QueryRow("SELECT name FROM roles WHERE id = $1", data.RoleID).Scan(&role); err != nil {
+			http.Error(w, "Role not found", http.StatusBadRequest)
+			return
+		}
+		_, err := auth.AssignRole(db, actorRole(r), data.UserID, role)
+		if auth.IsRoleNotGrantable(err) {
+			http.Error(w, "You cannot assign a role with permissions you do not have", http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to assign role", http.StatusInternalServerError)
 			return
@@ -79,20 +88,3 @@ func AssignRoleToUser(db *sql.DB) http.HandlerFunc {
 		json.NewEncoder(w).Encode(map[string]string{"message": "Role assigned successfully."})
 	}
 }
-
-func RoleMiddleware(requiredRole string, db *sql.DB) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID := r.Context().Value("user_id").(int)
-
-			var role string
-			err := db.QueryRow("SELECT r.name FROM roles r JOIN user_roles ur ON ur.role_id = r.id WHERE ur.user_id = $1", userID).Scan(&role)
-			if err != nil || role != requiredRole {
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
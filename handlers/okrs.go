@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// goalOKRColumns — OKR-колонки в таблице goals
+const goalOKRColumns = "parent_id, weight, score, quarter"
+
+// quarterPattern — формат квартала, например 2026-Q4
+var quarterPattern = regexp.MustCompile(`^\d{4}-Q[1-4]$`)
+
+// Objective — цель верхнего уровня с ключевыми результатами и взвешенной оценкой
+type Objective struct {
+	Goal       Goal        `json:"objective"`
+	Score      float64     `json:"score"`
+	KeyResults []KeyResult `json:"key_results"`
+}
+
+// KeyResult — ключевой результат объектива с итоговой оценкой
+type KeyResult struct {
+	Goal  Goal    `json:"goal"`
+	Score float64 `json:"score"`
+}
+
+// nullableOKR — OKR-поля в том виде, как они хранятся в БД
+type nullableOKR struct {
+	parentID sql.NullInt64
+	weight   sql.NullFloat64
+	score    sql.NullFloat64
+	quarter  sql.NullString
+}
+
+func (o *nullableOKR) dest() []interface{} {
+	return []interface{}{&o.parentID, &o.weight, &o.score, &o.quarter}
+}
+
+func (o nullableOKR) apply(g *Goal) {
+	if o.parentID.Valid {
+		parentID := int(o.parentID.Int64)
+		g.ParentID = &parentID
+	}
+	g.Weight = 1
+	if o.weight.Valid {
+		g.Weight = o.weight.Float64
+	}
+	if o.score.Valid {
+		score := o.score.Float64
+		g.Score = &score
+	}
+	g.Quarter = o.quarter.String
+}
+
+// CurrentQuarter — квартал для указанной даты в формате 2026-Q4
+func CurrentQuarter(t time.Time) string {
+	return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+}
+
+// validateOKRValues проверяет вес, оценку и квартал, если они заданы
+func validateOKRValues(weight, score *float64, quarter *string) error {
+	if weight != nil && *weight <= 0 {
+		return errors.New("weight must be greater than 0")
+	}
+	if score != nil && (*score < 0 || *score > 1) {
+		return errors.New("score must be between 0.0 and 1.0")
+	}
+	if quarter != nil && *quarter != "" && !quarterPattern.MatchString(*quarter) {
+		return errors.New("quarter must look like 2026-Q4")
+	}
+	return nil
+}
+
+// validateKeyResult проверяет OKR-поля новой цели. Ключевой результат может
+// ссылаться только на объектив верхнего уровня и наследует его квартал.
+func validateKeyResult(db *sql.DB, goal *Goal) error {
+	var weight *float64
+	if goal.Weight != 0 {
+		weight = &goal.Weight
+	}
+	if err := validateOKRValues(weight, goal.Score, &goal.Quarter); err != nil {
+		return err
+	}
+	if goal.Weight == 0 {
+		goal.Weight = 1
+	}
+	if goal.ParentID == nil {
+		return nil
+	}
+
+	var parentOfParent sql.NullInt64
+	var parentQuarter sql.NullString
+	err := db.QueryRow(`SELECT parent_id, quarter FROM goals WHERE id = $1`, *goal.ParentID).
+		Scan(&parentOfParent, &parentQuarter)
+	if err == sql.ErrNoRows {
+		return errors.New("parent goal not found")
+	}
+	if err != nil {
+		return err
+	}
+	if parentOfParent.Valid {
+		return errors.New("key results cannot have their own key results")
+	}
+	if goal.Quarter == "" {
+		goal.Quarter = parentQuarter.String
+	}
+	return nil
+}
+
+// KeyResultScore — оценка ключевого результата: заданная вручную,
+// иначе доля выполнения метрики, иначе 0
+func KeyResultScore(g Goal) float64 {
+	if g.Score != nil {
+		return *g.Score
+	}
+	if g.Metric != nil {
+		return g.Metric.PercentComplete / 100
+	}
+	return 0
+}
+
+// RollupScore — взвешенная оценка объектива по его ключевым результатам
+func RollupScore(keyResults []KeyResult) float64 {
+	var total, weights float64
+	for _, kr := range keyResults {
+		total += kr.Goal.Weight * kr.Score
+		weights += kr.Goal.Weight
+	}
+	if weights == 0 {
+		return 0
+	}
+	return math.Round(total/weights*100) / 100
+}
+
+// queryGoals выполняет запрос, возвращающий goalColumns
+func queryGoals(db *sql.DB, query string, args ...interface{}) ([]Goal, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var goals []Goal
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, g)
+	}
+	return goals, rows.Err()
+}
+
+// GetOKRs — Обработчик для получения объективов квартала с ключевыми результатами
+func GetOKRs(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		quarter := r.URL.Query().Get("quarter")
+		if quarter == "" {
+			quarter = CurrentQuarter(time.Now().In(userLocation(db, r)))
+		}
+		if !quarterPattern.MatchString(quarter) {
+			http.Error(w, "Invalid quarter, expected format 2026-Q4", http.StatusBadRequest)
+			return
+		}
+
+		objectives, err := queryGoals(db,
+			"SELECT "+goalColumns+" FROM goals WHERE parent_id IS NULL AND quarter = $1 ORDER BY id", quarter)
+		if err != nil {
+			goalLog.WithFields(logrus.Fields{"error": err.Error(), "quarter": quarter}).Error("Failed to retrieve objectives")
+			http.Error(w, "Failed to retrieve OKRs", http.StatusInternalServerError)
+			return
+		}
+
+		ids := make([]int, len(objectives))
+		for i, o := range objectives {
+			ids[i] = o.ID
+		}
+		keyResults, err := queryGoals(db,
+			"SELECT "+goalColumns+" FROM goals WHERE parent_id = ANY($1) ORDER BY id", pq.Array(ids))
+		if err == nil {
+			err = attachProgress(db, keyResults)
+		}
+		// Прогресс нужен и объективам: без ключевых результатов они оцениваются по своей метрике
+		if err == nil {
+			err = attachProgress(db, objectives)
+		}
+		if err != nil {
+			goalLog.WithFields(logrus.Fields{"error": err.Error(), "quarter": quarter}).Error("Failed to retrieve key results")
+			http.Error(w, "Failed to retrieve OKRs", http.StatusInternalServerError)
+			return
+		}
+
+		byParent := make(map[int][]KeyResult)
+		for _, kr := range keyResults {
+			byParent[*kr.ParentID] = append(byParent[*kr.ParentID], KeyResult{Goal: kr, Score: KeyResultScore(kr)})
+		}
+
+		result := make([]Objective, 0, len(objectives))
+		for _, o := range objectives {
+			objective := Objective{Goal: o, KeyResults: byParent[o.ID]}
+			if objective.KeyResults == nil {
+				objective.KeyResults = []KeyResult{}
+				objective.Score = KeyResultScore(o)
+			} else {
+				objective.Score = RollupScore(objective.KeyResults)
+			}
+			result = append(result, objective)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"quarter":    quarter,
+			"objectives": result,
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"HabitMaster/auth"
+	"HabitMaster/preferences"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Profile — профиль текущего пользователя вместе с настройками
+type Profile struct {
+	UserID      int                     `json:"user_id"`
+	Name        string                  `json:"name"`
+	Email       string                  `json:"email"`
+	Role        string                  `json:"role"`
+	IsVerified  bool                    `json:"is_verified"`
+	TOTPEnabled bool                    `json:"totp_enabled"`
+	CreatedAt   string                  `json:"created_at"`
+	Preferences preferences.Preferences `json:"preferences"`
+}
+
+// loadProfile читает профиль и настройки пользователя
+func loadProfile(db *sql.DB, userID int) (Profile, error) {
+	var p Profile
+	err := db.QueryRow(`SELECT user_id, name, email, role, is_verified, totp_enabled, created_at FROM users WHERE user_id = $1`, userID).
+		Scan(&p.UserID, &p.Name, &p.Email, &p.Role, &p.IsVerified, &p.TOTPEnabled, &p.CreatedAt)
+	if err != nil {
+		return p, err
+	}
+	p.Preferences, err = preferences.Load(db, userID)
+	return p, err
+}
+
+// writeProfile отправляет профиль текущего пользователя
+func writeProfile(w http.ResponseWriter, db *sql.DB, userID int) {
+	profile, err := loadProfile(db, userID)
+	if err != nil {
+		accountLog.WithFields(logrus.Fields{"error": err.Error(), "user_id": userID}).Error("Failed to load profile")
+		jsonError(w, "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// GetProfile — GET /api/me
+func GetProfile(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		writeProfile(w, db, principal.UserID)
+	}
+}
+
+// UpdateProfile — PATCH /api/me, меняет отображаемое имя и/или часть настроек.
+// Email меняется отдельно через POST /api/me/email с подтверждением.
+func UpdateProfile(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		var request struct {
+			Name        *string         `json:"name"`
+			Preferences json.RawMessage `json:"preferences"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			jsonError(w, "Invalid JSON format", http.StatusBadRequest)
+			return
+		}
+
+		if request.Name != nil {
+			name := strings.TrimSpace(*request.Name)
+			if name == "" || len(name) > 100 {
+				jsonError(w, "Name must be between 1 and 100 characters", http.StatusBadRequest)
+				return
+			}
+			if _, err := db.Exec(`UPDATE users SET name = $1, updated_at = NOW() WHERE user_id = $2`, name, principal.UserID); err != nil {
+				jsonError(w, "Failed to update profile", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if len(request.Preferences) > 0 {
+			current, err := preferences.Load(db, principal.UserID)
+			if err != nil {
+				jsonError(w, "Failed to load preferences", http.StatusInternalServerError)
+				return
+			}
+			updated, err := current.Apply(request.Preferences)
+			if err != nil {
+				jsonError(w, "Invalid preferences: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := preferences.Save(db, principal.UserID, updated); err != nil {
+				accountLog.WithFields(logrus.Fields{"error": err.Error(), "user_id": principal.UserID}).Error("Failed to save preferences")
+				jsonError(w, "Failed to update preferences", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		writeProfile(w, db, principal.UserID)
+	}
+}
+
+// userLocation — часовой пояс текущего пользователя; UTC для анонимных запросов
+func userLocation(db *sql.DB, r *http.Request) *time.Location {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return time.UTC
+	}
+	prefs, err := preferences.Load(db, principal.UserID)
+	if err != nil {
+		return time.UTC
+	}
+	return prefs.Location()
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"HabitMaster/auth"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Revision — сохранённая версия цели или привычки
+type Revision struct {
+	Version   int                `json:"version"`
+	Action    string             `json:"action"`
+	Snapshot  map[string]*string `json:"snapshot"`
+	Changes   []FieldChange      `json:"changes"`
+	ChangedBy *int               `json:"changed_by"`
+	ChangedAt string             `json:"changed_at"`
+}
+
+// FieldChange — изменение одного поля между соседними версиями
+type FieldChange struct {
+	Field string  `json:"field"`
+	Old   *string `json:"old"`
+	New   *string `json:"new"`
+}
+
+// revisionEntity описывает таблицу, для которой ведётся история
+type revisionEntity struct {
+	kind   string   // значение revisions.entity_type
+	table  string   // таблица сущности
+	title  string   // название для сообщений
+	fields []string // колонки, попадающие в снимок
+	log    *logrus.Logger
+}
+
+var goalRevisions = revisionEntity{
+	kind:   "goal",
+	table:  "goals",
+	title:  "Goal",
+	fields: []string{"name", "description", "deadline", "metric_unit", "metric_start", "metric_target", "metric_direction", "parent_id", "weight", "score", "quarter"},
+	log:    goalLog,
+}
+
+var habitRevisions = revisionEntity{
+	kind:   "habit",
+	table:  "habits",
+	title:  "Habit",
+	fields: []string{"name", "description"},
+	log:    habitLog,
+}
+
+// DiffSnapshots — список полей, различающихся в двух снимках
+func DiffSnapshots(fields []string, prev, next map[string]*string) []FieldChange {
+	changes := []FieldChange{}
+	for _, field := range fields {
+		oldValue, newValue := prev[field], next[field]
+		if oldValue == nil && newValue == nil {
+			continue
+		}
+		if oldValue != nil && newValue != nil && *oldValue == *newValue {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, Old: oldValue, New: newValue})
+	}
+	return changes
+}
+
+// changedBy — id пользователя из контекста запроса, если он аутентифицирован
+func changedBy(r *http.Request) *int {
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return &principal.UserID
+	}
+	return nil
+}
+
+// loadSnapshot читает текущие значения полей сущности
+func (e revisionEntity) loadSnapshot(tx *sql.Tx, id int) (map[string]*string, error) {
+	columns := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		columns[i] = field + "::text"
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = $1", strings.Join(columns, ", "), e.table)
+
+	values := make([]sql.NullString, len(e.fields))
+	dest := make([]interface{}, len(e.fields))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := tx.QueryRow(query, id).Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string]*string, len(e.fields))
+	for i, field := range e.fields {
+		if values[i].Valid {
+			value := values[i].String
+			snapshot[field] = &value
+		} else {
+			snapshot[field] = nil
+		}
+	}
+	return snapshot, nil
+}
+
+// record сохраняет текущее состояние сущности как новую версию
+func (e revisionEntity) record(tx *sql.Tx, id int, action string, userID *int) (int, error) {
+	snapshot, err := e.loadSnapshot(tx, id)
+	if err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = tx.QueryRow(`
+		INSERT INTO revisions (entity_type, entity_id, version, action, snapshot, changed_by, changed_at)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5, NOW()
+		FROM revisions WHERE entity_type = $1 AND entity_id = $2
+		RETURNING version`,
+		e.kind, id, action, data, userID).Scan(&version)
+	return version, err
+}
+
+// ensureBaseline сохраняет исходное состояние записей, созданных до появления истории
+func (e revisionEntity) ensureBaseline(tx *sql.Tx, id int) error {
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM revisions WHERE entity_type = $1 AND entity_id = $2)`,
+		e.kind, id).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	_, err = e.record(tx, id, "create", nil)
+	return err
+}
+
+// lockByName блокирует строки с указанным именем и возвращает их id
+func (e revisionEntity) lockByName(tx *sql.Tx, name string) ([]int, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT id FROM %s WHERE name = $1 FOR UPDATE", e.table), name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// create добавляет запись через insert и сохраняет её первую версию
+func (e revisionEntity) create(db *sql.DB, userID *int, insert func(tx *sql.Tx) (int, error)) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, err := insert(tx)
+	if err != nil {
+		return err
+	}
+	if _, err := e.record(tx, id, "create", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateByName обновляет все записи с указанным именем через apply,
+// сохраняя версии до и после изменения. Возвращает число обновлённых записей.
+func (e revisionEntity) updateByName(db *sql.DB, name string, userID *int, apply func(tx *sql.Tx, ids []int) error) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ids, err := e.lockByName(tx, name)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := e.ensureBaseline(tx, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := apply(tx, ids); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if _, err := e.record(tx, id, "update", userID); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// history возвращает все версии сущности с изменениями относительно предыдущей
+func (e revisionEntity) history(db *sql.DB, id int) ([]Revision, error) {
+	rows, err := db.Query(`
+		SELECT version, action, snapshot, changed_by, changed_at
+		FROM revisions WHERE entity_type = $1 AND entity_id = $2
+		ORDER BY version`, e.kind, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	var prev map[string]*string
+	for rows.Next() {
+		var rev Revision
+		var data []byte
+		var userID sql.NullInt64
+		if err := rows.Scan(&rev.Version, &rev.Action, &data, &userID, &rev.ChangedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &rev.Snapshot); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			by := int(userID.Int64)
+			rev.ChangedBy = &by
+		}
+		if prev == nil {
+			rev.Changes = []FieldChange{}
+		} else {
+			rev.Changes = DiffSnapshots(e.fields, prev, rev.Snapshot)
+		}
+		prev = rev.Snapshot
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// owns проверяет, что запись принадлежит пользователю
+func (e revisionEntity) owns(db *sql.DB, id int, userID *int) (bool, error) {
+	var exists bool
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1 AND user_id = $2)", e.table)
+	err := db.QueryRow(query, id, userID).Scan(&exists)
+	return exists, err
+}
+
+// revert возвращает сущность пользователя к сохранённой версии и записывает это как новую версию.
+// Чужая или несуществующая запись даёт sql.ErrNoRows.
+func (e revisionEntity) revert(tx *sql.Tx, id, version int, userID *int) (int, error) {
+	var lockedID int
+	lock := fmt.Sprintf("SELECT id FROM %s WHERE id = $1 AND user_id = $2 FOR UPDATE", e.table)
+	if err := tx.QueryRow(lock, id, userID).Scan(&lockedID); err != nil {
+		return 0, err
+	}
+	if err := e.ensureBaseline(tx, id); err != nil {
+		return 0, err
+	}
+
+	var data []byte
+	err := tx.QueryRow(`SELECT snapshot FROM revisions WHERE entity_type = $1 AND entity_id = $2 AND version = $3`,
+		e.kind, id, version).Scan(&data)
+	if err != nil {
+		return 0, err
+	}
+	var snapshot map[string]*string
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return 0, err
+	}
+
+	assignments := make([]string, len(e.fields))
+	args := make([]interface{}, 0, len(e.fields)+1)
+	for i, field := range e.fields {
+		assignments[i] = fmt.Sprintf("%s = $%d", field, i+1)
+		if value := snapshot[field]; value != nil {
+			args = append(args, *value)
+		} else {
+			args = append(args, nil)
+		}
+	}
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE %s SET %s, updated_at = NOW() WHERE id = $%d",
+		e.table, strings.Join(assignments, ", "), len(args))
+	if _, err := tx.Exec(query, args...); err != nil {
+		return 0, err
+	}
+
+	return e.record(tx, id, fmt.Sprintf("revert:%d", version), userID)
+}
+
+// historyHandler — GET /api/{goals|habits}/{id}/history
+func (e revisionEntity) historyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+
+		// Чужая запись неотличима от несуществующей
+		owned, err := e.owns(db, id, changedBy(r))
+		if err == nil && !owned {
+			http.Error(w, e.title+" not found", http.StatusNotFound)
+			return
+		}
+		var revisions []Revision
+		if err == nil {
+			revisions, err = e.history(db, id)
+		}
+		if err != nil {
+			e.log.WithFields(logrus.Fields{"error": err.Error(), "id": id}).Error("Failed to load history")
+			http.Error(w, "Failed to load history", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(revisions)
+	}
+}
+
+// revertHandler — POST /api/{goals|habits}/{id}/history/{version}/revert
+func (e revisionEntity) revertHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+		version, err := strconv.Atoi(vars["version"])
+		if err != nil {
+			http.Error(w, "Invalid version", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to revert "+e.kind, http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		newVersion, err := e.revert(tx, id, version, changedBy(r))
+		if err == sql.ErrNoRows {
+			http.Error(w, e.title+" or version not found", http.StatusNotFound)
+			return
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			e.log.WithFields(logrus.Fields{"error": err.Error(), "id": id, "version": version}).Error("Failed to revert")
+			http.Error(w, "Failed to revert "+e.kind, http.StatusInternalServerError)
+			return
+		}
+
+		e.log.WithFields(logrus.Fields{"id": id, "version": version, "new_version": newVersion}).Info("Reverted to previous version")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": fmt.Sprintf("%s reverted to version %d", e.title, version),
+			"version": newVersion,
+		})
+	}
+}
+
+// GetGoalHistory — Обработчик для получения истории изменений цели
+func GetGoalHistory(db *sql.DB) http.HandlerFunc {
+	return goalRevisions.historyHandler(db)
+}
+
+// RevertGoal — Обработчик для отката цели к предыдущей версии
+func RevertGoal(db *sql.DB) http.HandlerFunc {
+	return goalRevisions.revertHandler(db)
+}
+
+// GetHabitHistory — Обработчик для получения истории изменений привычки
+func GetHabitHistory(db *sql.DB) http.HandlerFunc {
+	return habitRevisions.historyHandler(db)
+}
+
+// RevertHabit — Обработчик для отката привычки к предыдущей версии
+func RevertHabit(db *sql.DB) http.HandlerFunc {
+	return habitRevisions.revertHandler(db)
+}
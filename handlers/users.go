@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"HabitMaster/auth"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -12,7 +17,7 @@ type User struct {
 	UserID     int    `json:"user_id"`
 	Name       string `json:"name"`
 	Email      string `json:"email"`
-	Password   string `json:"password"`
+	Password   string `json:"password,omitempty"`
 	CreatedAt  string `json:"created_at"`
 	UpdatedAt  string `json:"updated_at"`
 	Role       string `json:"role"`
@@ -45,8 +50,19 @@ func CreateUser(db *sql.DB) http.HandlerFunc {
 			return
 		}
 		user.Email = strings.ToLower(user.Email)
+		if user.Role == "" {
+			user.Role = "user"
+		}
+		if known, err := auth.RoleExists(db, user.Role); err != nil || !known {
+			http.Error(w, "Недопустимая роль", http.StatusBadRequest)
+			return
+		}
+		if allowed, err := auth.CanGrantRole(actorRole(r), user.Role); err != nil || !allowed {
+			http.Error(w, "Нельзя назначить роль с разрешениями, которых нет у вас", http.StatusForbidden)
+			return
+		}
 		var exists bool
-		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)", user.Email).Scan(&exists)
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = $1)", user.Email).Scan(&exists)
 		if err != nil {
 			http.Error(w, "Ошибка сервера при проверке email", http.StatusInternalServerError)
 			return
@@ -56,6 +72,11 @@ func CreateUser(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		if err := auth.ValidatePassword(user.Password, user.Email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Хэширование пароля
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 		if err != nil {
@@ -63,19 +84,48 @@ func CreateUser(db *sql.DB) http.HandlerFunc {
 			return
 		}
 		query := `
-		INSERT INTO users (name, email, password, created_at, updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW()) RETURNING user_id, created_at, updated_at`
-		err = db.QueryRow(query, user.Name, user.Email, string(hashedPassword)).Scan(&user.UserID, &user.CreatedAt, &user.UpdatedAt)
+		INSERT INTO users (name, email, password, role, is_verified, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING user_id, created_at, updated_at`
+		err = db.QueryRow(query, user.Name, user.Email, string(hashedPassword), user.Role, user.IsVerified).
+			Scan(&user.UserID, &user.CreatedAt, &user.UpdatedAt)
 		if err != nil {
 			http.Error(w, "Ошибка при добавлении пользователя в базу данных", http.StatusInternalServerError)
 			return
 		}
+		user.Password = ""
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(user)
 	}
 }
 
+// userSortOrders — допустимые значения параметра sort для GetUsers
+var userSortOrders = map[string]string{
+	"usernameAZ": "name ASC, user_id",
+	"usernameZA": "name DESC, user_id",
+	"emailAZ":    "email ASC, user_id",
+	"emailZA":    "email DESC, user_id",
+	"newest":     "created_at DESC, user_id DESC",
+	"oldest":     "created_at ASC, user_id",
+}
+
+// Параметры постраничного вывода пользователей
+const (
+	usersDefaultPerPage = 20
+	usersMaxPerPage     = 100
+)
+
+// queryInt читает положительное число из query-параметра или возвращает def
+func queryInt(r *http.Request, name string, def int) int {
+	value, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || value < 1 {
+		return def
+	}
+	return value
+}
+
+// GetUsers — список пользователей с фильтрами email, username, role, verified,
+// сортировкой sort и страницами page/per_page. Общее число записей — в X-Total-Count.
 func GetUsers(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -83,17 +133,68 @@ func GetUsers(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		rows, err := db.Query("SELECT user_id, name, email, created_at, updated_at FROM users")
+		query := r.URL.Query()
+		var conditions []string
+		var args []interface{}
+		addCondition := func(condition string, value interface{}) {
+			args = append(args, value)
+			conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+		}
+		if email := strings.TrimSpace(query.Get("email")); email != "" {
+			addCondition("email ILIKE '%%' || $%d || '%%'", email)
+		}
+		if username := strings.TrimSpace(query.Get("username")); username != "" {
+			addCondition("name ILIKE '%%' || $%d || '%%'", username)
+		}
+		if role := query.Get("role"); role != "" {
+			addCondition("role = $%d", role)
+		}
+		if verified := query.Get("verified"); verified != "" {
+			value, err := strconv.ParseBool(verified)
+			if err != nil {
+				http.Error(w, "Параметр verified должен быть true или false", http.StatusBadRequest)
+				return
+			}
+			addCondition("is_verified = $%d", value)
+		}
+		where := ""
+		if len(conditions) > 0 {
+			where = " WHERE " + strings.Join(conditions, " AND ")
+		}
+
+		orderBy := userSortOrders["oldest"]
+		if sort := query.Get("sort"); sort != "" {
+			var ok bool
+			if orderBy, ok = userSortOrders[sort]; !ok {
+				http.Error(w, "Недопустимое значение sort", http.StatusBadRequest)
+				return
+			}
+		}
+		page := queryInt(r, "page", 1)
+		perPage := queryInt(r, "per_page", usersDefaultPerPage)
+		if perPage > usersMaxPerPage {
+			perPage = usersMaxPerPage
+		}
+
+		var total int
+		if err := db.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+			http.Error(w, "Ошибка при получении данных из базы данных", http.StatusInternalServerError)
+			return
+		}
+
+		args = append(args, perPage, (page-1)*perPage)
+		rows, err := db.Query(fmt.Sprintf(`SELECT user_id, name, email, role, is_verified, created_at, updated_at
+			FROM users%s ORDER BY %s LIMIT $%d OFFSET $%d`, where, orderBy, len(args)-1, len(args)), args...)
 		if err != nil {
 			http.Error(w, "Ошибка при получении данных из базы данных", http.StatusInternalServerError)
 			return
 		}
 		defer rows.Close()
 
-		var users []User
+		users := []User{}
 		for rows.Next() {
 			var user User
-			if err := rows.Scan(&user.UserID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			if err := rows.Scan(&user.UserID, &user.Name, &user.Email, &user.Role, &user.IsVerified, &user.CreatedAt, &user.UpdatedAt); err != nil {
 				http.Error(w, "Ошибка при обработке данных из базы данных", http.StatusInternalServerError)
 				return
 			}
@@ -106,6 +207,234 @@ func GetUsers(db *sql.DB) http.HandlerFunc {
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		w.Header().Set("X-Page", strconv.Itoa(page))
+		w.Header().Set("X-Per-Page", strconv.Itoa(perPage))
 		json.NewEncoder(w).Encode(users)
 	}
 }
+
+// loadUser читает пользователя без пароля
+func loadUser(db *sql.DB, userID int) (User, error) {
+	var user User
+	err := db.QueryRow(`SELECT user_id, name, email, role, is_verified, created_at, updated_at FROM users WHERE user_id = $1`, userID).
+		Scan(&user.UserID, &user.Name, &user.Email, &user.Role, &user.IsVerified, &user.CreatedAt, &user.UpdatedAt)
+	return user, err
+}
+
+// writeUser отправляет пользователя или 404, если его нет
+func writeUser(w http.ResponseWriter, db *sql.DB, userID int) {
+	user, err := loadUser(db, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка при получении данных из базы данных", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// UpdateUser — PUT /api/users, изменяет имя и/или email пользователя.
+// Новый email вступает в силу только после подтверждения по ссылке (как смена
+// из профиля), а старый адрес получает ссылку для отмены; в этом случае ответ — 202.
+func UpdateUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID    int     `json:"id"`
+			Name  *string `json:"name"`
+			Email *string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.ID == 0 {
+			http.Error(w, "Неверный формат данных, поле id обязательно", http.StatusBadRequest)
+			return
+		}
+
+		var name, email string
+		if request.Name != nil {
+			name = strings.TrimSpace(*request.Name)
+			if name == "" {
+				http.Error(w, "Имя не может быть пустым", http.StatusBadRequest)
+				return
+			}
+		}
+		if request.Email != nil {
+			var ok bool
+			if email, ok = auth.NormalizeEmail(*request.Email); !ok {
+				http.Error(w, "Некорректный email", http.StatusBadRequest)
+				return
+			}
+		}
+		if !authorizeTarget(w, r, db, request.ID) {
+			return
+		}
+
+		if name != "" {
+			res, err := db.Exec("UPDATE users SET name = $1, updated_at = NOW() WHERE user_id = $2", name, request.ID)
+			if err != nil {
+				http.Error(w, "Ошибка при обновлении пользователя", http.StatusInternalServerError)
+				return
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				http.Error(w, "Пользователь не найден", http.StatusNotFound)
+				return
+			}
+		}
+
+		status := http.StatusOK
+		if email != "" {
+			started, err := auth.StartEmailChange(request.ID, email)
+			if err == auth.ErrEmailTaken {
+				http.Error(w, "Пользователь с таким email уже существует", http.StatusConflict)
+				return
+			}
+			if err == sql.ErrNoRows {
+				http.Error(w, "Пользователь не найден", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				accountLog.WithFields(logrus.Fields{"error": err.Error(), "user_id": request.ID}).Error("Failed to start email change")
+				http.Error(w, "Ошибка при обновлении пользователя", http.StatusInternalServerError)
+				return
+			}
+			if started {
+				status = http.StatusAccepted
+			}
+		}
+
+		user, err := loadUser(db, request.ID)
+		if err != nil {
+			http.Error(w, "Ошибка при получении данных из базы данных", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
+// authorizeTarget проверяет, что текущий пользователь вправе изменять пользователя
+// userID: его роль не шире роли текущего (как при назначении ролей). При отказе
+// отвечает 404/403/500 и возвращает false.
+func authorizeTarget(w http.ResponseWriter, r *http.Request, db *sql.DB, userID int) bool {
+	allowed, err := auth.CanManageUser(db, actorRole(r), userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Пользователь не найден", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Ошибка сервера при проверке прав", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, "Нельзя изменять пользователя с разрешениями, которых нет у вас", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// DeleteUser — DELETE /api/users?id=, удаляет пользователя сразу со всеми данными
+func DeleteUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || userID < 1 {
+			http.Error(w, "Параметр id обязателен", http.StatusBadRequest)
+			return
+		}
+		if principal, ok := auth.PrincipalFromContext(r.Context()); ok && principal.UserID == userID {
+			http.Error(w, "Нельзя удалить собственный аккаунт через админ-панель", http.StatusBadRequest)
+			return
+		}
+		if !authorizeTarget(w, r, db, userID) {
+			return
+		}
+
+		res, err := db.Exec(`UPDATE users SET deletion_scheduled_for = NOW() WHERE user_id = $1`, userID)
+		if err != nil {
+			http.Error(w, "Ошибка при удалении пользователя", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Пользователь не найден", http.StatusNotFound)
+			return
+		}
+		// Если удаление не удалось, аккаунт дочистит фоновый StartAccountPurger
+		if err := purgeAccount(db, userID); err != nil {
+			accountLog.WithFields(logrus.Fields{"error": err.Error(), "user_id": userID}).Error("Failed to delete user")
+			http.Error(w, "Ошибка при удалении пользователя", http.StatusInternalServerError)
+			return
+		}
+
+		accountLog.WithField("user_id", userID).Info("User deleted by admin")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "User deleted"})
+	}
+}
+
+// VerifyUser — POST /api/users/{id}/verify, подтверждает email пользователя вручную
+func VerifyUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.Atoi(mux.Vars(r)["id"])
+		if !authorizeTarget(w, r, db, userID) {
+			return
+		}
+		res, err := db.Exec(`UPDATE users SET is_verified = TRUE, verification_code = NULL, verification_attempts = 0, updated_at = NOW()
+			WHERE user_id = $1`, userID)
+		if err != nil {
+			http.Error(w, "Ошибка при обновлении пользователя", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Пользователь не найден", http.StatusNotFound)
+			return
+		}
+		writeUser(w, db, userID)
+	}
+}
+
+// actorRole — роль пользователя, выполняющего запрос; без входа — пустая роль без разрешений
+func actorRole(r *http.Request) string {
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return principal.Role
+	}
+	return ""
+}
+
+// ChangeUserRole — PUT /api/users/{id}/role. Уже выданные токены доступа с прежней
+// ролью перестают действовать; новая роль попадёт в токен при обновлении.
+func ChangeUserRole(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.Atoi(mux.Vars(r)["id"])
+		var request struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Role == "" {
+			http.Error(w, "Поле role обязательно", http.StatusBadRequest)
+			return
+		}
+		if principal, ok := auth.PrincipalFromContext(r.Context()); ok && principal.UserID == userID {
+			http.Error(w, "Нельзя изменить собственную роль", http.StatusBadRequest)
+			return
+		}
+
+		changed, err := auth.AssignRole(db, actorRole(r), userID, request.Role)
+		if auth.IsUnknownRole(err) {
+			http.Error(w, "Недопустимая роль", http.StatusBadRequest)
+			return
+		}
+		if auth.IsRoleNotGrantable(err) {
+			http.Error(w, "Нельзя назначить роль с разрешениями, которых нет у вас", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Ошибка при обновлении пользователя", http.StatusInternalServerError)
+			return
+		}
+		if changed {
+			accountLog.WithFields(logrus.Fields{"user_id": userID, "role": request.Role}).Info("User role changed")
+		}
+		writeUser(w, db, userID)
+	}
+}
@@ -5,24 +5,17 @@ import (
 	"HabitMaster/databaseConnector"
 	"HabitMaster/emailSender"
 	"HabitMaster/handlers"
-	"context"
+	"HabitMaster/routes"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
 	"net/http"
 	"os"
-	"strings"
 	"sync"
+	"time"
 )
 
-type JWTClaims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
-	jwt.StandardClaims
-}
-
 var (
 	clients = make(map[string]*rate.Limiter)
 	mu      sync.Mutex
@@ -42,6 +35,13 @@ func getLimiter(ip string) *rate.Limiter {
 
 func rateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Обмен refresh-токена не ограничивается: страница повторяет его сразу после
+		// запроса, получившего 401, и 429 здесь завершал бы сессию пользователя.
+		// Refresh-токены случайные и одноразовые, подбирать их бессмысленно.
+		if r.URL.Path == "/token/refresh" {
+			next.ServeHTTP(w, r)
+			return
+		}
 		ip := r.RemoteAddr
 		limiter := getLimiter(ip)
 		if !limiter.Allow() {
@@ -52,43 +52,6 @@ func rateLimiterMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Missing token", http.StatusUnauthorized)
-			return
-		}
-
-		userID, err := DecodeTokenAndGetUserID(authHeader)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), "user_id", userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
-
-func DecodeTokenAndGetUserID(authHeader string) (int, error) {
-	parts := strings.SplitN(authHeader, " ", 2)
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		return 0, fmt.Errorf("invalid authorization header")
-	}
-
-	tokenString := parts[1]
-	claims := &JWTClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte("your-secret-key"), nil
-	})
-	if err != nil || !token.Valid {
-		return 0, fmt.Errorf("invalid token")
-	}
-
-	return claims.UserID, nil
-}
-
 func main() {
 	logFile, err := os.OpenFile("server_logs.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
@@ -111,7 +74,15 @@ func main() {
 
 	log.Info("Успешное подключение к базе данных")
 
-	emailService := emailSender.NewEmailSender()
+	if err := auth.StartKeyRotation(db); err != nil {
+		log.WithError(err).Fatal("Ошибка загрузки ключей подписи токенов")
+	}
+
+	// Письма ставятся в очередь email_outbox и отправляются в фоне
+	outbox := emailSender.NewOutbox(db, emailSender.NewEmailSender(), emailSender.OutboxConfigFromEnv())
+	outbox.Start()
+	emailService := outbox.Sender()
+	auth.SetEmailSender(emailService)
 	r := mux.NewRouter()
 
 	r.Use(func(next http.Handler) http.Handler {
@@ -126,14 +97,17 @@ func main() {
 	})
 
 	r.Use(rateLimiterMiddleware)
+	r.Use(auth.OptionalAuthMiddleware)
+	r.Use(auth.TokenScopeMiddleware)
+	r.Use(auth.AdminAreaMiddleware)
 
 	// Пример защищённого роутера
 	protected := r.PathPrefix("/api/protected").Subrouter()
-	protected.Use(AuthMiddleware)
+	protected.Use(auth.AuthMiddleware)
 
 	protected.HandleFunc("/profile", func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("user_id").(int)
-		fmt.Fprintf(w, "This is a protected route. user_id = %d\n", userID)
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		fmt.Fprintf(w, "This is a protected route. user_id = %d\n", principal.UserID)
 	}).Methods("GET")
 
 	// Фронтенд
@@ -142,33 +116,114 @@ func main() {
 	}).Methods("GET")
 
 	r.HandleFunc("/register", auth.Register).Methods(http.MethodPost)
+	r.HandleFunc("/auth/registration", auth.RegistrationInfo).Methods(http.MethodGet)
+	r.HandleFunc("/.well-known/jwks.json", auth.JWKS).Methods(http.MethodGet)
 	r.HandleFunc("/login", auth.Login).Methods(http.MethodPost)
 	r.HandleFunc("/verify-email", auth.VerifyCode).Methods(http.MethodPost)
-	r.HandleFunc("/logout", auth.Logout).Methods(http.MethodPost)
-
-	// Привычки
-	r.HandleFunc("/api/habits", handlers.CreateHabit(db)).Methods("POST")
-	r.HandleFunc("/api/habits", handlers.GetHabits(db)).Methods("GET")
-	r.HandleFunc("/api/habits", handlers.DeleteHabitByName(db)).Methods("DELETE")
-	r.HandleFunc("/api/habits", handlers.UpdateHabit(db)).Methods("PUT")
+	r.HandleFunc("/resend-verification", auth.ResendVerification).Methods(http.MethodPost)
+	r.HandleFunc("/password/forgot", auth.ForgotPassword).Methods(http.MethodPost)
+	r.HandleFunc("/password/reset", auth.ResetPassword).Methods(http.MethodPost)
+	r.Handle("/logout", auth.AuthMiddleware(http.HandlerFunc(auth.Logout))).Methods(http.MethodPost)
+	r.Handle("/logout/all", auth.AuthMiddleware(http.HandlerFunc(auth.LogoutAll))).Methods(http.MethodPost)
+	r.HandleFunc("/token/refresh", auth.RefreshToken).Methods(http.MethodPost)
+	r.HandleFunc("/login/2fa", auth.LoginSecondFactor).Methods(http.MethodPost)
+	r.HandleFunc("/login/magic", auth.RequestMagicLink).Methods(http.MethodPost)
+	r.HandleFunc("/login/magic/verify", auth.ConsumeMagicLink).Methods(http.MethodPost)
+	r.HandleFunc("/login/not-me", auth.ReportUnrecognizedLogin).Methods(http.MethodPost)
+	r.HandleFunc("/auth/oidc/login", auth.OIDCLogin).Methods(http.MethodGet)
+	r.HandleFunc("/auth/oidc/callback", auth.OIDCCallback).Methods(http.MethodGet)
+	r.Handle("/api/2fa/enroll", auth.AuthMiddleware(http.HandlerFunc(auth.EnrollTOTP))).Methods(http.MethodPost)
+	r.Handle("/api/2fa/confirm", auth.AuthMiddleware(http.HandlerFunc(auth.ConfirmTOTP))).Methods(http.MethodPost)
+	r.Handle("/api/2fa/disable", auth.AuthMiddleware(http.HandlerFunc(auth.DisableTOTP))).Methods(http.MethodPost)
+
+	// Сессии и устройства
+	sessions := r.PathPrefix("/api/sessions").Subrouter()
+	sessions.Use(auth.AuthMiddleware)
+	sessions.HandleFunc("", auth.ListSessions).Methods(http.MethodGet)
+	sessions.HandleFunc("/{id:[0-9]+}", auth.RevokeSession).Methods(http.MethodDelete)
+
+	// Управление пользователями (нужно разрешение и вход с 2FA)
+	withPermission := func(permission string, h http.HandlerFunc) http.Handler {
+		return auth.AuthMiddleware(auth.RequirePermission(permission)(auth.RequireMFA(h)))
+	}
+	r.Handle("/api/get-users", withPermission(auth.PermUsersRead, handlers.GetUsers(db))).Methods(http.MethodGet)
+	r.Handle("/api/users", withPermission(auth.PermUsersWrite, handlers.CreateUser(db))).Methods(http.MethodPost)
+	r.Handle("/api/users", withPermission(auth.PermUsersWrite, handlers.UpdateUser(db))).Methods(http.MethodPut)
+	r.Handle("/api/users", withPermission(auth.PermUsersWrite, handlers.DeleteUser(db))).Methods(http.MethodDelete)
+	r.Handle("/api/users/{id:[0-9]+}/verify", withPermission(auth.PermUsersWrite, handlers.VerifyUser(db))).Methods(http.MethodPost)
+	r.Handle("/api/users/{id:[0-9]+}/role", withPermission(auth.PermUsersRoles, handlers.ChangeUserRole(db))).Methods(http.MethodPut)
+	r.Handle("/api/admin/users/{id:[0-9]+}/role", withPermission(auth.PermUsersRoles, auth.RevokeUserRole)).Methods(http.MethodDelete)
+
+	// Профиль и настройки; удаление аккаунта с отсрочкой и выгрузка данных
+	me := r.PathPrefix("/api/me").Subrouter()
+	me.Use(auth.AuthMiddleware)
+	me.HandleFunc("", handlers.GetProfile(db)).Methods(http.MethodGet)
+	me.HandleFunc("", handlers.UpdateProfile(db)).Methods(http.MethodPatch)
+	me.HandleFunc("/password", auth.ChangePassword).Methods(http.MethodPost)
+	me.HandleFunc("", handlers.DeleteAccount(db, emailService)).Methods(http.MethodDelete)
+	me.HandleFunc("/cancel-deletion", handlers.CancelAccountDeletion(db)).Methods(http.MethodPost)
+	me.HandleFunc("/export", handlers.ExportAccount(db)).Methods(http.MethodGet)
+	me.HandleFunc("/email", auth.RequestEmailChange).Methods(http.MethodPost)
+	r.HandleFunc("/email/confirm", auth.ConfirmEmailChange).Methods(http.MethodPost)
+	r.HandleFunc("/email/revert", auth.RevertEmailChange).Methods(http.MethodPost)
+	handlers.StartAccountPurger(db, time.Hour)
+
+	// Персональные API-токены
+	tokens := r.PathPrefix("/api/tokens").Subrouter()
+	tokens.Use(auth.AuthMiddleware)
+	tokens.HandleFunc("", auth.CreateAPIToken).Methods(http.MethodPost)
+	tokens.HandleFunc("", auth.ListAPITokens).Methods(http.MethodGet)
+	tokens.HandleFunc("/{id:[0-9]+}", auth.RevokeAPIToken).Methods(http.MethodDelete)
+
+	adminUsers := r.PathPrefix("/api/admin/users").Subrouter()
+	adminUsers.Use(auth.AuthMiddleware, auth.RequirePermission(auth.PermUsersSecurity), auth.RequireMFA)
+	adminUsers.HandleFunc("/{id:[0-9]+}/sessions", auth.AdminListSessions).Methods(http.MethodGet)
+	adminUsers.HandleFunc("/{id:[0-9]+}/sessions/{sid:[0-9]+}", auth.AdminRevokeSession).Methods(http.MethodDelete)
+	adminUsers.HandleFunc("/{id:[0-9]+}/unlock", auth.AdminUnlockUser).Methods(http.MethodPost)
+	adminUsers.HandleFunc("/{id:[0-9]+}/logins", auth.AdminLoginHistory).Methods(http.MethodGet)
+
+	invitations := r.PathPrefix("/api/admin/invitations").Subrouter()
+	invitations.Use(auth.AuthMiddleware, auth.RequirePermission(auth.PermInvitationsManage), auth.RequireMFA)
+	invitations.HandleFunc("", auth.CreateInvitation).Methods(http.MethodPost)
+	invitations.HandleFunc("", auth.ListInvitations).Methods(http.MethodGet)
+	invitations.HandleFunc("/{id:[0-9]+}", auth.RevokeInvitation).Methods(http.MethodDelete)
+
+	// Роли и разрешения
+	roles := r.PathPrefix("/api/admin/roles").Subrouter()
+	roles.Use(auth.AuthMiddleware, auth.RequirePermission(auth.PermRolesManage), auth.RequireMFA)
+	roles.HandleFunc("", auth.ListRoles).Methods(http.MethodGet)
+	roles.HandleFunc("", auth.CreateRole).Methods(http.MethodPost)
+	roles.HandleFunc("/{name}", auth.UpdateRole).Methods(http.MethodPut)
+	roles.HandleFunc("/{name}", auth.DeleteRole).Methods(http.MethodDelete)
+	r.Handle("/api/admin/permissions", withPermission(auth.PermRolesManage, auth.ListPermissions)).Methods(http.MethodGet)
 
 	// Роли и авторизация
-	r.HandleFunc("/api/assign-role", handlers.AssignRoleToUser(db)).Methods("POST")
-	r.Handle("/api/admin-action", handlers.RoleMiddleware("admin", db)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	r.Handle("/api/assign-role", withPermission(auth.PermUsersRoles, handlers.AssignRoleToUser(db))).Methods("POST")
+	r.Handle("/api/admin-action", withPermission(auth.PermAdminAccess, func(w http.ResponseWriter, req *http.Request) {
 		w.Write([]byte("This is an admin action."))
-	})))
+	}))
 
-	// Цели
-	r.HandleFunc("/api/goals", handlers.CreateGoal(db)).Methods("POST")
-	r.HandleFunc("/api/goals", handlers.GetGoals(db)).Methods("GET")
-	r.HandleFunc("/api/goals", handlers.UpdateGoal(db)).Methods("PUT")
-	r.HandleFunc("/api/goals", handlers.DeleteGoalByName(db)).Methods("DELETE")
-	r.HandleFunc("/api/goals/deleteAll", handlers.DeleteAllGoals(db)).Methods("DELETE") // Новый маршрут
+	// Привычки и цели (только для авторизованных)
+	routes.RegisterTrackerRoutes(r, db)
 
 	// Email-уведомления
-	r.HandleFunc("/api/admin/send-mass-email", handlers.SendMassEmailHandler(emailService)).Methods("POST")
+	r.Handle("/api/admin/send-mass-email", withPermission(auth.PermEmailSendMass, handlers.SendMassEmailHandler(db, emailService))).Methods("POST")
 	r.HandleFunc("/api/user/send-support-email", handlers.SendSupportEmailHandler(emailService)).Methods("POST")
-	r.HandleFunc("/api/admin/send-email-with-attachment", handlers.SendEmailWithAttachmentHandler(emailService)).Methods("POST")
+	r.Handle("/api/admin/send-email-with-attachment", withPermission(auth.PermEmailSendAttachment, handlers.SendEmailWithAttachmentHandler(db, emailService))).Methods("POST")
+	r.Handle("/api/admin/email-log", withPermission(auth.PermAuditRead, handlers.GetAdminEmailLog(db))).Methods("GET")
+
+	// Очередь писем: просмотр и повторная отправка
+	outboxAdmin := r.PathPrefix("/api/admin/email-outbox").Subrouter()
+	outboxAdmin.Use(auth.AuthMiddleware, auth.RequirePermission(auth.PermEmailOutbox), auth.RequireMFA)
+	outboxAdmin.HandleFunc("", handlers.GetEmailOutbox(db)).Methods(http.MethodGet)
+	outboxAdmin.HandleFunc("/{id:[0-9]+}", handlers.GetEmailOutboxMessage(db)).Methods(http.MethodGet)
+	outboxAdmin.HandleFunc("/{id:[0-9]+}/retry", handlers.RetryEmailOutboxMessage(db)).Methods(http.MethodPost)
+
+	// Шаблоны писем: список и предпросмотр с данными-примерами
+	templatesAdmin := r.PathPrefix("/api/admin/email-templates").Subrouter()
+	templatesAdmin.Use(auth.AuthMiddleware, auth.RequirePermission(auth.PermEmailTemplates), auth.RequireMFA)
+	templatesAdmin.HandleFunc("", handlers.GetEmailTemplates()).Methods(http.MethodGet)
+	templatesAdmin.HandleFunc("/{name}/preview", handlers.PreviewEmailTemplate()).Methods(http.MethodGet)
 
 	r.PathPrefix("/").Handler(http.StripPrefix("/", http.FileServer(http.Dir("./habittracker"))))
 
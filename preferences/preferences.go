@@ -0,0 +1,234 @@
+// Package preferences хранит настройки пользователя: часовой пояс, язык,
+// начало недели и уведомления. Пакет не зависит от auth и handlers,
+// поэтому настройки могут читать любые подсистемы.
+package preferences
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	_ "time/tzdata" // часовые пояса доступны и в контейнерах без tzdata
+)
+
+// Категории писем, от которых пользователь может отписаться.
+// Письма безопасности (сброс пароля, блокировка, вход) отправляются всегда.
+const (
+	EmailReminders      = "reminders"
+	EmailWeeklySummary  = "weekly_summary"
+	EmailProductUpdates = "product_updates"
+)
+
+// Каналы напоминаний
+const (
+	ChannelEmail = "email"
+	ChannelInApp = "in_app"
+)
+
+// SupportedLocales — языки интерфейса и писем
+var SupportedLocales = []string{"en", "ru"}
+
+var clockPattern = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+
+// Preferences — настройки пользователя
+type Preferences struct {
+	TimeZone      string        `json:"time_zone"`
+	Locale        string        `json:"locale"`
+	WeekStart     string        `json:"week_start"`
+	Notifications Notifications `json:"notifications"`
+}
+
+// Notifications — какие письма получать, куда слать напоминания и когда не беспокоить
+type Notifications struct {
+	Emails           map[string]bool `json:"emails"`
+	ReminderChannels []string        `json:"reminder_channels"`
+	QuietHours       *QuietHours     `json:"quiet_hours"`
+}
+
+// QuietHours — интервал «не беспокоить» в часовом поясе пользователя, например 22:00–07:00
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Default — настройки нового пользователя
+func Default() Preferences {
+	return Preferences{
+		TimeZone:  "UTC",
+		Locale:    "en",
+		WeekStart: "monday",
+		Notifications: Notifications{
+			Emails: map[string]bool{
+				EmailReminders:      true,
+				EmailWeeklySummary:  true,
+				EmailProductUpdates: true,
+			},
+			ReminderChannels: []string{ChannelEmail},
+		},
+	}
+}
+
+// Validate проверяет значения настроек
+func (p Preferences) Validate() error {
+	if _, err := time.LoadLocation(p.TimeZone); err != nil || p.TimeZone == "" {
+		return fmt.Errorf("unknown time zone %q", p.TimeZone)
+	}
+	if !contains(SupportedLocales, p.Locale) {
+		return fmt.Errorf("unsupported locale %q", p.Locale)
+	}
+	if p.WeekStart != "monday" && p.WeekStart != "sunday" {
+		return errors.New("week_start must be monday or sunday")
+	}
+	for category := range p.Notifications.Emails {
+		if !contains([]string{EmailReminders, EmailWeeklySummary, EmailProductUpdates}, category) {
+			return fmt.Errorf("unknown email category %q", category)
+		}
+	}
+	for _, channel := range p.Notifications.ReminderChannels {
+		if channel != ChannelEmail && channel != ChannelInApp {
+			return fmt.Errorf("unknown reminder channel %q", channel)
+		}
+	}
+	if q := p.Notifications.QuietHours; q != nil {
+		if !clockPattern.MatchString(q.Start) || !clockPattern.MatchString(q.End) {
+			return errors.New("quiet_hours must use HH:MM format")
+		}
+	}
+	return nil
+}
+
+// Location — часовой пояс пользователя (UTC, если пояс некорректен)
+func (p Preferences) Location() *time.Location {
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// AllowsEmail — согласен ли пользователь получать письма категории
+func (p Preferences) AllowsEmail(category string) bool {
+	return p.Notifications.Emails[category]
+}
+
+// InQuietHours — попадает ли момент t в тихие часы пользователя.
+// Интервал может переходить через полночь (22:00–07:00).
+func (p Preferences) InQuietHours(t time.Time) bool {
+	q := p.Notifications.QuietHours
+	if q == nil || q.Start == q.End {
+		return false
+	}
+	local := t.In(p.Location()).Format("15:04")
+	if q.Start < q.End {
+		return local >= q.Start && local < q.End
+	}
+	return local >= q.Start || local < q.End
+}
+
+// Apply накладывает частичные настройки в JSON на текущие. Поля, которых нет
+// в patch, не меняются; quiet_hours: null отключает тихие часы.
+func (p Preferences) Apply(patch []byte) (Preferences, error) {
+	// Копируем карту, чтобы не менять исходные настройки
+	emails := make(map[string]bool, len(p.Notifications.Emails))
+	for k, v := range p.Notifications.Emails {
+		emails[k] = v
+	}
+	p.Notifications.Emails = emails
+
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return p, err
+	}
+	return p, p.Validate()
+}
+
+// Load читает настройки пользователя; незаданные поля берутся из Default
+func Load(db *sql.DB, userID int) (Preferences, error) {
+	var raw []byte
+	err := db.QueryRow(`SELECT preferences FROM users WHERE user_id = $1`, userID).Scan(&raw)
+	if err != nil {
+		return Preferences{}, err
+	}
+	return Default().Apply(raw)
+}
+
+// LoadByEmail читает настройки по адресу; для неизвестного адреса возвращает Default
+func LoadByEmail(db *sql.DB, email string) (Preferences, error) {
+	var raw []byte
+	err := db.QueryRow(`SELECT preferences FROM users WHERE LOWER(email) = LOWER($1)`, email).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return Default(), nil
+	}
+	if err != nil {
+		return Preferences{}, err
+	}
+	return Default().Apply(raw)
+}
+
+// FilterRecipients оставляет адреса, владельцы которых не отписались от писем категории.
+// Для пользователей без сохранённых настроек и незнакомых адресов действует Default.
+func FilterRecipients(db *sql.DB, emails []string, category string) ([]string, error) {
+	lowered := make([]string, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(email)
+	}
+	rows, err := db.Query(`SELECT LOWER(email), preferences FROM users WHERE LOWER(email) = ANY($1)`, pq.Array(lowered))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	allowed := make(map[string]bool)
+	for rows.Next() {
+		var email string
+		var raw []byte
+		if err := rows.Scan(&email, &raw); err != nil {
+			return nil, err
+		}
+		if prefs, err := Default().Apply(raw); err == nil {
+			allowed[email] = prefs.AllowsEmail(category)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for i, email := range emails {
+		ok, known := allowed[lowered[i]]
+		if !known {
+			ok = Default().AllowsEmail(category)
+		}
+		if ok {
+			result = append(result, email)
+		}
+	}
+	return result, nil
+}
+
+// Save сохраняет настройки пользователя
+func Save(db *sql.DB, userID int, p Preferences) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE users SET preferences = $1, updated_at = NOW() WHERE user_id = $2`, raw, userID)
+	return err
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
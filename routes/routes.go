@@ -2,6 +2,8 @@ package routes
 
 import (
 	"HabitMaster/auth"
+	"HabitMaster/handlers"
+	"database/sql"
 
 	"net/http"
 
@@ -12,9 +14,53 @@ func SetupRoutes() *mux.Router {
 	r := mux.NewRouter()
 
 	r.HandleFunc("/register", auth.Register).Methods(http.MethodPost)
+	r.HandleFunc("/auth/registration", auth.RegistrationInfo).Methods(http.MethodGet)
+	r.HandleFunc("/.well-known/jwks.json", auth.JWKS).Methods(http.MethodGet)
 	r.HandleFunc("/login", auth.Login).Methods(http.MethodPost)
 	r.HandleFunc("/verify-email", auth.VerifyCode).Methods(http.MethodPost)
-	r.HandleFunc("/logout", auth.Logout).Methods(http.MethodPost)
+	r.HandleFunc("/resend-verification", auth.ResendVerification).Methods(http.MethodPost)
+	r.HandleFunc("/password/forgot", auth.ForgotPassword).Methods(http.MethodPost)
+	r.HandleFunc("/password/reset", auth.ResetPassword).Methods(http.MethodPost)
+	r.Handle("/logout", auth.AuthMiddleware(http.HandlerFunc(auth.Logout))).Methods(http.MethodPost)
+	r.Handle("/logout/all", auth.AuthMiddleware(http.HandlerFunc(auth.LogoutAll))).Methods(http.MethodPost)
+	r.HandleFunc("/token/refresh", auth.RefreshToken).Methods(http.MethodPost)
+	r.HandleFunc("/login/2fa", auth.LoginSecondFactor).Methods(http.MethodPost)
+	r.HandleFunc("/login/magic", auth.RequestMagicLink).Methods(http.MethodPost)
+	r.HandleFunc("/login/magic/verify", auth.ConsumeMagicLink).Methods(http.MethodPost)
+	r.HandleFunc("/login/not-me", auth.ReportUnrecognizedLogin).Methods(http.MethodPost)
+	r.HandleFunc("/auth/oidc/login", auth.OIDCLogin).Methods(http.MethodGet)
+	r.HandleFunc("/auth/oidc/callback", auth.OIDCCallback).Methods(http.MethodGet)
+	r.Handle("/api/2fa/enroll", auth.AuthMiddleware(http.HandlerFunc(auth.EnrollTOTP))).Methods(http.MethodPost)
+	r.Handle("/api/2fa/confirm", auth.AuthMiddleware(http.HandlerFunc(auth.ConfirmTOTP))).Methods(http.MethodPost)
+	r.Handle("/api/2fa/disable", auth.AuthMiddleware(http.HandlerFunc(auth.DisableTOTP))).Methods(http.MethodPost)
 
 	return r
 }
+
+// RegisterTrackerRoutes — маршруты привычек, целей и OKR. Все они требуют авторизации;
+// области доступа API-токенов проверяет TokenScopeMiddleware на уровне роутера.
+func RegisterTrackerRoutes(r *mux.Router, db *sql.DB) {
+	// Привычки
+	habits := r.PathPrefix("/api/habits").Subrouter()
+	habits.Use(auth.AuthMiddleware)
+	habits.HandleFunc("", handlers.CreateHabit(db)).Methods("POST")
+	habits.HandleFunc("", handlers.GetHabits(db)).Methods("GET")
+	habits.HandleFunc("", handlers.DeleteHabitByName(db)).Methods("DELETE")
+	habits.HandleFunc("", handlers.UpdateHabit(db)).Methods("PUT")
+	habits.HandleFunc("/{id:[0-9]+}/history", handlers.GetHabitHistory(db)).Methods("GET")
+	habits.HandleFunc("/{id:[0-9]+}/history/{version:[0-9]+}/revert", handlers.RevertHabit(db)).Methods("POST")
+
+	// Цели
+	goals := r.PathPrefix("/api/goals").Subrouter()
+	goals.Use(auth.AuthMiddleware)
+	goals.HandleFunc("", handlers.CreateGoal(db)).Methods("POST")
+	goals.HandleFunc("", handlers.GetGoals(db)).Methods("GET")
+	goals.HandleFunc("", handlers.UpdateGoal(db)).Methods("PUT")
+	goals.HandleFunc("", handlers.DeleteGoalByName(db)).Methods("DELETE")
+	goals.HandleFunc("/deleteAll", handlers.DeleteAllGoals(db)).Methods("DELETE")
+	goals.HandleFunc("/{id:[0-9]+}/progress", handlers.AddGoalProgress(db)).Methods("POST")
+	goals.HandleFunc("/{id:[0-9]+}/progress", handlers.GetGoalProgress(db)).Methods("GET")
+	goals.HandleFunc("/{id:[0-9]+}/history", handlers.GetGoalHistory(db)).Methods("GET")
+	goals.HandleFunc("/{id:[0-9]+}/history/{version:[0-9]+}/revert", handlers.RevertGoal(db)).Methods("POST")
+	r.Handle("/api/okrs", auth.AuthMiddleware(handlers.GetOKRs(db))).Methods("GET")
+}